@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Event is a structured audit record describing a single federated request.
+type Event struct {
+	Timestamp  time.Time `json:"timestamp"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Identity   string    `json:"identity"`
+	Groups     []string  `json:"groups,omitempty"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Backend    string    `json:"backend,omitempty"`
+	Clusters   []string  `json:"clusters,omitempty"`
+	Tenants    []string  `json:"tenants,omitempty"`
+	Query      string    `json:"query,omitempty"`
+	Matchers   []string  `json:"matchers,omitempty"`
+	Start      string    `json:"start,omitempty"`
+	End        string    `json:"end,omitempty"`
+	Time       string    `json:"time,omitempty"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"durationMs"`
+}
+
+// Sink receives audit events.
+// Implementations must be safe for concurrent use.
+type Sink interface {
+	// Name returns a short identifier used in logs and metrics.
+	Name() string
+	// Emit records a single event.
+	Emit(event Event) error
+	// Close flushes any buffered events and releases resources.
+	Close() error
+}
+
+// Logger dispatches audit events to a set of sinks.
+type Logger struct {
+	sinks []Sink
+	mu    sync.RWMutex
+}
+
+// NewLogger creates a new audit logger writing to the given sinks.
+func NewLogger(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks}
+}
+
+// AddSink registers an additional sink.
+func (l *Logger) AddSink(sink Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sinks = append(l.sinks, sink)
+}
+
+// Enabled returns true if the logger has at least one sink.
+func (l *Logger) Enabled() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.sinks) > 0
+}
+
+// Emit sends the event to all sinks. Sink errors are logged and do not
+// affect the request being audited.
+func (l *Logger) Emit(event Event) {
+	l.mu.RLock()
+	sinks := l.sinks
+	l.mu.RUnlock()
+
+	for _, sink := range sinks {
+		if err := sink.Emit(event); err != nil {
+			log.Error().Err(err).Str("sink", sink.Name()).Msg("failed to emit audit event")
+		}
+	}
+}
+
+// Close closes all sinks.
+func (l *Logger) Close() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var errs []error
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type eventContextKey struct{}
+
+// WithEvent returns a copy of ctx carrying the given event, so that handlers
+// further down the chain can annotate it.
+func WithEvent(ctx context.Context, event *Event) context.Context {
+	return context.WithValue(ctx, eventContextKey{}, event)
+}
+
+// FromContext returns the event stored in ctx, or nil if the request is not audited.
+func FromContext(ctx context.Context) *Event {
+	event, _ := ctx.Value(eventContextKey{}).(*Event)
+	return event
+}
+
+// Annotate records the backend, cluster, resolved tenants and query parameters
+// on the event stored in ctx. It is a no-op if the request is not audited.
+func Annotate(ctx context.Context, backend, cluster string, params url.Values, orgID string) {
+	event := FromContext(ctx)
+	if event == nil {
+		return
+	}
+
+	event.Backend = backend
+	event.Clusters = []string{cluster}
+	event.Query = params.Get("query")
+	event.Matchers = params["match[]"]
+	event.Start = params.Get("start")
+	event.End = params.Get("end")
+	event.Time = params.Get("time")
+	if orgID != "" {
+		event.Tenants = strings.Split(orgID, "|")
+	}
+}
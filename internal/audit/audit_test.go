@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// memorySink records emitted events for testing.
+type memorySink struct {
+	events []Event
+	err    error
+	closed bool
+	mu     sync.Mutex
+}
+
+func (m *memorySink) Name() string { return "memory" }
+
+func (m *memorySink) Emit(event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return m.err
+}
+
+func (m *memorySink) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestLogger_Emit(t *testing.T) {
+	failing := &memorySink{err: errors.New("boom")}
+	ok := &memorySink{}
+
+	logger := NewLogger(failing)
+	if !logger.Enabled() {
+		t.Fatal("expected logger with sinks to be enabled")
+	}
+	logger.AddSink(ok)
+
+	logger.Emit(Event{Identity: "alice"})
+
+	// A failing sink must not prevent delivery to the others
+	if len(ok.events) != 1 || ok.events[0].Identity != "alice" {
+		t.Errorf("expected event delivered to healthy sink, got %+v", ok.events)
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !failing.closed || !ok.closed {
+		t.Error("expected all sinks to be closed")
+	}
+}
+
+func TestLogger_Enabled(t *testing.T) {
+	var nilLogger *Logger
+	if nilLogger.Enabled() {
+		t.Error("nil logger should not be enabled")
+	}
+	if NewLogger().Enabled() {
+		t.Error("logger without sinks should not be enabled")
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	event := &Event{}
+	ctx := WithEvent(context.Background(), event)
+
+	params := url.Values{
+		"query":   {`{job="app"}`},
+		"start":   {"1609459200"},
+		"end":     {"1609545600"},
+		"match[]": {`{job="a"}`, `{job="b"}`},
+	}
+	Annotate(ctx, "loki", "prod", params, "team-a|team-b")
+
+	if event.Backend != "loki" {
+		t.Errorf("expected backend loki, got %s", event.Backend)
+	}
+	if len(event.Clusters) != 1 || event.Clusters[0] != "prod" {
+		t.Errorf("expected clusters [prod], got %v", event.Clusters)
+	}
+	if len(event.Tenants) != 2 || event.Tenants[0] != "team-a" || event.Tenants[1] != "team-b" {
+		t.Errorf("expected tenants [team-a team-b], got %v", event.Tenants)
+	}
+	if event.Query != `{job="app"}` {
+		t.Errorf("unexpected query: %s", event.Query)
+	}
+	if event.Start != "1609459200" || event.End != "1609545600" {
+		t.Errorf("unexpected time range: %s - %s", event.Start, event.End)
+	}
+	if len(event.Matchers) != 2 {
+		t.Errorf("expected 2 matchers, got %v", event.Matchers)
+	}
+}
+
+func TestAnnotate_NoEvent(t *testing.T) {
+	// Must not panic when the request is not audited
+	Annotate(context.Background(), "mimir", "prod", url.Values{}, "")
+
+	if FromContext(context.Background()) != nil {
+		t.Error("expected nil event from empty context")
+	}
+}
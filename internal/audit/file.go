@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// FileSink writes audit events as JSON lines to a file, rotating it when it
+// grows beyond the configured size.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file   *os.File
+	size   int64
+	closed bool
+	mu     sync.Mutex
+}
+
+// FileSinkConfig holds configuration for creating a file sink.
+type FileSinkConfig struct {
+	Path       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+// NewFileSink creates a new rotating JSON-lines file sink.
+func NewFileSink(cfg FileSinkConfig) (*FileSink, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	maxSizeMB := cfg.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = 100
+	}
+	maxBackups := cfg.MaxBackups
+	if maxBackups < 0 {
+		maxBackups = 0
+	}
+
+	s := &FileSink{
+		path:       cfg.Path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Name returns the sink name.
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+// Emit appends the event to the file as a single JSON line.
+func (s *FileSink) Emit(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		metrics.AuditEventsTotal.WithLabelValues(s.Name(), "error").Inc()
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		metrics.AuditEventsTotal.WithLabelValues(s.Name(), "error").Inc()
+		return fmt.Errorf("audit file is closed")
+	}
+
+	// A failed rotation or reopen may have left no file open
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			metrics.AuditEventsTotal.WithLabelValues(s.Name(), "error").Inc()
+			return err
+		}
+	}
+
+	if s.size+int64(len(line)) > s.maxSize && s.size > 0 {
+		if err := s.rotate(); err != nil {
+			// Keep writing to the current file, and retry the rotation
+			// with the next event
+			log.Warn().Err(err).Str("path", s.path).Msg("failed to rotate audit file")
+			if s.file == nil {
+				if err := s.open(); err != nil {
+					metrics.AuditEventsTotal.WithLabelValues(s.Name(), "error").Inc()
+					return err
+				}
+			}
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		metrics.AuditEventsTotal.WithLabelValues(s.Name(), "error").Inc()
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+
+	metrics.AuditEventsTotal.WithLabelValues(s.Name(), "success").Inc()
+	return nil
+}
+
+// Close closes the underlying file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit file: %w", err)
+	}
+
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts existing backups (path.1 -> path.2, ...), moves the current
+// file to path.1 and opens a fresh file. Must be called with s.mu held.
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit file: %w", err)
+	}
+	s.file = nil
+
+	if s.maxBackups == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove audit file: %w", err)
+		}
+		return s.open()
+	}
+
+	// Drop the oldest backup, then shift the rest up by one
+	oldest := fmt.Sprintf("%s.%d", s.path, s.maxBackups)
+	if err := os.Remove(oldest); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove audit backup: %w", err)
+	}
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", s.path, i)
+		to := fmt.Sprintf("%s.%d", s.path, i+1)
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate audit backup: %w", err)
+		}
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate audit file: %w", err)
+	}
+
+	return s.open()
+}
@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readEvents(t *testing.T, path string) []Event {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestNewFileSink_MissingPath(t *testing.T) {
+	_, err := NewFileSink(FileSinkConfig{})
+	if err == nil || err.Error() != "path is required" {
+		t.Errorf("expected 'path is required' error, got %v", err)
+	}
+}
+
+func TestFileSink_Emit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+
+	sink, err := NewFileSink(FileSinkConfig{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := sink.Emit(Event{Identity: "alice", Query: `{job="app"}`, Status: 200}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sink.Emit(Event{Identity: "bob", Query: "up", Status: 502}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := readEvents(t, path)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Identity != "alice" || events[1].Identity != "bob" {
+		t.Errorf("unexpected identities: %s, %s", events[0].Identity, events[1].Identity)
+	}
+	if events[1].Status != 502 {
+		t.Errorf("expected status 502, got %d", events[1].Status)
+	}
+
+	if err := sink.Emit(Event{}); err == nil {
+		t.Error("expected error emitting to closed sink")
+	}
+}
+
+func TestFileSink_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	sink, err := NewFileSink(FileSinkConfig{Path: path, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sink.Close()
+
+	// Force a rotation on every write after the first
+	sink.maxSize = 10
+
+	for _, id := range []string{"one", "two", "three", "four"} {
+		if err := sink.Emit(Event{Identity: id}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		file     string
+		identity string
+	}{
+		{path, "four"},
+		{path + ".1", "three"},
+		{path + ".2", "two"},
+	}
+	for _, tt := range tests {
+		events := readEvents(t, tt.file)
+		if len(events) != 1 || events[0].Identity != tt.identity {
+			t.Errorf("%s: expected single event for %q, got %+v", tt.file, tt.identity, events)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no third backup, stat returned %v", err)
+	}
+}
+
+func TestFileSink_RotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	sink, err := NewFileSink(FileSinkConfig{Path: path, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sink.Close()
+	sink.maxSize = 10
+
+	// A non-empty directory in place of the backup cannot be removed
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	for _, id := range []string{"one", "two"} {
+		if err := sink.Emit(Event{Identity: id}); err != nil {
+			t.Fatalf("expected events to be written despite the failed rotation: %v", err)
+		}
+	}
+	if events := readEvents(t, path); len(events) != 2 {
+		t.Fatalf("expected 2 events in the current file, got %+v", events)
+	}
+
+	// The rotation succeeds once the error is gone
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatalf("failed to remove directory: %v", err)
+	}
+	if err := sink.Emit(Event{Identity: "three"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if events := readEvents(t, path); len(events) != 1 || events[0].Identity != "three" {
+		t.Errorf("expected the current file to hold three, got %+v", events)
+	}
+	if events := readEvents(t, path+".1"); len(events) != 2 {
+		t.Errorf("expected the backup to hold 2 events, got %+v", events)
+	}
+
+	sink.Close()
+	if err := sink.Emit(Event{Identity: "four"}); err == nil {
+		t.Error("expected an error after close")
+	}
+}
+
+func TestFileSink_AppendsToExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte(`{"identity":"existing"}`+"\n"), 0o640); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	sink, err := NewFileSink(FileSinkConfig{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sink.Emit(Event{Identity: "new"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sink.Close()
+
+	events := readEvents(t, path)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Identity != "existing" || events[1].Identity != "new" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
@@ -0,0 +1,241 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// dropLogInterval is how often dropped events are summarized in the log.
+const dropLogInterval = time.Minute
+
+// WebhookSink batches audit events and POSTs them as a JSON array to an HTTP
+// endpoint, retrying failed deliveries with exponential backoff.
+type WebhookSink struct {
+	url           string
+	headers       map[string]string
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	retryBackoff  time.Duration
+	httpClient    *http.Client
+
+	// dropped counts the events dropped since the last drop summary
+	dropped atomic.Int64
+
+	queue   chan Event
+	stopCh  chan struct{}
+	done    chan struct{}
+	closeMu sync.Once
+}
+
+// WebhookSinkConfig holds configuration for creating a webhook sink.
+type WebhookSinkConfig struct {
+	URL           string
+	Headers       map[string]string
+	BatchSize     int
+	QueueSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+	Timeout       time.Duration
+}
+
+// NewWebhookSink creates a new webhook sink and starts its delivery loop.
+func NewWebhookSink(cfg WebhookSinkConfig) (*WebhookSink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10000
+	}
+	flushInterval := cfg.FlushInterval
+	if flushInterval == 0 {
+		flushInterval = 5 * time.Second
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	s := &WebhookSink{
+		url:           cfg.URL,
+		headers:       cfg.Headers,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		maxRetries:    maxRetries,
+		retryBackoff:  500 * time.Millisecond,
+		httpClient:    &http.Client{Timeout: timeout},
+		queue:         make(chan Event, queueSize),
+		stopCh:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// Name returns the sink name.
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+// Emit enqueues the event for delivery. If the queue is full, the event is
+// dropped so that a slow webhook never blocks request handling. Drops are
+// counted and summarized in the log at most once a minute, rather than logged
+// one by one while the queue is full.
+func (s *WebhookSink) Emit(event Event) error {
+	select {
+	case s.queue <- event:
+	default:
+		s.dropped.Add(1)
+		metrics.AuditEventsTotal.WithLabelValues(s.Name(), "dropped").Inc()
+	}
+	return nil
+}
+
+// Close stops the delivery loop after flushing any queued events.
+func (s *WebhookSink) Close() error {
+	s.closeMu.Do(func() {
+		close(s.stopCh)
+	})
+	<-s.done
+	return nil
+}
+
+func (s *WebhookSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	dropTicker := time.NewTicker(dropLogInterval)
+	defer dropTicker.Stop()
+	defer s.logDropped()
+
+	batch := make([]Event, 0, s.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		s.deliver(batch)
+		batch = make([]Event, 0, s.batchSize)
+	}
+
+	for {
+		select {
+		case event := <-s.queue:
+			batch = append(batch, event)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-dropTicker.C:
+			s.logDropped()
+		case <-s.stopCh:
+			// Drain whatever is left in the queue before exiting
+			for {
+				select {
+				case event := <-s.queue:
+					batch = append(batch, event)
+					if len(batch) >= s.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// logDropped logs the number of events dropped since the last call, if any.
+func (s *WebhookSink) logDropped() {
+	if n := s.dropped.Swap(0); n > 0 {
+		log.Error().
+			Int64("dropped", n).
+			Int("queue_size", cap(s.queue)).
+			Msg("audit webhook queue full, events dropped")
+	}
+}
+
+// deliver sends a batch, retrying on transport errors, 429 and 5xx responses.
+func (s *WebhookSink) deliver(batch []Event) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal audit batch")
+		metrics.AuditEventsTotal.WithLabelValues(s.Name(), "error").Add(float64(len(batch)))
+		return
+	}
+
+	backoff := s.retryBackoff
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		retry, err := s.post(body)
+		if err == nil {
+			metrics.AuditEventsTotal.WithLabelValues(s.Name(), "success").Add(float64(len(batch)))
+			return
+		}
+
+		log.Warn().
+			Err(err).
+			Int("attempt", attempt+1).
+			Int("batch_size", len(batch)).
+			Msg("audit webhook delivery failed")
+
+		if !retry {
+			break
+		}
+	}
+
+	metrics.AuditEventsTotal.WithLabelValues(s.Name(), "error").Add(float64(len(batch)))
+}
+
+// post sends the body once. The returned bool reports whether the failure is retryable.
+func (s *WebhookSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
@@ -0,0 +1,215 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+func TestNewWebhookSink_MissingURL(t *testing.T) {
+	_, err := NewWebhookSink(WebhookSinkConfig{})
+	if err == nil || err.Error() != "url is required" {
+		t.Errorf("expected 'url is required' error, got %v", err)
+	}
+}
+
+func TestWebhookSink_Batching(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]Event
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			t.Errorf("expected X-Api-Key header, got %q", r.Header.Get("X-Api-Key"))
+		}
+		var batch []Event
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("failed to decode batch: %v", err)
+		}
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink, err := NewWebhookSink(WebhookSinkConfig{
+		URL:           srv.URL,
+		Headers:       map[string]string{"X-Api-Key": "secret"},
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := sink.Emit(Event{Identity: id}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Close flushes the final partial batch
+	sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(batches))
+	}
+	if len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Errorf("unexpected batch sizes: %d, %d", len(batches[0]), len(batches[1]))
+	}
+	if batches[1][0].Identity != "c" {
+		t.Errorf("expected last event c, got %s", batches[1][0].Identity)
+	}
+}
+
+func TestWebhookSink_Retry(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		expectedCalls int
+	}{
+		{"retries server errors", http.StatusServiceUnavailable, 3},
+		{"retries throttling", http.StatusTooManyRequests, 3},
+		{"does not retry client errors", http.StatusBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			calls := 0
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				mu.Lock()
+				calls++
+				mu.Unlock()
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			sink, err := NewWebhookSink(WebhookSinkConfig{
+				URL:           srv.URL,
+				BatchSize:     1,
+				FlushInterval: time.Hour,
+				MaxRetries:    2,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			sink.retryBackoff = time.Millisecond
+
+			sink.Emit(Event{Identity: "a"})
+			sink.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if calls != tt.expectedCalls {
+				t.Errorf("expected %d calls, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestWebhookSink_RetrySucceeds(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sink, err := NewWebhookSink(WebhookSinkConfig{
+		URL:           srv.URL,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		MaxRetries:    3,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sink.retryBackoff = time.Millisecond
+
+	sink.Emit(Event{Identity: "a"})
+	sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestWebhookSink_DropsWhenQueueFull(t *testing.T) {
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = original })
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sink, err := NewWebhookSink(WebhookSinkConfig{
+		URL:           srv.URL,
+		BatchSize:     1,
+		QueueSize:     1,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	droppedBefore := testutil.ToFloat64(metrics.AuditEventsTotal.WithLabelValues("webhook", "dropped"))
+	for range 10 {
+		if err := sink.Emit(Event{Identity: "a"}); err != nil {
+			t.Fatalf("expected dropped events to be counted, not returned as errors: %v", err)
+		}
+	}
+	close(release)
+
+	// Close logs the drops since the last summary
+	sink.Close()
+
+	dropped := testutil.ToFloat64(metrics.AuditEventsTotal.WithLabelValues("webhook", "dropped")) - droppedBefore
+	if dropped < 1 {
+		t.Fatal("expected events to be dropped")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected a single drop summary, got %d log lines: %s", len(lines), buf.String())
+	}
+	var entry struct {
+		Dropped int64 `json:"dropped"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("failed to decode log line: %v", err)
+	}
+	if float64(entry.Dropped) != dropped {
+		t.Errorf("expected summary of %v dropped events, got %d", dropped, entry.Dropped)
+	}
+}
@@ -0,0 +1,239 @@
+// Package breaker provides a circuit breaker for upstream backends.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// ErrOpen is returned by Allow while the circuit is open.
+var ErrOpen = errors.New("circuit breaker open")
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// Closed lets all requests through.
+	Closed State = iota
+	// HalfOpen lets a limited number of probe requests through.
+	HalfOpen
+	// Open rejects all requests.
+	Open
+)
+
+// String returns the state name used in APIs and metrics.
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// Outcome is the result of a request let through by the breaker.
+type Outcome int
+
+const (
+	// Success is a request the backend answered.
+	Success Outcome = iota
+	// Failure is a request that failed because of the backend.
+	Failure
+	// Ignored is a request whose result says nothing about the backend,
+	// such as one cancelled by the caller.
+	Ignored
+)
+
+// Config holds configuration for creating a circuit breaker.
+type Config struct {
+	// Cluster and Backend are used as labels in metrics.
+	Cluster string
+	Backend string
+	// ConsecutiveFailures opens the circuit after this many failures in a
+	// row. Defaults to 5.
+	ConsecutiveFailures int
+	// FailureRatio opens the circuit when this share of the requests in the
+	// current window failed. Defaults to 0.5.
+	FailureRatio float64
+	// MinRequests is the number of requests in a window before the failure
+	// ratio is considered. Defaults to 20.
+	MinRequests int
+	// Window is the period over which the failure ratio is computed.
+	// Defaults to 1 minute.
+	Window time.Duration
+	// OpenTimeout is how long the circuit stays open before probing.
+	// Defaults to 30 seconds.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of concurrent probe requests allowed
+	// while half-open. Defaults to 1.
+	HalfOpenRequests int
+}
+
+// Breaker is a circuit breaker. It opens after consecutive failures or a
+// high failure ratio, rejects requests while open, and closes again once a
+// probe request succeeds.
+type Breaker struct {
+	cluster             string
+	backend             string
+	consecutiveFailures int
+	failureRatio        float64
+	minRequests         int
+	window              time.Duration
+	openTimeout         time.Duration
+	halfOpenRequests    int
+	now                 func() time.Time
+
+	mu          sync.Mutex
+	state       State
+	generation  uint64
+	consecutive int
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probes      int
+}
+
+// New creates a new circuit breaker in the closed state.
+func New(cfg Config) *Breaker {
+	b := &Breaker{
+		cluster:             cfg.Cluster,
+		backend:             cfg.Backend,
+		consecutiveFailures: cfg.ConsecutiveFailures,
+		failureRatio:        cfg.FailureRatio,
+		minRequests:         cfg.MinRequests,
+		window:              cfg.Window,
+		openTimeout:         cfg.OpenTimeout,
+		halfOpenRequests:    cfg.HalfOpenRequests,
+		now:                 time.Now,
+	}
+	if b.consecutiveFailures == 0 {
+		b.consecutiveFailures = 5
+	}
+	if b.failureRatio == 0 {
+		b.failureRatio = 0.5
+	}
+	if b.minRequests == 0 {
+		b.minRequests = 20
+	}
+	if b.window == 0 {
+		b.window = time.Minute
+	}
+	if b.openTimeout == 0 {
+		b.openTimeout = 30 * time.Second
+	}
+	if b.halfOpenRequests == 0 {
+		b.halfOpenRequests = 1
+	}
+
+	metrics.CircuitBreakerState.WithLabelValues(b.cluster, b.backend).Set(float64(Closed))
+	return b
+}
+
+// Allow reports whether a request may be sent. If so, the returned function
+// must be called with the outcome of the request. Otherwise ErrOpen is
+// returned.
+func (b *Breaker) Allow() (done func(Outcome), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.openTimeout {
+		b.setState(HalfOpen)
+	}
+
+	switch b.state {
+	case Open:
+		metrics.CircuitBreakerRejectedTotal.WithLabelValues(b.cluster, b.backend).Inc()
+		return nil, ErrOpen
+	case HalfOpen:
+		if b.probes >= b.halfOpenRequests {
+			metrics.CircuitBreakerRejectedTotal.WithLabelValues(b.cluster, b.backend).Inc()
+			return nil, ErrOpen
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(outcome Outcome) {
+		b.record(generation, outcome)
+	}, nil
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.openTimeout {
+		return HalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) record(generation uint64, outcome Outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Ignore results of requests let through before the last transition
+	if generation != b.generation {
+		return
+	}
+
+	if b.state == HalfOpen {
+		switch outcome {
+		case Success:
+			b.setState(Closed)
+		case Failure:
+			b.setState(Open)
+		default:
+			b.probes--
+		}
+		return
+	}
+
+	if outcome == Ignored {
+		return
+	}
+
+	now := b.now()
+	if now.Sub(b.windowStart) > b.window {
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+	b.requests++
+
+	if outcome == Success {
+		b.consecutive = 0
+		return
+	}
+
+	b.consecutive++
+	b.failures++
+	if b.consecutive >= b.consecutiveFailures ||
+		(b.requests >= b.minRequests && float64(b.failures)/float64(b.requests) >= b.failureRatio) {
+		b.setState(Open)
+	}
+}
+
+// setState transitions the breaker. The caller must hold b.mu.
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.generation++
+	b.consecutive = 0
+	b.requests = 0
+	b.failures = 0
+	b.windowStart = b.now()
+	b.probes = 0
+	if state == Open {
+		b.openedAt = b.now()
+	}
+
+	metrics.CircuitBreakerState.WithLabelValues(b.cluster, b.backend).Set(float64(state))
+	metrics.CircuitBreakerTransitionsTotal.WithLabelValues(b.cluster, b.backend, state.String()).Inc()
+}
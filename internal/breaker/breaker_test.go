@@ -0,0 +1,144 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(cfg Config, now *time.Time) *Breaker {
+	b := New(cfg)
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func call(t *testing.T, b *Breaker, outcome Outcome) {
+	t.Helper()
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("expected request to be allowed, got %v", err)
+	}
+	done(outcome)
+}
+
+func TestBreaker_ConsecutiveFailures(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := newTestBreaker(Config{ConsecutiveFailures: 3}, &now)
+
+	call(t, b, Failure)
+	call(t, b, Failure)
+	call(t, b, Success)
+	call(t, b, Failure)
+	call(t, b, Failure)
+	if b.State() != Closed {
+		t.Fatalf("expected a success to reset the failure count, got %s", b.State())
+	}
+
+	call(t, b, Failure)
+	if b.State() != Open {
+		t.Fatalf("expected breaker to open, got %s", b.State())
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("expected ErrOpen, got %v", err)
+	}
+}
+
+func TestBreaker_FailureRatio(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := newTestBreaker(Config{ConsecutiveFailures: 100, FailureRatio: 0.5, MinRequests: 10}, &now)
+
+	for i := 0; i < 9; i++ {
+		outcome := Success
+		if i%2 == 0 {
+			outcome = Failure
+		}
+		call(t, b, outcome)
+	}
+	if b.State() != Closed {
+		t.Fatalf("expected breaker to stay closed below min requests, got %s", b.State())
+	}
+
+	call(t, b, Success)
+	call(t, b, Failure)
+	if b.State() != Open {
+		t.Fatalf("expected breaker to open at 6/11 failures, got %s", b.State())
+	}
+}
+
+func TestBreaker_FailureRatioWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := newTestBreaker(Config{ConsecutiveFailures: 100, FailureRatio: 0.5, MinRequests: 4, Window: time.Minute}, &now)
+
+	call(t, b, Failure)
+	call(t, b, Success)
+	call(t, b, Failure)
+
+	// Old failures fall out of the window
+	now = now.Add(2 * time.Minute)
+	call(t, b, Failure)
+	call(t, b, Success)
+	call(t, b, Success)
+	call(t, b, Success)
+	if b.State() != Closed {
+		t.Errorf("expected breaker to stay closed, got %s", b.State())
+	}
+}
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := newTestBreaker(Config{ConsecutiveFailures: 1, OpenTimeout: 30 * time.Second}, &now)
+
+	call(t, b, Failure)
+	if b.State() != Open {
+		t.Fatalf("expected breaker to open, got %s", b.State())
+	}
+
+	// After the open timeout, a single probe is let through
+	now = now.Add(30 * time.Second)
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatalf("expected probe to be allowed, got %v", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("expected concurrent probe to be rejected, got %v", err)
+	}
+
+	// A failed probe opens the circuit again
+	probe(Failure)
+	if b.State() != Open {
+		t.Fatalf("expected breaker to reopen, got %s", b.State())
+	}
+
+	// A successful probe closes it
+	now = now.Add(30 * time.Second)
+	call(t, b, Success)
+	if b.State() != Closed {
+		t.Fatalf("expected breaker to close, got %s", b.State())
+	}
+}
+
+func TestBreaker_IgnoresStaleAndIgnoredOutcomes(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := newTestBreaker(Config{ConsecutiveFailures: 1, OpenTimeout: 30 * time.Second}, &now)
+
+	slow, _ := b.Allow()
+	call(t, b, Failure)
+
+	// A success of a request sent before the circuit opened doesn't close it
+	slow(Success)
+	if b.State() != Open {
+		t.Fatalf("expected stale outcome to be ignored, got %s", b.State())
+	}
+
+	// A cancelled probe frees its slot without changing state
+	now = now.Add(30 * time.Second)
+	probe, _ := b.Allow()
+	probe(Ignored)
+	if b.State() != HalfOpen {
+		t.Fatalf("expected breaker to stay half-open, got %s", b.State())
+	}
+	call(t, b, Success)
+	if b.State() != Closed {
+		t.Errorf("expected breaker to close, got %s", b.State())
+	}
+}
@@ -0,0 +1,15 @@
+// Package cache provides response caching for federated queries.
+package cache
+
+import "time"
+
+// Cache is a byte-oriented key/value store.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored under key, if present and not expired.
+	Get(key string) ([]byte, bool)
+	// Set stores value under key. A zero ttl means the entry does not expire.
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete removes the entry stored under key.
+	Delete(key string)
+}
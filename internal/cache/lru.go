@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// LRU is an in-memory Cache that evicts the least recently used entries once
+// the total size of keys and values exceeds a limit.
+type LRU struct {
+	name     string
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func (e *lruEntry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+// NewLRU creates an LRU cache holding at most maxBytes of keys and values.
+// The name is used as the cache label in metrics.
+func NewLRU(name string, maxBytes int64) *LRU {
+	return &LRU{
+		name:     name,
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Get returns the value stored under key and marks it as recently used.
+func (c *LRU) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && c.now().After(entry.expires) {
+		c.removeElement(elem)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set stores value under key, evicting older entries as needed. Values larger
+// than the cache itself are not stored.
+func (c *LRU) Set(key string, value []byte, ttl time.Duration) {
+	entry := &lruEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = c.now().Add(ttl)
+	}
+	if entry.size() > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+
+	c.items[key] = c.ll.PushFront(entry)
+	c.size += entry.size()
+
+	for c.size > c.maxBytes {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.removeElement(oldest)
+		metrics.CacheEvictionsTotal.WithLabelValues(c.name).Inc()
+	}
+
+	metrics.CacheSizeBytes.WithLabelValues(c.name).Set(float64(c.size))
+}
+
+// Delete removes the entry stored under key.
+func (c *LRU) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+		metrics.CacheSizeBytes.WithLabelValues(c.name).Set(float64(c.size))
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Size returns the total size of keys and values in the cache.
+func (c *LRU) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *LRU) removeElement(elem *list.Element) {
+	entry := elem.Value.(*lruEntry)
+	c.ll.Remove(elem)
+	delete(c.items, entry.key)
+	c.size -= entry.size()
+}
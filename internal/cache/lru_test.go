@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU_GetSet(t *testing.T) {
+	c := NewLRU("test", 1024)
+
+	if _, ok := c.Get("missing"); ok {
+		t.Error("expected miss for unknown key")
+	}
+
+	c.Set("a", []byte("1"), 0)
+	got, ok := c.Get("a")
+	if !ok || string(got) != "1" {
+		t.Errorf("expected value 1, got %q (ok=%v)", got, ok)
+	}
+
+	c.Set("a", []byte("22"), 0)
+	if got, _ := c.Get("a"); string(got) != "22" {
+		t.Errorf("expected overwritten value 22, got %q", got)
+	}
+	if c.Size() != 3 {
+		t.Errorf("expected size 3, got %d", c.Size())
+	}
+
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected miss after delete")
+	}
+	if c.Size() != 0 {
+		t.Errorf("expected size 0 after delete, got %d", c.Size())
+	}
+}
+
+func TestLRU_Eviction(t *testing.T) {
+	// Each entry is 1 byte of key and 4 bytes of value
+	c := NewLRU("test", 10)
+
+	c.Set("a", []byte("aaaa"), 0)
+	c.Set("b", []byte("bbbb"), 0)
+
+	// Touch a so that b becomes the least recently used
+	c.Get("a")
+	c.Set("c", []byte("cccc"), 0)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("expected a to be kept")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Error("expected c to be kept")
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Len())
+	}
+
+	// Values larger than the cache are not stored
+	c.Set("big", make([]byte, 100), 0)
+	if _, ok := c.Get("big"); ok {
+		t.Error("expected oversized value not to be stored")
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected existing entries to be kept, got %d", c.Len())
+	}
+}
+
+func TestLRU_TTL(t *testing.T) {
+	c := NewLRU("test", 1024)
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), 0)
+
+	now = now.Add(2 * time.Minute)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected a to have expired")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("expected b without ttl to be kept")
+	}
+	if c.Len() != 1 {
+		t.Errorf("expected expired entry to be removed, got %d entries", c.Len())
+	}
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/tjorri/observability-federation-proxy/internal/limits"
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// MetadataFetchFunc fetches a metadata response upstream. It may be called
+// after the originating request has completed, so it must only use ctx.
+type MetadataFetchFunc func(ctx context.Context) (Response, error)
+
+// MetadataCacheConfig holds configuration for creating a metadata cache.
+type MetadataCacheConfig struct {
+	// Cache stores the responses.
+	Cache Cache
+	// Backend separates the keys of backends sharing a cache, and is used as
+	// the backend label in metrics.
+	Backend string
+	// TTL is how long a response is served without being refreshed.
+	// Defaults to 1 minute.
+	TTL time.Duration
+	// StaleTTL is how long an expired response is still served while it is
+	// refreshed in the background. Defaults to 10 minutes.
+	StaleTTL time.Duration
+	// TimeGranularity is the resolution at which start and end are compared
+	// when building keys, so that editors sending the current time on each
+	// request share entries. Defaults to 1 minute.
+	TimeGranularity time.Duration
+}
+
+// MetadataCache caches label name and label value responses. Expired entries
+// are served immediately while a single background request refreshes them.
+type MetadataCache struct {
+	cache       Cache
+	backend     string
+	ttl         time.Duration
+	staleTTL    time.Duration
+	granularity time.Duration
+	now         func() time.Time
+
+	mu          sync.Mutex
+	generations map[string]uint64
+	refreshing  map[string]bool
+}
+
+// NewMetadataCache creates a new metadata cache.
+func NewMetadataCache(cfg MetadataCacheConfig) (*MetadataCache, error) {
+	if cfg.Cache == nil {
+		return nil, fmt.Errorf("cache is required")
+	}
+
+	ttl := cfg.TTL
+	if ttl == 0 {
+		ttl = time.Minute
+	}
+	staleTTL := cfg.StaleTTL
+	if staleTTL == 0 {
+		staleTTL = 10 * time.Minute
+	}
+	granularity := cfg.TimeGranularity
+	if granularity == 0 {
+		granularity = time.Minute
+	}
+
+	return &MetadataCache{
+		cache:       cfg.Cache,
+		backend:     cfg.Backend,
+		ttl:         ttl,
+		staleTTL:    staleTTL,
+		granularity: granularity,
+		now:         time.Now,
+		generations: make(map[string]uint64),
+		refreshing:  make(map[string]bool),
+	}, nil
+}
+
+// Key builds a metadata cache key from the endpoint path, tenant header and
+// request parameters. Start and end are truncated to the time granularity and
+// the order of match[] selectors is ignored. The cluster is added by Do.
+func (c *MetadataCache) Key(path, orgID string, params url.Values) string {
+	normalized := make(url.Values, len(params))
+	for name, values := range params {
+		switch name {
+		case "start", "end":
+			if t, err := limits.ParseTime(values[0]); err == nil {
+				values = []string{strconv.FormatInt(t.Truncate(c.granularity).Unix(), 10)}
+			}
+		default:
+			values = append([]string(nil), values...)
+			sort.Strings(values)
+		}
+		normalized[name] = values
+	}
+
+	h := sha256.New()
+	for _, part := range []string{path, orgID, normalized.Encode()} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Do returns the cached response for key in the given cluster, fetching it
+// upstream on a miss. Expired entries within the stale TTL are returned as-is
+// and refreshed in the background. Only 2xx responses are cached.
+func (c *MetadataCache) Do(ctx context.Context, cluster, key string, fetch MetadataFetchFunc) (Response, error) {
+	fullKey := c.fullKey(cluster, key)
+
+	if data, ok := c.cache.Get(fullKey); ok && len(data) >= 8 {
+		fetchedAt := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+		resp := Response{StatusCode: http.StatusOK, Body: data[8:]}
+
+		if c.now().Sub(fetchedAt) < c.ttl {
+			metrics.MetadataCacheRequestsTotal.WithLabelValues(c.backend, "hit").Inc()
+			return resp, nil
+		}
+
+		metrics.MetadataCacheRequestsTotal.WithLabelValues(c.backend, "stale").Inc()
+		c.refresh(context.WithoutCancel(ctx), cluster, key, fullKey, fetch)
+		return resp, nil
+	}
+
+	metrics.MetadataCacheRequestsTotal.WithLabelValues(c.backend, "miss").Inc()
+	resp, err := fetch(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+	c.store(fullKey, resp)
+	return resp, nil
+}
+
+// Invalidate drops all entries of the given cluster. Entries are not removed
+// from the underlying cache, but become unreachable and age out.
+func (c *MetadataCache) Invalidate(cluster string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[cluster]++
+}
+
+// refresh fetches the entry in the background, unless a refresh of the same
+// entry is already running.
+func (c *MetadataCache) refresh(ctx context.Context, cluster, key, fullKey string, fetch MetadataFetchFunc) {
+	c.mu.Lock()
+	if c.refreshing[fullKey] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[fullKey] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, fullKey)
+			c.mu.Unlock()
+		}()
+
+		resp, err := fetch(ctx)
+		if err != nil {
+			log.Debug().Err(err).Str("backend", c.backend).Str("cluster", cluster).Msg("metadata cache refresh failed")
+			return
+		}
+		// Don't resurrect an entry invalidated during the refresh
+		if c.fullKey(cluster, key) == fullKey {
+			c.store(fullKey, resp)
+		}
+	}()
+}
+
+func (c *MetadataCache) store(fullKey string, resp Response) {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return
+	}
+
+	data := make([]byte, 8+len(resp.Body))
+	binary.BigEndian.PutUint64(data, uint64(c.now().UnixNano()))
+	copy(data[8:], resp.Body)
+	c.cache.Set(fullKey, data, c.ttl+c.staleTTL)
+}
+
+func (c *MetadataCache) fullKey(cluster, key string) string {
+	c.mu.Lock()
+	generation := c.generations[cluster]
+	c.mu.Unlock()
+	return fmt.Sprintf("metadata:%s:%s:%d:%s", c.backend, cluster, generation, key)
+}
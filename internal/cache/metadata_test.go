@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestMetadataCache(t *testing.T, now *time.Time) *MetadataCache {
+	t.Helper()
+	lru := NewLRU("test", 1<<20)
+	lru.now = func() time.Time { return *now }
+	c, err := NewMetadataCache(MetadataCacheConfig{Cache: lru, Backend: "test"})
+	if err != nil {
+		t.Fatalf("failed to create metadata cache: %v", err)
+	}
+	c.now = lru.now
+	return c
+}
+
+// countingFetch returns a fetch function answering with the number of calls
+// made so far.
+func countingFetch(calls *atomic.Int32, status int) MetadataFetchFunc {
+	return func(context.Context) (Response, error) {
+		n := calls.Add(1)
+		return Response{StatusCode: status, Body: []byte{byte('0' + n)}}, nil
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMetadataCache_StaleWhileRevalidate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newTestMetadataCache(t, &now)
+	ctx := context.Background()
+	var calls atomic.Int32
+	fetch := countingFetch(&calls, http.StatusOK)
+
+	resp, err := c.Do(ctx, "prod", "k", fetch)
+	if err != nil || string(resp.Body) != "1" {
+		t.Fatalf("expected upstream response on miss, got %q (%v)", resp.Body, err)
+	}
+
+	// Fresh entries are served from the cache
+	now = now.Add(30 * time.Second)
+	resp, _ = c.Do(ctx, "prod", "k", fetch)
+	if string(resp.Body) != "1" || calls.Load() != 1 {
+		t.Errorf("expected cache hit, got %q after %d calls", resp.Body, calls.Load())
+	}
+
+	// Expired entries are served immediately and refreshed in the background
+	now = now.Add(time.Minute)
+	resp, _ = c.Do(ctx, "prod", "k", fetch)
+	if string(resp.Body) != "1" {
+		t.Errorf("expected stale response, got %q", resp.Body)
+	}
+	waitFor(t, func() bool {
+		resp, _ := c.Do(ctx, "prod", "k", func(context.Context) (Response, error) {
+			return Response{}, nil
+		})
+		return string(resp.Body) == "2"
+	})
+	if calls.Load() != 2 {
+		t.Errorf("expected a single refresh, got %d calls", calls.Load())
+	}
+
+	// Entries past the stale TTL are fetched again
+	now = now.Add(time.Hour)
+	resp, _ = c.Do(ctx, "prod", "k", fetch)
+	if string(resp.Body) != "3" {
+		t.Errorf("expected upstream response after stale TTL, got %q", resp.Body)
+	}
+}
+
+func TestMetadataCache_ErrorsNotCached(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newTestMetadataCache(t, &now)
+	var calls atomic.Int32
+	fetch := countingFetch(&calls, http.StatusBadGateway)
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Do(context.Background(), "prod", "k", fetch)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("expected upstream status, got %d", resp.StatusCode)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected error responses not to be cached, got %d calls", calls.Load())
+	}
+}
+
+func TestMetadataCache_Invalidate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newTestMetadataCache(t, &now)
+	ctx := context.Background()
+	var calls atomic.Int32
+	fetch := countingFetch(&calls, http.StatusOK)
+
+	c.Do(ctx, "prod", "k", fetch)
+	c.Do(ctx, "staging", "k", fetch)
+
+	c.Invalidate("prod")
+
+	if resp, _ := c.Do(ctx, "prod", "k", fetch); string(resp.Body) != "3" {
+		t.Errorf("expected invalidated entry to be fetched again, got %q", resp.Body)
+	}
+	if resp, _ := c.Do(ctx, "staging", "k", fetch); string(resp.Body) != "2" {
+		t.Errorf("expected other clusters to be unaffected, got %q", resp.Body)
+	}
+}
+
+func TestMetadataCache_Key(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newTestMetadataCache(t, &now)
+
+	base := c.Key("/api/v1/labels", "team-a", url.Values{
+		"match[]": {`up`, `{job="api"}`},
+		"start":   {"1700000000"},
+		"end":     {"1700003600"},
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		orgID  string
+		params url.Values
+		same   bool
+	}{
+		{
+			name:   "same window within granularity and reordered selectors",
+			path:   "/api/v1/labels",
+			orgID:  "team-a",
+			params: url.Values{"match[]": {`{job="api"}`, `up`}, "start": {"1700000010"}, "end": {"2023-11-14T23:13:30Z"}},
+			same:   true,
+		},
+		{
+			name:   "different tenant set",
+			path:   "/api/v1/labels",
+			orgID:  "team-a|team-b",
+			params: url.Values{"match[]": {`up`, `{job="api"}`}, "start": {"1700000000"}, "end": {"1700003600"}},
+		},
+		{
+			name:   "different path",
+			path:   "/api/v1/label/job/values",
+			orgID:  "team-a",
+			params: url.Values{"match[]": {`up`, `{job="api"}`}, "start": {"1700000000"}, "end": {"1700003600"}},
+		},
+		{
+			name:   "different selectors",
+			path:   "/api/v1/labels",
+			orgID:  "team-a",
+			params: url.Values{"match[]": {`up`}, "start": {"1700000000"}, "end": {"1700003600"}},
+		},
+		{
+			name:   "different window",
+			path:   "/api/v1/labels",
+			orgID:  "team-a",
+			params: url.Values{"match[]": {`up`, `{job="api"}`}, "start": {"1699990000"}, "end": {"1700003600"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.Key(tt.path, tt.orgID, tt.params)
+			if (got == base) != tt.same {
+				t.Errorf("expected same key = %v", tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,523 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tjorri/observability-federation-proxy/internal/limits"
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// RangeQuery identifies a range query for the results cache.
+type RangeQuery struct {
+	// Key identifies everything but the time range, see Key.
+	Key   string
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+// ParseRangeQuery builds a RangeQuery from the start, end and step request
+// parameters. It fails if the step is missing, as the backend would pick one
+// that cannot be known in advance.
+func ParseRangeQuery(key string, params url.Values) (RangeQuery, error) {
+	start, err := limits.ParseTime(params.Get("start"))
+	if err != nil {
+		return RangeQuery{}, fmt.Errorf("invalid start: %w", err)
+	}
+	end, err := limits.ParseTime(params.Get("end"))
+	if err != nil {
+		return RangeQuery{}, fmt.Errorf("invalid end: %w", err)
+	}
+	if params.Get("step") == "" {
+		return RangeQuery{}, fmt.Errorf("missing step")
+	}
+	step, err := limits.ParseDuration(params.Get("step"))
+	if err != nil {
+		return RangeQuery{}, fmt.Errorf("invalid step: %w", err)
+	}
+	if step < time.Millisecond || step%time.Millisecond != 0 {
+		return RangeQuery{}, fmt.Errorf("step must be a positive whole number of milliseconds")
+	}
+
+	return RangeQuery{Key: key, Start: start, End: end, Step: step}, nil
+}
+
+// Splittable reports whether a PromQL query can be answered from extents
+// fetched separately. The @ start() and @ end() modifiers resolve against the
+// bounds of each upstream request rather than those of the client's query, so
+// queries using them are not.
+func Splittable(expr parser.Expr) bool {
+	splittable := true
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			if n.StartOrEnd != 0 {
+				splittable = false
+			}
+		case *parser.SubqueryExpr:
+			if n.StartOrEnd != 0 {
+				splittable = false
+			}
+		}
+		return nil
+	})
+	return splittable
+}
+
+// SplittableLogQL is Splittable for LogQL queries, which are not parsed.
+// Queries with an @ outside string literals are treated as not splittable.
+func SplittableLogQL(query string) bool {
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '"', '`':
+			// Skip the string literal; backtick strings have no escapes
+			for i++; i < len(query) && query[i] != c; i++ {
+				if c == '"' && query[i] == '\\' {
+					i++
+				}
+			}
+		case '@':
+			return false
+		}
+	}
+	return true
+}
+
+// Key builds a results cache key from the cluster, tenant header, normalized
+// query and any parameters other than start and end.
+func Key(cluster, orgID, query string, params url.Values) string {
+	extra := make(url.Values, len(params))
+	for name, values := range params {
+		switch name {
+		case "query", "start", "end":
+			continue
+		}
+		extra[name] = values
+	}
+
+	h := sha256.New()
+	for _, part := range []string{cluster, orgID, query, extra.Encode()} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return "results:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Response is a raw upstream response.
+type Response struct {
+	StatusCode int
+	Body       []byte
+}
+
+// FetchFunc executes a range query upstream for the given time range.
+type FetchFunc func(ctx context.Context, start, end time.Time) (Response, error)
+
+// ResultsCacheConfig holds configuration for creating a results cache.
+type ResultsCacheConfig struct {
+	// Cache stores the extents.
+	Cache Cache
+	// Backend separates the keys of backends sharing a cache, and is used as
+	// the backend label in metrics.
+	Backend string
+	// MaxFreshness is the age below which results are never cached, as
+	// recent samples may still be changing. Defaults to 10 minutes.
+	MaxFreshness time.Duration
+	// TTL is the lifetime of cached extents. Defaults to 24 hours.
+	TTL time.Duration
+}
+
+// ResultsCache answers range queries from cached step-aligned extents and
+// only fetches the missing time ranges upstream. Requests are aligned to
+// their step, so that the sample timestamps of overlapping queries line up.
+type ResultsCache struct {
+	cache        Cache
+	backend      string
+	maxFreshness time.Duration
+	ttl          time.Duration
+	now          func() time.Time
+}
+
+// NewResultsCache creates a new results cache.
+func NewResultsCache(cfg ResultsCacheConfig) (*ResultsCache, error) {
+	if cfg.Cache == nil {
+		return nil, fmt.Errorf("cache is required")
+	}
+
+	maxFreshness := cfg.MaxFreshness
+	if maxFreshness == 0 {
+		maxFreshness = 10 * time.Minute
+	}
+	ttl := cfg.TTL
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+
+	return &ResultsCache{
+		cache:        cfg.Cache,
+		backend:      cfg.Backend,
+		maxFreshness: maxFreshness,
+		ttl:          ttl,
+		now:          time.Now,
+	}, nil
+}
+
+// Do answers the range query, fetching only the parts that are not cached.
+// Non-2xx upstream responses are returned as-is. Responses that are not
+// successful matrix results are not cached, and the full query is fetched
+// upstream instead.
+func (c *ResultsCache) Do(ctx context.Context, q RangeQuery, fetch FetchFunc) (Response, error) {
+	step := q.Step.Milliseconds()
+	start := alignDown(q.Start.UnixMilli(), step)
+	end := alignDown(q.End.UnixMilli(), step)
+	if end < start {
+		c.record("uncacheable")
+		return fetch(ctx, q.Start, q.End)
+	}
+
+	key := c.backend + ":" + q.Key
+	cached := c.load(key)
+	gaps := missing(cached, start, end, step)
+
+	fetched := make([]extent, 0, len(gaps))
+	for _, gap := range gaps {
+		resp, err := fetch(ctx, fromMillis(gap.start), fromMillis(gap.end))
+		if err != nil {
+			return Response{}, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			c.record("uncacheable")
+			return resp, nil
+		}
+
+		ext, ok := parseExtent(resp.Body, gap.start, gap.end)
+		if !ok {
+			c.record("uncacheable")
+			if len(gaps) == 1 && gap.start == start && gap.end == end {
+				return resp, nil
+			}
+			return fetch(ctx, q.Start, q.End)
+		}
+		fetched = append(fetched, ext)
+	}
+
+	switch {
+	case len(gaps) == 0:
+		c.record("hit")
+	case len(cached) == 0:
+		c.record("miss")
+	default:
+		c.record("partial")
+	}
+
+	all := mergeExtents(append(cached, fetched...), step)
+
+	if len(fetched) > 0 {
+		// Only keep data from the start of this query up to the freshness
+		// cutoff, so that sliding dashboard windows do not grow the entry.
+		cutoff := alignDown(c.now().Add(-c.maxFreshness).UnixMilli(), step)
+		c.store(key, trimExtents(all, start, cutoff))
+	}
+
+	body, err := render(all, start, end)
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{StatusCode: 200, Body: body}, nil
+}
+
+func (c *ResultsCache) record(result string) {
+	metrics.ResultsCacheRequestsTotal.WithLabelValues(c.backend, result).Inc()
+}
+
+func (c *ResultsCache) load(key string) []extent {
+	data, ok := c.cache.Get(key)
+	if !ok {
+		return nil
+	}
+
+	var extents []extent
+	if err := json.Unmarshal(data, &extents); err != nil {
+		log.Warn().Err(err).Msg("discarding corrupt results cache entry")
+		c.cache.Delete(key)
+		return nil
+	}
+	return extents
+}
+
+func (c *ResultsCache) store(key string, extents []extent) {
+	if len(extents) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(extents)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to encode results cache entry")
+		return
+	}
+	c.cache.Set(key, data, c.ttl)
+}
+
+// extent holds the series of a query for an inclusive, step-aligned time range.
+type extent struct {
+	Start  int64    `json:"start"`
+	End    int64    `json:"end"`
+	Series []series `json:"series"`
+}
+
+// series is a single matrix result. Samples are kept in their raw JSON form.
+type series struct {
+	Metric     map[string]string `json:"metric"`
+	Values     []sample          `json:"values,omitempty"`
+	Histograms []sample          `json:"histograms,omitempty"`
+}
+
+func (s series) key() string {
+	names := make([]string, 0, len(s.Metric))
+	for name := range s.Metric {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0)
+		b.WriteString(s.Metric[name])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// sample is a raw [timestamp, value] pair with its timestamp in milliseconds.
+type sample struct {
+	t   int64
+	raw json.RawMessage
+}
+
+// UnmarshalJSON decodes a [timestamp, value] pair.
+func (s *sample) UnmarshalJSON(data []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("expected [timestamp, value] pair, got %d elements", len(pair))
+	}
+	var ts float64
+	if err := json.Unmarshal(pair[0], &ts); err != nil {
+		return fmt.Errorf("invalid sample timestamp: %w", err)
+	}
+
+	s.t = int64(math.Round(ts * 1000))
+	s.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// MarshalJSON returns the raw pair.
+func (s sample) MarshalJSON() ([]byte, error) {
+	return s.raw, nil
+}
+
+type timeRange struct {
+	start int64
+	end   int64
+}
+
+// missing returns the parts of [start, end] not covered by the given sorted,
+// non-overlapping extents.
+func missing(extents []extent, start, end, step int64) []timeRange {
+	var gaps []timeRange
+	cur := start
+	for _, ext := range extents {
+		if ext.End < cur {
+			continue
+		}
+		if ext.Start > end {
+			break
+		}
+		if ext.Start > cur {
+			gaps = append(gaps, timeRange{start: cur, end: min(ext.Start-step, end)})
+		}
+		cur = ext.End + step
+	}
+	if cur <= end {
+		gaps = append(gaps, timeRange{start: cur, end: end})
+	}
+	return gaps
+}
+
+// parseExtent decodes a successful matrix response without warnings.
+func parseExtent(body []byte, start, end int64) (extent, bool) {
+	var resp struct {
+		Status string `json:"status"`
+		Data   struct {
+			ResultType string   `json:"resultType"`
+			Result     []series `json:"result"`
+		} `json:"data"`
+		Warnings []string `json:"warnings"`
+		Infos    []string `json:"infos"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return extent{}, false
+	}
+	if resp.Status != "success" || resp.Data.ResultType != "matrix" || len(resp.Warnings) > 0 || len(resp.Infos) > 0 {
+		return extent{}, false
+	}
+	return extent{Start: start, End: end, Series: resp.Data.Result}, true
+}
+
+// mergeExtents sorts extents and coalesces those that overlap or touch.
+// Where extents overlap, the later one in the input wins.
+func mergeExtents(extents []extent, step int64) []extent {
+	if len(extents) == 0 {
+		return nil
+	}
+
+	sorted := make([]extent, len(extents))
+	copy(sorted, extents)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	merged := []extent{sorted[0]}
+	for _, next := range sorted[1:] {
+		cur := &merged[len(merged)-1]
+		if next.Start > cur.End+step {
+			merged = append(merged, next)
+			continue
+		}
+		cur.Series = mergeSeries(cur.Series, next.Series, next.Start, next.End)
+		cur.End = max(cur.End, next.End)
+	}
+	return merged
+}
+
+// mergeSeries replaces the samples of a within [bStart, bEnd] with those of b.
+func mergeSeries(a, b []series, bStart, bEnd int64) []series {
+	index := make(map[string]int, len(a))
+	out := make([]series, 0, len(a)+len(b))
+	for _, s := range a {
+		s.Values = spliceSamples(s.Values, nil, bStart, bEnd)
+		s.Histograms = spliceSamples(s.Histograms, nil, bStart, bEnd)
+		index[s.key()] = len(out)
+		out = append(out, s)
+	}
+
+	for _, s := range b {
+		i, ok := index[s.key()]
+		if !ok {
+			index[s.key()] = len(out)
+			out = append(out, s)
+			continue
+		}
+		out[i].Values = spliceSamples(out[i].Values, s.Values, bStart, bEnd)
+		out[i].Histograms = spliceSamples(out[i].Histograms, s.Histograms, bStart, bEnd)
+	}
+
+	return out
+}
+
+// spliceSamples inserts b into a, dropping the samples of a within [bStart, bEnd].
+func spliceSamples(a, b []sample, bStart, bEnd int64) []sample {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	out := make([]sample, 0, len(a)+len(b))
+	for _, s := range a {
+		if s.t < bStart {
+			out = append(out, s)
+		}
+	}
+	out = append(out, b...)
+	for _, s := range a {
+		if s.t > bEnd {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// trimExtents restricts extents to [from, to], dropping empty series and extents.
+func trimExtents(extents []extent, from, to int64) []extent {
+	var out []extent
+	for _, ext := range extents {
+		if ext.End < from || ext.Start > to {
+			continue
+		}
+		trimmed := extent{Start: max(ext.Start, from), End: min(ext.End, to)}
+		trimmed.Series = trimSeries(ext.Series, trimmed.Start, trimmed.End)
+		out = append(out, trimmed)
+	}
+	return out
+}
+
+func trimSeries(in []series, from, to int64) []series {
+	out := make([]series, 0, len(in))
+	for _, s := range in {
+		s.Values = trimSamples(s.Values, from, to)
+		s.Histograms = trimSamples(s.Histograms, from, to)
+		if len(s.Values) > 0 || len(s.Histograms) > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func trimSamples(in []sample, from, to int64) []sample {
+	var out []sample
+	for _, s := range in {
+		if s.t >= from && s.t <= to {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// render builds a matrix response for [start, end] from the merged extents.
+func render(extents []extent, start, end int64) ([]byte, error) {
+	result := make([]series, 0)
+	for _, ext := range trimExtents(extents, start, end) {
+		result = mergeSeries(result, ext.Series, ext.Start, ext.End)
+	}
+
+	type data struct {
+		ResultType string   `json:"resultType"`
+		Result     []series `json:"result"`
+	}
+	return json.Marshal(struct {
+		Status string `json:"status"`
+		Data   data   `json:"data"`
+	}{
+		Status: "success",
+		Data:   data{ResultType: "matrix", Result: result},
+	})
+}
+
+// FormatTime formats t as Unix seconds with millisecond precision, which both
+// Prometheus and Loki accept for start and end.
+func FormatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
+
+func alignDown(t, step int64) int64 {
+	aligned := t / step * step
+	if t < 0 && aligned != t {
+		aligned -= step
+	}
+	return aligned
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms)
+}
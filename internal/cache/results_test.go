@@ -0,0 +1,334 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// matrixUpstream serves a matrix with one sample per step for a single series,
+// whose value is the sample timestamp in seconds.
+type matrixUpstream struct {
+	step  int64
+	calls []timeRange
+}
+
+func (u *matrixUpstream) fetch(_ context.Context, start, end time.Time) (Response, error) {
+	from, to := start.UnixMilli(), end.UnixMilli()
+	u.calls = append(u.calls, timeRange{start: from, end: to})
+
+	var values []string
+	for t := from; t <= to; t += u.step {
+		values = append(values, fmt.Sprintf(`[%d,"%d"]`, t/1000, t/1000))
+	}
+	body := `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"api"},"values":[` +
+		strings.Join(values, ",") + `]}]}}`
+	return Response{StatusCode: http.StatusOK, Body: []byte(body)}, nil
+}
+
+func newTestResultsCache(t *testing.T, now time.Time) *ResultsCache {
+	t.Helper()
+	c, err := NewResultsCache(ResultsCacheConfig{Cache: NewLRU("test", 1<<20), Backend: "test"})
+	if err != nil {
+		t.Fatalf("failed to create results cache: %v", err)
+	}
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func decodeTimestamps(t *testing.T, body []byte) []int64 {
+	t.Helper()
+	var resp struct {
+		Status string `json:"status"`
+		Data   struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Values [][2]json.Number `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Status != "success" || resp.Data.ResultType != "matrix" {
+		t.Fatalf("unexpected response: %s", body)
+	}
+	if len(resp.Data.Result) != 1 {
+		t.Fatalf("expected 1 series, got %d", len(resp.Data.Result))
+	}
+
+	var ts []int64
+	for _, v := range resp.Data.Result[0].Values {
+		n, _ := v[0].Int64()
+		ts = append(ts, n)
+	}
+	return ts
+}
+
+func TestResultsCache_Do(t *testing.T) {
+	now := time.Unix(1700100000, 0)
+	c := newTestResultsCache(t, now)
+	upstream := &matrixUpstream{step: 60000}
+	ctx := context.Background()
+
+	// First query over an old range is fetched in full and cached
+	q := RangeQuery{Key: "k", Start: time.Unix(1700000000, 0), End: time.Unix(1700003600, 0), Step: time.Minute}
+	resp, err := c.Do(ctx, q, upstream.fetch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ts := decodeTimestamps(t, resp.Body)
+	// Start and end are aligned down to the step
+	if ts[0] != 1699999980 || ts[len(ts)-1] != 1700003580 || len(ts) != 61 {
+		t.Errorf("unexpected timestamps: first=%d last=%d count=%d", ts[0], ts[len(ts)-1], len(ts))
+	}
+	if len(upstream.calls) != 1 {
+		t.Fatalf("expected 1 upstream call, got %d", len(upstream.calls))
+	}
+
+	// The same query is served from the cache
+	if _, err := c.Do(ctx, q, upstream.fetch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(upstream.calls) != 1 {
+		t.Errorf("expected cache hit, got %d upstream calls", len(upstream.calls))
+	}
+
+	// A window shifted by 30 minutes only fetches the new slice
+	q.Start = q.Start.Add(30 * time.Minute)
+	q.End = q.End.Add(30 * time.Minute)
+	resp, err = c.Do(ctx, q, upstream.fetch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(upstream.calls) != 2 {
+		t.Fatalf("expected 2 upstream calls, got %d", len(upstream.calls))
+	}
+	last := upstream.calls[1]
+	if last.start != 1700003640000 || last.end != 1700005380000 {
+		t.Errorf("expected only the missing slice to be fetched, got %+v", last)
+	}
+	ts = decodeTimestamps(t, resp.Body)
+	if ts[0] != 1700001780 || ts[len(ts)-1] != 1700005380 || len(ts) != 61 {
+		t.Errorf("unexpected merged timestamps: first=%d last=%d count=%d", ts[0], ts[len(ts)-1], len(ts))
+	}
+	for i := 1; i < len(ts); i++ {
+		if ts[i]-ts[i-1] != 60 {
+			t.Fatalf("expected contiguous samples, got gap between %d and %d", ts[i-1], ts[i])
+		}
+	}
+}
+
+func TestResultsCache_Freshness(t *testing.T) {
+	now := time.Unix(1700003640, 0)
+	c := newTestResultsCache(t, now)
+	upstream := &matrixUpstream{step: 60000}
+	ctx := context.Background()
+
+	q := RangeQuery{Key: "k", Start: time.Unix(1699999980, 0), End: now, Step: time.Minute}
+	if _, err := c.Do(ctx, q, upstream.fetch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.Do(ctx, q, upstream.fetch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(upstream.calls) != 2 {
+		t.Fatalf("expected 2 upstream calls, got %d", len(upstream.calls))
+	}
+	// The last 10 minutes are never cached
+	fresh := upstream.calls[1]
+	if fresh.start != now.Add(-9*time.Minute).UnixMilli() || fresh.end != now.UnixMilli() {
+		t.Errorf("expected only the fresh window to be refetched, got %+v", fresh)
+	}
+}
+
+func TestResultsCache_Uncacheable(t *testing.T) {
+	c := newTestResultsCache(t, time.Unix(1700100000, 0))
+	ctx := context.Background()
+	q := RangeQuery{Key: "k", Start: time.Unix(1700000000, 0), End: time.Unix(1700003600, 0), Step: time.Minute}
+
+	tests := []struct {
+		name string
+		resp Response
+	}{
+		{
+			name: "error status",
+			resp: Response{StatusCode: http.StatusBadRequest, Body: []byte(`{"status":"error","errorType":"bad_data"}`)},
+		},
+		{
+			name: "streams result",
+			resp: Response{StatusCode: http.StatusOK, Body: []byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`)},
+		},
+		{
+			name: "warnings",
+			resp: Response{StatusCode: http.StatusOK, Body: []byte(`{"status":"success","data":{"resultType":"matrix","result":[]},"warnings":["partial"]}`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			fetch := func(context.Context, time.Time, time.Time) (Response, error) {
+				calls++
+				return tt.resp, nil
+			}
+
+			for i := 0; i < 2; i++ {
+				resp, err := c.Do(ctx, q, fetch)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if resp.StatusCode != tt.resp.StatusCode || string(resp.Body) != string(tt.resp.Body) {
+					t.Errorf("expected upstream response to be returned as-is, got %d %s", resp.StatusCode, resp.Body)
+				}
+			}
+			if calls != 2 {
+				t.Errorf("expected response not to be cached, got %d calls", calls)
+			}
+		})
+	}
+}
+
+func TestMergeExtents(t *testing.T) {
+	s := func(ts ...int64) []sample {
+		out := make([]sample, 0, len(ts))
+		for _, t := range ts {
+			out = append(out, sample{t: t, raw: json.RawMessage(fmt.Sprintf(`[%d,"%d"]`, t, t))})
+		}
+		return out
+	}
+
+	a := extent{Start: 0, End: 20, Series: []series{
+		{Metric: map[string]string{"job": "a"}, Values: s(0, 10, 20)},
+		{Metric: map[string]string{"job": "gone"}, Values: s(20)},
+	}}
+	b := extent{Start: 20, End: 40, Series: []series{
+		{Metric: map[string]string{"job": "a"}, Values: s(20, 30, 40)},
+		{Metric: map[string]string{"job": "b"}, Values: s(40)},
+	}}
+	c := extent{Start: 100, End: 110}
+
+	merged := mergeExtents([]extent{c, a, b}, 10)
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 extents, got %d", len(merged))
+	}
+	if merged[0].Start != 0 || merged[0].End != 40 {
+		t.Errorf("expected first extent [0, 40], got [%d, %d]", merged[0].Start, merged[0].End)
+	}
+
+	got := map[string][]int64{}
+	for _, series := range merged[0].Series {
+		for _, v := range series.Values {
+			got[series.Metric["job"]] = append(got[series.Metric["job"]], v.t)
+		}
+	}
+	if fmt.Sprint(got["a"]) != "[0 10 20 30 40]" {
+		t.Errorf("unexpected samples for a: %v", got["a"])
+	}
+	if len(got["gone"]) != 0 {
+		t.Errorf("expected samples of series absent from newer extent to be dropped, got %v", got["gone"])
+	}
+	if fmt.Sprint(got["b"]) != "[40]" {
+		t.Errorf("unexpected samples for b: %v", got["b"])
+	}
+}
+
+func TestParseRangeQuery(t *testing.T) {
+	q, err := ParseRangeQuery("k", url.Values{"start": {"1700000000"}, "end": {"1700003600"}, "step": {"15s"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.Step != 15*time.Second || !q.Start.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected range query: %+v", q)
+	}
+
+	if _, err := ParseRangeQuery("k", url.Values{"start": {"1700000000"}, "end": {"1700003600"}}); err == nil {
+		t.Error("expected error without step")
+	}
+}
+
+func TestKey(t *testing.T) {
+	base := Key("prod", "team-a", "up", url.Values{"query": {"up"}, "start": {"1"}, "end": {"2"}, "step": {"15"}})
+
+	if other := Key("prod", "team-a", "up", url.Values{"start": {"100"}, "end": {"200"}, "step": {"15"}}); other != base {
+		t.Error("expected key to ignore start and end")
+	}
+	if other := Key("prod", "team-b", "up", url.Values{"step": {"15"}}); other == base {
+		t.Error("expected key to include the tenant header")
+	}
+	if other := Key("prod", "team-a", "up", url.Values{"step": {"30"}}); other == base {
+		t.Error("expected key to include the step")
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	tests := []struct {
+		input    time.Time
+		expected string
+	}{
+		{time.Unix(1700000000, 0), "1700000000"},
+		{time.UnixMilli(1700000000500), "1700000000.5"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatTime(tt.input); got != tt.expected {
+			t.Errorf("FormatTime(%v) = %s, expected %s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestSplittable(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{`sum(rate(http_requests_total[5m]))`, true},
+		{`http_requests_total @ 1700000000`, true},
+		{`http_requests_total @ start()`, false},
+		{`sum(rate(http_requests_total[5m] @ end()))`, false},
+		{`max_over_time(rate(http_requests_total[5m])[1h:1m] @ start())`, false},
+		{`http_requests_total / ignoring(job) (up @ end())`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.query)
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+			if got := Splittable(expr); got != tt.expected {
+				t.Errorf("Splittable(%s) = %v, expected %v", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSplittableLogQL(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{`sum(count_over_time({app="api"}[5m]))`, true},
+		{`sum(count_over_time({app="api"} |= "user@example.com" [5m]))`, true},
+		{"sum(count_over_time({app=\"api\"} |~ `\\\\@` [5m]))", true},
+		{`sum(count_over_time({app="a\"@"}[5m]))`, true},
+		{`sum(count_over_time({app="api"}[5m] @ end()))`, false},
+		{`sum(count_over_time({app="api"}[5m])) @ start()`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := SplittableLogQL(tt.query); got != tt.expected {
+				t.Errorf("SplittableLogQL(%s) = %v, expected %v", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package cluster
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -16,12 +17,18 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/aws/smithy-go/middleware"
 	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	"github.com/tjorri/observability-federation-proxy/internal/config"
 )
 
+var tracer = otel.Tracer("github.com/tjorri/observability-federation-proxy/internal/cluster")
+
 // eksRESTConfig wraps rest.Config to implement RESTConfig interface.
 type eksRESTConfig struct {
 	*rest.Config
@@ -31,6 +38,10 @@ func (c *eksRESTConfig) Host() string {
 	return c.Config.Host
 }
 
+func (c *eksRESTConfig) Copy() *rest.Config {
+	return rest.CopyConfig(c.Config)
+}
+
 func (r *Registry) createEKSCluster(ctx context.Context, cfg config.ClusterConfig) (*Cluster, error) {
 	if cfg.EKS == nil {
 		return nil, fmt.Errorf("eks config is required for eks cluster type")
@@ -107,6 +118,10 @@ func (r *Registry) createEKSCluster(ctx context.Context, cfg config.ClusterConfi
 	}, nil
 }
 
+// ErrCredentials is wrapped by errors of requests that failed because no
+// credentials for the cluster could be obtained.
+var ErrCredentials = errors.New("failed to get cluster credentials")
+
 // eksTokenTransport adds EKS token authentication to HTTP requests.
 type eksTokenTransport struct {
 	base        http.RoundTripper
@@ -118,9 +133,9 @@ type eksTokenTransport struct {
 }
 
 func (t *eksTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	token, err := t.getToken()
+	token, err := t.getToken(req.Context())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrCredentials, err)
 	}
 
 	req = req.Clone(req.Context())
@@ -128,7 +143,7 @@ func (t *eksTokenTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	return t.base.RoundTrip(req)
 }
 
-func (t *eksTokenTransport) getToken() (string, error) {
+func (t *eksTokenTransport) getToken(ctx context.Context) (string, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -139,8 +154,11 @@ func (t *eksTokenTransport) getToken() (string, error) {
 	}
 
 	// Generate new token
-	token, err := t.generateToken()
+	ctx, span := tracer.Start(ctx, "eks token", trace.WithAttributes(attribute.String("eks.cluster", t.clusterName)))
+	defer span.End()
+	token, err := t.generateToken(ctx)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		return "", err
 	}
 
@@ -150,14 +168,14 @@ func (t *eksTokenTransport) getToken() (string, error) {
 	return t.token, nil
 }
 
-func (t *eksTokenTransport) generateToken() (string, error) {
+func (t *eksTokenTransport) generateToken(ctx context.Context) (string, error) {
 	presignClient := sts.NewPresignClient(t.stsClient)
 
 	// Token expiry in seconds (matches AWS CLI behavior)
 	const tokenExpiry = 60
 
 	// Create presigned GetCallerIdentity request with cluster name header and expiry
-	presignedReq, err := presignClient.PresignGetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{}, func(opt *sts.PresignOptions) {
+	presignedReq, err := presignClient.PresignGetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}, func(opt *sts.PresignOptions) {
 		opt.ClientOptions = append(opt.ClientOptions, func(o *sts.Options) {
 			// Add the x-k8s-aws-id header (required by EKS)
 			o.APIOptions = append(o.APIOptions, smithyhttp.AddHeaderValue("x-k8s-aws-id", t.clusterName))
@@ -21,6 +21,10 @@ func (c *kubeconfigRESTConfig) Host() string {
 	return c.Config.Host
 }
 
+func (c *kubeconfigRESTConfig) Copy() *rest.Config {
+	return rest.CopyConfig(c.Config)
+}
+
 func (r *Registry) createKubeconfigCluster(cfg config.ClusterConfig) (*Cluster, error) {
 	if cfg.Kubeconfig == nil {
 		return nil, fmt.Errorf("kubeconfig config is required for kubeconfig cluster type")
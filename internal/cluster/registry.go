@@ -7,6 +7,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
 	"github.com/tjorri/observability-federation-proxy/internal/config"
 )
@@ -28,6 +29,17 @@ type Cluster struct {
 // RESTConfig abstracts the REST config for testing.
 type RESTConfig interface {
 	Host() string
+	// Copy returns a copy of the underlying REST config.
+	Copy() *rest.Config
+}
+
+// RESTConfig returns a copy of the REST config used to connect to the
+// cluster, for building clients with their own rate limits and transport.
+func (c *Cluster) RESTConfig() *rest.Config {
+	if c.restConfig == nil {
+		return nil
+	}
+	return c.restConfig.Copy()
 }
 
 // NewRegistry creates a new cluster registry from configuration.
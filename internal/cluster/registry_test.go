@@ -141,6 +141,13 @@ users:
 	if cluster.restConfig.Host() != "https://localhost:6443" {
 		t.Errorf("expected host https://localhost:6443, got %s", cluster.restConfig.Host())
 	}
+
+	// RESTConfig returns an independent copy
+	restCfg := cluster.RESTConfig()
+	restCfg.QPS = 100
+	if cluster.RESTConfig().QPS == 100 {
+		t.Error("expected RESTConfig to return a copy")
+	}
 }
 
 func TestCreateKubeconfigCluster_FromData(t *testing.T) {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -14,6 +15,7 @@ import (
 	"github.com/tjorri/observability-federation-proxy/internal/config"
 	"github.com/tjorri/observability-federation-proxy/internal/server"
 	"github.com/tjorri/observability-federation-proxy/internal/tenant"
+	"github.com/tjorri/observability-federation-proxy/internal/tracing"
 )
 
 var cfgFile string
@@ -41,6 +43,32 @@ Loki and Mimir endpoints in remote Kubernetes clusters via the Kubernetes API pr
 
 			ctx := context.Background()
 
+			if cfg.Tracing.Enabled {
+				shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+					Exporter:    cfg.Tracing.Exporter,
+					Endpoint:    cfg.Tracing.Endpoint,
+					Headers:     cfg.Tracing.Headers,
+					ServiceName: cfg.Tracing.ServiceName,
+					Version:     version,
+					SampleRatio: cfg.Tracing.SampleRatio,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to set up tracing: %w", err)
+				}
+				// Flush pending spans once the server has shut down
+				defer func() {
+					shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					if err := shutdownTracing(shutdownCtx); err != nil {
+						log.Error().Err(err).Msg("failed to flush traces")
+					}
+				}()
+				log.Info().
+					Str("exporter", cfg.Tracing.Exporter).
+					Float64("sample_ratio", cfg.Tracing.SampleRatio).
+					Msg("tracing enabled")
+			}
+
 			// Create cluster registry
 			var registry *cluster.Registry
 			if len(cfg.Clusters) > 0 {
@@ -60,13 +88,15 @@ Loki and Mimir endpoints in remote Kubernetes clusters via the Kubernetes API pr
 				if err != nil {
 					return fmt.Errorf("failed to create tenant registry: %w", err)
 				}
-				tenantRegistry.Start(ctx)
 				log.Info().
 					Strs("clusters", tenantRegistry.List()).
 					Msg("tenant registry initialized")
 			}
 
-			srv := server.New(cfg, registry, tenantRegistry)
+			srv, err := server.New(cfg, registry, tenantRegistry)
+			if err != nil {
+				return fmt.Errorf("failed to create server: %w", err)
+			}
 			return srv.Run()
 		},
 	}
@@ -108,6 +138,9 @@ func setupLogging(cfg config.LoggingConfig) {
 	if cfg.Format == "text" {
 		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	}
+
+	// Log through the global logger where no request logger is in the context
+	zerolog.DefaultContextLogger = &log.Logger
 }
 
 // Execute runs the root command with the given version string.
@@ -3,18 +3,32 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/spf13/viper"
 )
 
 // Config is the root configuration for the proxy.
 type Config struct {
-	Proxy    ProxyConfig     `mapstructure:"proxy"`
-	Auth     AuthConfig      `mapstructure:"auth"`
-	Logging  LoggingConfig   `mapstructure:"logging"`
-	Clusters []ClusterConfig `mapstructure:"clusters"`
+	Proxy          ProxyConfig          `mapstructure:"proxy"`
+	Auth           AuthConfig           `mapstructure:"auth"`
+	Logging        LoggingConfig        `mapstructure:"logging"`
+	Audit          AuditConfig          `mapstructure:"audit"`
+	SlowQueries    SlowQueriesConfig    `mapstructure:"slowQueries"`
+	Tracing        TracingConfig        `mapstructure:"tracing"`
+	Policies       PoliciesConfig       `mapstructure:"policies"`
+	Limits         LimitsConfig         `mapstructure:"limits"`
+	Concurrency    ConcurrencyConfig    `mapstructure:"concurrency"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuitBreaker"`
+	Cache          CacheConfig          `mapstructure:"cache"`
+	Health         HealthConfig         `mapstructure:"health"`
+	Probes         ProbesConfig         `mapstructure:"probes"`
+	Clusters       []ClusterConfig      `mapstructure:"clusters"`
 }
 
 // ProxyConfig contains HTTP server and proxy settings.
@@ -23,12 +37,54 @@ type ProxyConfig struct {
 	QueryTimeout          time.Duration `mapstructure:"queryTimeout"`
 	MaxTenantHeaderLength int           `mapstructure:"maxTenantHeaderLength"`
 	MetricsEnabled        bool          `mapstructure:"metricsEnabled"`
+	// CoalesceRequests shares one upstream call between identical
+	// concurrent requests.
+	CoalesceRequests bool `mapstructure:"coalesceRequests"`
+	// Client configures the dedicated API server client used for proxied
+	// traffic in each cluster.
+	Client UpstreamClientConfig `mapstructure:"client"`
+	// Retry retries and hedges read queries that failed transiently.
+	Retry RetryConfig `mapstructure:"retry"`
+}
+
+// RetryConfig configures retries of read queries with jittered exponential
+// backoff, limited by a retry budget, and optional hedging of slow queries.
+type RetryConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	MaxAttempts    int           `mapstructure:"maxAttempts"`
+	InitialBackoff time.Duration `mapstructure:"initialBackoff"`
+	MaxBackoff     time.Duration `mapstructure:"maxBackoff"`
+	// BudgetRatio is the share of requests that may be retried or hedged,
+	// on top of BudgetBurst retries that can be saved up.
+	BudgetRatio float64 `mapstructure:"budgetRatio"`
+	BudgetBurst int     `mapstructure:"budgetBurst"`
+	// HedgeAfter sends a duplicate of a query unanswered after this long.
+	// Zero disables hedging.
+	HedgeAfter time.Duration `mapstructure:"hedgeAfter"`
+}
+
+// UpstreamClientConfig contains the client-side rate limits and connection
+// pool settings for proxied traffic to each cluster's API server.
+type UpstreamClientConfig struct {
+	QPS                 float32       `mapstructure:"qps"`
+	Burst               int           `mapstructure:"burst"`
+	MaxIdleConnsPerHost int           `mapstructure:"maxIdleConnsPerHost"`
+	MaxConnsPerHost     int           `mapstructure:"maxConnsPerHost"`
+	IdleConnTimeout     time.Duration `mapstructure:"idleConnTimeout"`
 }
 
 // AuthConfig contains authentication settings.
 type AuthConfig struct {
-	Enabled      bool     `mapstructure:"enabled"`
-	BearerTokens []string `mapstructure:"bearerTokens"`
+	Enabled      bool             `mapstructure:"enabled"`
+	BearerTokens []string         `mapstructure:"bearerTokens"`
+	Identities   []IdentityConfig `mapstructure:"identities"`
+}
+
+// IdentityConfig maps a bearer token to a named caller identity.
+type IdentityConfig struct {
+	Name   string   `mapstructure:"name"`
+	Token  string   `mapstructure:"token"`
+	Groups []string `mapstructure:"groups"`
 }
 
 // LoggingConfig contains logging settings.
@@ -37,6 +93,270 @@ type LoggingConfig struct {
 	Format string `mapstructure:"format"`
 }
 
+// TracingConfig contains OpenTelemetry tracing settings.
+type TracingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Exporter is "otlp", "stdout" or "none". Spans are still created and
+	// propagated with "none", but not exported.
+	Exporter string `mapstructure:"exporter"`
+	// Endpoint is the OTLP/HTTP collector URL. If empty, the standard
+	// OTEL_EXPORTER_OTLP_* environment variables are used.
+	Endpoint    string            `mapstructure:"endpoint"`
+	Headers     map[string]string `mapstructure:"headers"`
+	ServiceName string            `mapstructure:"serviceName"`
+	// SampleRatio is the share of new traces that are sampled. Traces
+	// started by the caller follow the caller's sampling decision.
+	SampleRatio float64 `mapstructure:"sampleRatio"`
+}
+
+// AuditConfig contains audit logging settings.
+type AuditConfig struct {
+	Enabled bool                `mapstructure:"enabled"`
+	File    *AuditFileConfig    `mapstructure:"file,omitempty"`
+	Webhook *AuditWebhookConfig `mapstructure:"webhook,omitempty"`
+}
+
+// AuditFileConfig configures the rotating JSON-lines audit file sink.
+type AuditFileConfig struct {
+	Path       string `mapstructure:"path"`
+	MaxSizeMB  int    `mapstructure:"maxSizeMB"`
+	MaxBackups int    `mapstructure:"maxBackups"`
+}
+
+// AuditWebhookConfig configures the HTTP webhook audit sink.
+type AuditWebhookConfig struct {
+	URL           string            `mapstructure:"url"`
+	Headers       map[string]string `mapstructure:"headers"`
+	BatchSize     int               `mapstructure:"batchSize"`
+	QueueSize     int               `mapstructure:"queueSize"`
+	FlushInterval time.Duration     `mapstructure:"flushInterval"`
+	MaxRetries    int               `mapstructure:"maxRetries"`
+	Timeout       time.Duration     `mapstructure:"timeout"`
+}
+
+// HealthConfig contains settings of the background health checks of the
+// API server and the Loki and Mimir backends of each cluster.
+type HealthConfig struct {
+	Interval  time.Duration   `mapstructure:"interval"`
+	Timeout   time.Duration   `mapstructure:"timeout"`
+	Readiness ReadinessConfig `mapstructure:"readiness"`
+}
+
+// ReadinessConfig selects when /readyz reports the proxy as ready: "all"
+// clusters healthy, as soon as it has "started", at least "minHealthy"
+// clusters healthy, or all "critical" clusters healthy.
+type ReadinessConfig struct {
+	Policy             string   `mapstructure:"policy"`
+	MinHealthyClusters int      `mapstructure:"minHealthyClusters"`
+	CriticalClusters   []string `mapstructure:"criticalClusters"`
+}
+
+// ProbesConfig contains settings of the canary queries run periodically
+// against each cluster through the proxy's own routes.
+type ProbesConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Queries  []ProbeConfig `mapstructure:"queries"`
+}
+
+// ProbeConfig defines one canary query and the result it must return.
+type ProbeConfig struct {
+	Name    string `mapstructure:"name"`
+	Cluster string `mapstructure:"cluster"`
+	Backend string `mapstructure:"backend"` // "loki" or "mimir"
+	Query   string `mapstructure:"query"`
+	// Range runs a range query over the last Range instead of an instant
+	// query. Loki log queries need a range; defaults to 5m for Loki.
+	Range  time.Duration     `mapstructure:"range"`
+	Expect ProbeExpectConfig `mapstructure:"expect"`
+}
+
+// ProbeExpectConfig lists the assertions on a probe result. Unset fields are
+// not checked; a probe always requires a successful response.
+type ProbeExpectConfig struct {
+	ResultType string   `mapstructure:"resultType"`
+	MinResults int      `mapstructure:"minResults"`
+	Value      *float64 `mapstructure:"value"`
+}
+
+// SlowQueriesConfig contains slow query log settings. A query is recorded
+// when it exceeds either threshold; a zero threshold is disabled.
+type SlowQueriesConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	MinDuration       time.Duration `mapstructure:"minDuration"`
+	MinResponseSizeMB int           `mapstructure:"minResponseSizeMB"`
+	// BufferSize is the number of records kept in memory for the admin API.
+	BufferSize int `mapstructure:"bufferSize"`
+	// Identities and Groups list the callers allowed to use the admin API. If
+	// both are empty, the admin API rejects every caller.
+	Identities []string `mapstructure:"identities"`
+	Groups     []string `mapstructure:"groups"`
+}
+
+// CacheConfig contains response cache settings.
+type CacheConfig struct {
+	Results  ResultsCacheConfig  `mapstructure:"results"`
+	Metadata MetadataCacheConfig `mapstructure:"metadata"`
+}
+
+// ResultsCacheConfig configures the in-memory cache for Mimir range queries
+// and Loki metric range queries.
+type ResultsCacheConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	MaxSizeMB    int           `mapstructure:"maxSizeMB"`
+	MaxFreshness time.Duration `mapstructure:"maxFreshness"`
+	TTL          time.Duration `mapstructure:"ttl"`
+}
+
+// MetadataCacheConfig configures the in-memory cache for label names and
+// label values. Expired entries are served for up to staleTTL while they are
+// refreshed in the background.
+type MetadataCacheConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	MaxSizeMB       int           `mapstructure:"maxSizeMB"`
+	TTL             time.Duration `mapstructure:"ttl"`
+	StaleTTL        time.Duration `mapstructure:"staleTTL"`
+	TimeGranularity time.Duration `mapstructure:"timeGranularity"`
+}
+
+// LimitsConfig contains query guardrails. Cluster overrides are applied on
+// top of the defaults, and identity overrides on top of both.
+type LimitsConfig struct {
+	Default    QueryLimitsConfig      `mapstructure:"default"`
+	Clusters   []LimitsOverrideConfig `mapstructure:"clusters"`
+	Identities []LimitsOverrideConfig `mapstructure:"identities"`
+}
+
+// LimitsOverrideConfig overrides query limits for a named cluster or identity.
+type LimitsOverrideConfig struct {
+	Name              string `mapstructure:"name"`
+	QueryLimitsConfig `mapstructure:",squash"`
+}
+
+// QueryLimitsConfig holds query limits. Zero values disable the check.
+type QueryLimitsConfig struct {
+	MaxRange       time.Duration `mapstructure:"maxRange"`
+	MinStep        time.Duration `mapstructure:"minStep"`
+	MaxPoints      int           `mapstructure:"maxPoints"`
+	MaxQueryLength int           `mapstructure:"maxQueryLength"`
+	MaxLokiLimit   int           `mapstructure:"maxLokiLimit"`
+}
+
+// ConcurrencyConfig limits concurrent upstream requests to each cluster
+// backend. Requests beyond the limit wait in a bounded queue, served fairly
+// across callers or tenants.
+type ConcurrencyConfig struct {
+	Enabled                 bool `mapstructure:"enabled"`
+	ConcurrencyLimitsConfig `mapstructure:",squash"`
+	// FairBy is "identity" or "tenant".
+	FairBy   string                      `mapstructure:"fairBy"`
+	Clusters []ConcurrencyOverrideConfig `mapstructure:"clusters"`
+}
+
+// ConcurrencyOverrideConfig overrides concurrency limits for a named cluster.
+type ConcurrencyOverrideConfig struct {
+	Name                    string `mapstructure:"name"`
+	ConcurrencyLimitsConfig `mapstructure:",squash"`
+}
+
+// ConcurrencyLimitsConfig holds the concurrency limits of a cluster backend.
+type ConcurrencyLimitsConfig struct {
+	MaxConcurrent int           `mapstructure:"maxConcurrent"`
+	MaxQueued     int           `mapstructure:"maxQueued"`
+	QueueTimeout  time.Duration `mapstructure:"queueTimeout"`
+}
+
+func (l ConcurrencyLimitsConfig) validate(field string) error {
+	if l.MaxConcurrent < 0 {
+		return fmt.Errorf("%s.maxConcurrent must not be negative", field)
+	}
+	if l.MaxQueued < 0 {
+		return fmt.Errorf("%s.maxQueued must not be negative", field)
+	}
+	if l.QueueTimeout < 0 {
+		return fmt.Errorf("%s.queueTimeout must not be negative", field)
+	}
+	return nil
+}
+
+// CircuitBreakerConfig configures the circuit breaker around each cluster
+// backend. An open circuit fails requests fast instead of waiting for the
+// query timeout of an unavailable backend.
+type CircuitBreakerConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ConsecutiveFailures opens the circuit after this many failures in a row.
+	ConsecutiveFailures int `mapstructure:"consecutiveFailures"`
+	// FailureRatio opens the circuit when this share of requests in a window
+	// failed, once the window has seen MinRequests requests.
+	FailureRatio float64       `mapstructure:"failureRatio"`
+	MinRequests  int           `mapstructure:"minRequests"`
+	Window       time.Duration `mapstructure:"window"`
+	// OpenTimeout is how long the circuit stays open before probing.
+	OpenTimeout time.Duration `mapstructure:"openTimeout"`
+	// HalfOpenRequests is the number of concurrent probe requests.
+	HalfOpenRequests int `mapstructure:"halfOpenRequests"`
+}
+
+// PoliciesConfig contains access policy settings.
+type PoliciesConfig struct {
+	Labels    []LabelPolicyConfig    `mapstructure:"labels"`
+	Endpoints EndpointPoliciesConfig `mapstructure:"endpoints"`
+	Redaction []RedactionRuleConfig  `mapstructure:"redaction"`
+}
+
+// RedactionRuleConfig masks regex matches in Loki log lines and label values
+// returned by query, query_range and tail. A rule without identities or
+// groups applies to every caller except the exempt ones.
+type RedactionRuleConfig struct {
+	Name             string   `mapstructure:"name"`
+	Pattern          string   `mapstructure:"pattern"`
+	Replacement      string   `mapstructure:"replacement"`
+	Lines            bool     `mapstructure:"lines"`
+	Labels           []string `mapstructure:"labels"`
+	Tenants          []string `mapstructure:"tenants"`
+	Identities       []string `mapstructure:"identities"`
+	Groups           []string `mapstructure:"groups"`
+	ExemptIdentities []string `mapstructure:"exemptIdentities"`
+	ExemptGroups     []string `mapstructure:"exemptGroups"`
+}
+
+// EndpointPoliciesConfig controls which backend paths the catch-all proxy
+// routes may reach, per backend.
+type EndpointPoliciesConfig struct {
+	Loki  EndpointPolicyConfig `mapstructure:"loki"`
+	Mimir EndpointPolicyConfig `mapstructure:"mimir"`
+}
+
+// EndpointPolicyConfig lists endpoint rules for one backend. Rules are
+// evaluated in order, before the built-in read-only defaults unless
+// DisableDefaults is set. Requests matching no rule are denied.
+type EndpointPolicyConfig struct {
+	Rules           []EndpointRuleConfig `mapstructure:"rules"`
+	DisableDefaults bool                 `mapstructure:"disableDefaults"`
+}
+
+// EndpointRuleConfig allows or denies requests by method and path pattern.
+type EndpointRuleConfig struct {
+	Name       string   `mapstructure:"name"`
+	Action     string   `mapstructure:"action"` // "allow" or "deny"
+	Methods    []string `mapstructure:"methods"`
+	Paths      []string `mapstructure:"paths"`
+	Identities []string `mapstructure:"identities"`
+	Groups     []string `mapstructure:"groups"`
+}
+
+// LabelPolicyConfig injects mandatory label matchers into the queries of the
+// matching identities and groups. A policy without identities or groups
+// applies to every caller.
+type LabelPolicyConfig struct {
+	Name       string   `mapstructure:"name"`
+	Identities []string `mapstructure:"identities"`
+	Groups     []string `mapstructure:"groups"`
+	Clusters   []string `mapstructure:"clusters"`
+	Matchers   []string `mapstructure:"matchers"`
+}
+
 // ClusterConfig defines a Kubernetes cluster to proxy to.
 type ClusterConfig struct {
 	Name       string            `mapstructure:"name"`
@@ -74,13 +394,48 @@ type ServiceConfig struct {
 	Service    string `mapstructure:"service"`
 	Port       int    `mapstructure:"port"`
 	PathPrefix string `mapstructure:"pathPrefix"`
+	// ReadyPath is the readiness endpoint used by health checks. It is not
+	// under PathPrefix. Defaults to "/ready".
+	ReadyPath string `mapstructure:"readyPath"`
 }
 
 // TenantsConfig contains tenant discovery settings.
 type TenantsConfig struct {
-	IncludePatterns []string      `mapstructure:"includePatterns"`
-	ExcludePatterns []string      `mapstructure:"excludePatterns"`
-	RefreshInterval time.Duration `mapstructure:"refreshInterval"`
+	IncludePatterns []string `mapstructure:"includePatterns"`
+	ExcludePatterns []string `mapstructure:"excludePatterns"`
+	// LabelSelector restricts tenant discovery to matching namespaces.
+	LabelSelector string `mapstructure:"labelSelector"`
+	// TenantAnnotation and TenantLabel name the namespace annotation or
+	// label holding the tenant ID, instead of the namespace name.
+	TenantAnnotation string        `mapstructure:"tenantAnnotation"`
+	TenantLabel      string        `mapstructure:"tenantLabel"`
+	RefreshInterval  time.Duration `mapstructure:"refreshInterval"`
+	// SyncTimeout bounds the initial namespace sync before the watcher
+	// restarts with backoff.
+	SyncTimeout time.Duration `mapstructure:"syncTimeout"`
+	// RequireSync refuses queries to the cluster until its tenants have
+	// synced once, instead of sending them without X-Scope-OrgID.
+	RequireSync bool `mapstructure:"requireSync"`
+	// Retention keeps the tenants of deleted namespaces queryable for this
+	// long. RetentionFile persists their deletion times across restarts.
+	Retention     time.Duration `mapstructure:"retention"`
+	RetentionFile string        `mapstructure:"retentionFile"`
+	// Source selects where tenants come from: "namespaces" (default),
+	// "backends", or the "union" or "intersection" of both.
+	Source   string               `mapstructure:"source"`
+	Backends TenantBackendsConfig `mapstructure:"backends"`
+}
+
+// TenantBackendsConfig configures the discovery of the tenants that have data
+// in Loki and Mimir.
+type TenantBackendsConfig struct {
+	Interval time.Duration `mapstructure:"interval"`
+	// MimirPath is the tenant listing of Mimir, not under pathPrefix.
+	// Defaults to the distributor's /distributor/all_user_stats.
+	MimirPath string `mapstructure:"mimirPath"`
+	// LokiPath is the tenant listing of Loki, not under pathPrefix. Loki
+	// tenants are not discovered if it is empty.
+	LokiPath string `mapstructure:"lokiPath"`
 }
 
 // Load reads configuration from file and environment variables.
@@ -116,7 +471,55 @@ func setDefaults() {
 	viper.SetDefault("proxy.queryTimeout", "30s")
 	viper.SetDefault("proxy.maxTenantHeaderLength", 8192)
 	viper.SetDefault("proxy.metricsEnabled", true)
+	viper.SetDefault("proxy.coalesceRequests", true)
+	viper.SetDefault("proxy.client.qps", 50)
+	viper.SetDefault("proxy.client.burst", 100)
+	viper.SetDefault("proxy.client.maxIdleConnsPerHost", 100)
+	viper.SetDefault("proxy.client.idleConnTimeout", "90s")
+	viper.SetDefault("proxy.retry.enabled", false)
+	viper.SetDefault("proxy.retry.maxAttempts", 3)
+	viper.SetDefault("proxy.retry.initialBackoff", "100ms")
+	viper.SetDefault("proxy.retry.maxBackoff", "2s")
+	viper.SetDefault("proxy.retry.budgetRatio", 0.1)
+	viper.SetDefault("proxy.retry.budgetBurst", 10)
+	viper.SetDefault("proxy.retry.hedgeAfter", "0s")
 	viper.SetDefault("auth.enabled", false)
+	viper.SetDefault("audit.enabled", false)
+	viper.SetDefault("slowQueries.enabled", false)
+	viper.SetDefault("slowQueries.minDuration", "10s")
+	viper.SetDefault("slowQueries.minResponseSizeMB", 50)
+	viper.SetDefault("slowQueries.bufferSize", 1000)
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.exporter", "otlp")
+	viper.SetDefault("tracing.serviceName", "observability-federation-proxy")
+	viper.SetDefault("tracing.sampleRatio", 1.0)
+	viper.SetDefault("cache.results.enabled", false)
+	viper.SetDefault("cache.results.maxSizeMB", 256)
+	viper.SetDefault("cache.results.maxFreshness", "10m")
+	viper.SetDefault("cache.results.ttl", "24h")
+	viper.SetDefault("concurrency.enabled", false)
+	viper.SetDefault("concurrency.maxConcurrent", 32)
+	viper.SetDefault("concurrency.maxQueued", 256)
+	viper.SetDefault("concurrency.queueTimeout", "10s")
+	viper.SetDefault("concurrency.fairBy", "identity")
+	viper.SetDefault("circuitBreaker.enabled", false)
+	viper.SetDefault("circuitBreaker.consecutiveFailures", 5)
+	viper.SetDefault("circuitBreaker.failureRatio", 0.5)
+	viper.SetDefault("circuitBreaker.minRequests", 20)
+	viper.SetDefault("circuitBreaker.window", "1m")
+	viper.SetDefault("circuitBreaker.openTimeout", "30s")
+	viper.SetDefault("circuitBreaker.halfOpenRequests", 1)
+	viper.SetDefault("cache.metadata.enabled", false)
+	viper.SetDefault("cache.metadata.maxSizeMB", 64)
+	viper.SetDefault("cache.metadata.ttl", "1m")
+	viper.SetDefault("cache.metadata.staleTTL", "10m")
+	viper.SetDefault("cache.metadata.timeGranularity", "1m")
+	viper.SetDefault("health.interval", "15s")
+	viper.SetDefault("health.timeout", "5s")
+	viper.SetDefault("health.readiness.policy", "all")
+	viper.SetDefault("probes.enabled", false)
+	viper.SetDefault("probes.interval", "1m")
+	viper.SetDefault("probes.timeout", "10s")
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
 }
@@ -127,6 +530,197 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("proxy.listenAddress is required")
 	}
 
+	if c.Proxy.Client.QPS < 0 || c.Proxy.Client.Burst < 0 {
+		return fmt.Errorf("proxy.client.qps and proxy.client.burst must not be negative")
+	}
+	if c.Proxy.Client.MaxIdleConnsPerHost < 0 || c.Proxy.Client.MaxConnsPerHost < 0 {
+		return fmt.Errorf("proxy.client connection limits must not be negative")
+	}
+	if r := c.Proxy.Retry; r.Enabled {
+		if r.MaxAttempts < 0 || r.BudgetBurst < 0 || r.BudgetRatio < 0 {
+			return fmt.Errorf("proxy.retry attempts and budget must not be negative")
+		}
+		if r.InitialBackoff < 0 || r.MaxBackoff < 0 || r.HedgeAfter < 0 {
+			return fmt.Errorf("proxy.retry durations must not be negative")
+		}
+	}
+
+	for i, id := range c.Auth.Identities {
+		if id.Name == "" {
+			return fmt.Errorf("auth.identities[%d].name is required", i)
+		}
+		if id.Token == "" {
+			return fmt.Errorf("auth.identities[%d].token is required", i)
+		}
+	}
+
+	if c.Audit.Enabled {
+		if c.Audit.File == nil && c.Audit.Webhook == nil {
+			return fmt.Errorf("audit requires at least one of file or webhook configured")
+		}
+		if c.Audit.File != nil && c.Audit.File.Path == "" {
+			return fmt.Errorf("audit.file.path is required")
+		}
+		if c.Audit.Webhook != nil && c.Audit.Webhook.URL == "" {
+			return fmt.Errorf("audit.webhook.url is required")
+		}
+	}
+
+	if c.Health.Interval < 0 || c.Health.Timeout < 0 {
+		return fmt.Errorf("health durations must not be negative")
+	}
+	if err := c.validateReadiness(); err != nil {
+		return err
+	}
+
+	if sq := c.SlowQueries; sq.Enabled {
+		if sq.MinDuration < 0 || sq.MinResponseSizeMB < 0 {
+			return fmt.Errorf("slowQueries thresholds must not be negative")
+		}
+		if sq.MinDuration == 0 && sq.MinResponseSizeMB == 0 {
+			return fmt.Errorf("slowQueries requires minDuration or minResponseSizeMB")
+		}
+		if sq.BufferSize <= 0 {
+			return fmt.Errorf("slowQueries.bufferSize must be positive")
+		}
+	}
+
+	if c.Tracing.Enabled {
+		switch c.Tracing.Exporter {
+		case "otlp", "stdout", "none":
+		default:
+			return fmt.Errorf("tracing.exporter must be 'otlp', 'stdout' or 'none'")
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			return fmt.Errorf("tracing.sampleRatio must be between 0 and 1")
+		}
+	}
+
+	for i, p := range c.Policies.Labels {
+		if len(p.Matchers) == 0 {
+			return fmt.Errorf("policies.labels[%d].matchers is required", i)
+		}
+		for j, m := range p.Matchers {
+			if _, err := parser.ParseMetricSelector("{" + m + "}"); err != nil {
+				return fmt.Errorf("policies.labels[%d].matchers[%d] is invalid: %w", i, j, err)
+			}
+		}
+	}
+
+	if c.Cache.Results.Enabled {
+		if c.Cache.Results.MaxSizeMB <= 0 {
+			return fmt.Errorf("cache.results.maxSizeMB must be positive")
+		}
+		if c.Cache.Results.MaxFreshness < 0 {
+			return fmt.Errorf("cache.results.maxFreshness must not be negative")
+		}
+	}
+
+	if c.Cache.Metadata.Enabled {
+		if c.Cache.Metadata.MaxSizeMB <= 0 {
+			return fmt.Errorf("cache.metadata.maxSizeMB must be positive")
+		}
+		if c.Cache.Metadata.TTL < 0 || c.Cache.Metadata.StaleTTL < 0 || c.Cache.Metadata.TimeGranularity < 0 {
+			return fmt.Errorf("cache.metadata durations must not be negative")
+		}
+	}
+
+	if err := c.Limits.Default.validate("limits.default"); err != nil {
+		return err
+	}
+	if c.Concurrency.Enabled {
+		if c.Concurrency.MaxConcurrent <= 0 {
+			return fmt.Errorf("concurrency.maxConcurrent must be positive")
+		}
+		if err := c.Concurrency.validate("concurrency"); err != nil {
+			return err
+		}
+		switch c.Concurrency.FairBy {
+		case "", "identity", "tenant":
+		default:
+			return fmt.Errorf("concurrency.fairBy must be 'identity' or 'tenant'")
+		}
+		for i, o := range c.Concurrency.Clusters {
+			field := fmt.Sprintf("concurrency.clusters[%d]", i)
+			if o.Name == "" {
+				return fmt.Errorf("%s.name is required", field)
+			}
+			if err := o.validate(field); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.CircuitBreaker.Enabled {
+		cb := c.CircuitBreaker
+		if cb.ConsecutiveFailures < 0 || cb.MinRequests < 0 || cb.HalfOpenRequests < 0 {
+			return fmt.Errorf("circuitBreaker counts must not be negative")
+		}
+		if cb.FailureRatio < 0 || cb.FailureRatio > 1 {
+			return fmt.Errorf("circuitBreaker.failureRatio must be between 0 and 1")
+		}
+		if cb.Window < 0 || cb.OpenTimeout < 0 {
+			return fmt.Errorf("circuitBreaker durations must not be negative")
+		}
+	}
+
+	for _, overrides := range []struct {
+		field     string
+		overrides []LimitsOverrideConfig
+	}{
+		{"limits.clusters", c.Limits.Clusters},
+		{"limits.identities", c.Limits.Identities},
+	} {
+		for i, o := range overrides.overrides {
+			field := fmt.Sprintf("%s[%d]", overrides.field, i)
+			if o.Name == "" {
+				return fmt.Errorf("%s.name is required", field)
+			}
+			if err := o.validate(field); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, rule := range c.Policies.Redaction {
+		if rule.Pattern == "" {
+			return fmt.Errorf("policies.redaction[%d].pattern is required", i)
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("policies.redaction[%d].pattern is invalid: %w", i, err)
+		}
+		if !rule.Lines && len(rule.Labels) == 0 {
+			return fmt.Errorf("policies.redaction[%d] must set lines or labels", i)
+		}
+	}
+
+	endpointPolicies := []struct {
+		backend string
+		policy  EndpointPolicyConfig
+	}{
+		{"loki", c.Policies.Endpoints.Loki},
+		{"mimir", c.Policies.Endpoints.Mimir},
+	}
+	for _, ep := range endpointPolicies {
+		for i, rule := range ep.policy.Rules {
+			if rule.Action != "allow" && rule.Action != "deny" {
+				return fmt.Errorf("policies.endpoints.%s.rules[%d].action must be 'allow' or 'deny'", ep.backend, i)
+			}
+			if len(rule.Paths) == 0 {
+				return fmt.Errorf("policies.endpoints.%s.rules[%d].paths is required", ep.backend, i)
+			}
+			for j, pattern := range rule.Paths {
+				if !strings.HasPrefix(pattern, "/") {
+					return fmt.Errorf("policies.endpoints.%s.rules[%d].paths[%d] must start with /", ep.backend, i, j)
+				}
+				if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+					return fmt.Errorf("policies.endpoints.%s.rules[%d].paths[%d] is invalid: %w", ep.backend, i, j, err)
+				}
+			}
+		}
+	}
+
+	retentionFiles := make(map[string]string)
 	for i, cluster := range c.Clusters {
 		if cluster.Name == "" {
 			return fmt.Errorf("clusters[%d].name is required", i)
@@ -146,7 +740,136 @@ func (c *Config) Validate() error {
 		if cluster.Loki == nil && cluster.Mimir == nil {
 			return fmt.Errorf("clusters[%d] must have at least one of loki or mimir configured", i)
 		}
+		if cluster.Tenants.Retention < 0 {
+			return fmt.Errorf("clusters[%d].tenants.retention must not be negative", i)
+		}
+		if file := cluster.Tenants.RetentionFile; file != "" {
+			if cluster.Tenants.Retention == 0 {
+				return fmt.Errorf("clusters[%d].tenants.retentionFile requires retention", i)
+			}
+			if other, ok := retentionFiles[file]; ok {
+				return fmt.Errorf("clusters[%d].tenants.retentionFile is also used by cluster %s", i, other)
+			}
+			retentionFiles[file] = cluster.Name
+		}
+		if err := validateTenantSource(i, cluster); err != nil {
+			return err
+		}
+	}
+
+	if c.Probes.Enabled {
+		if err := c.validateProbes(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateTenantSource(i int, cluster ClusterConfig) error {
+	t := cluster.Tenants
+	switch t.Source {
+	case "", "namespaces":
+		return nil
+	case "backends", "union", "intersection":
+	default:
+		return fmt.Errorf("clusters[%d].tenants.source must be 'namespaces', 'backends', 'union' or 'intersection'", i)
+	}
+	if t.Backends.Interval < 0 {
+		return fmt.Errorf("clusters[%d].tenants.backends.interval must not be negative", i)
+	}
+	if t.Backends.LokiPath != "" && cluster.Loki == nil {
+		return fmt.Errorf("clusters[%d].tenants.backends.lokiPath requires loki", i)
+	}
+	if cluster.Mimir == nil && t.Backends.LokiPath == "" {
+		return fmt.Errorf("clusters[%d].tenants.source %q requires mimir or tenants.backends.lokiPath", i, t.Source)
+	}
+	return nil
+}
+
+func (c *Config) validateReadiness() error {
+	r := c.Health.Readiness
+	switch r.Policy {
+	case "", "all", "started":
+	case "minHealthy":
+		if r.MinHealthyClusters <= 0 {
+			return fmt.Errorf("health.readiness.minHealthyClusters must be positive")
+		}
+		if r.MinHealthyClusters > len(c.Clusters) {
+			return fmt.Errorf("health.readiness.minHealthyClusters exceeds the number of clusters")
+		}
+	case "critical":
+		if len(r.CriticalClusters) == 0 {
+			return fmt.Errorf("health.readiness.criticalClusters is required")
+		}
+		for i, name := range r.CriticalClusters {
+			if !slices.ContainsFunc(c.Clusters, func(cluster ClusterConfig) bool { return cluster.Name == name }) {
+				return fmt.Errorf("health.readiness.criticalClusters[%d] %q is not a configured cluster", i, name)
+			}
+		}
+	default:
+		return fmt.Errorf("health.readiness.policy must be 'all', 'started', 'minHealthy' or 'critical'")
+	}
+	return nil
+}
+
+func (c *Config) validateProbes() error {
+	if c.Probes.Interval < 0 || c.Probes.Timeout < 0 {
+		return fmt.Errorf("probes durations must not be negative")
 	}
 
+	names := make(map[string]bool, len(c.Probes.Queries))
+	for i, p := range c.Probes.Queries {
+		field := fmt.Sprintf("probes.queries[%d]", i)
+		if p.Name == "" {
+			return fmt.Errorf("%s.name is required", field)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("%s.name %q is not unique", field, p.Name)
+		}
+		names[p.Name] = true
+		if p.Query == "" {
+			return fmt.Errorf("%s.query is required", field)
+		}
+		if p.Range < 0 || p.Expect.MinResults < 0 {
+			return fmt.Errorf("%s range and minResults must not be negative", field)
+		}
+
+		idx := slices.IndexFunc(c.Clusters, func(cluster ClusterConfig) bool { return cluster.Name == p.Cluster })
+		if idx < 0 {
+			return fmt.Errorf("%s.cluster %q is not a configured cluster", field, p.Cluster)
+		}
+		switch p.Backend {
+		case "loki":
+			if c.Clusters[idx].Loki == nil {
+				return fmt.Errorf("%s: cluster %q has no loki configured", field, p.Cluster)
+			}
+		case "mimir":
+			if c.Clusters[idx].Mimir == nil {
+				return fmt.Errorf("%s: cluster %q has no mimir configured", field, p.Cluster)
+			}
+		default:
+			return fmt.Errorf("%s.backend must be 'loki' or 'mimir'", field)
+		}
+	}
+	return nil
+}
+
+func (l QueryLimitsConfig) validate(field string) error {
+	if l.MaxRange < 0 {
+		return fmt.Errorf("%s.maxRange must not be negative", field)
+	}
+	if l.MinStep < 0 {
+		return fmt.Errorf("%s.minStep must not be negative", field)
+	}
+	if l.MaxPoints < 0 {
+		return fmt.Errorf("%s.maxPoints must not be negative", field)
+	}
+	if l.MaxQueryLength < 0 {
+		return fmt.Errorf("%s.maxQueryLength must not be negative", field)
+	}
+	if l.MaxLokiLimit < 0 {
+		return fmt.Errorf("%s.maxLokiLimit must not be negative", field)
+	}
 	return nil
 }
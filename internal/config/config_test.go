@@ -95,6 +95,159 @@ clusters:
 	}
 }
 
+func TestLoad_Limits(t *testing.T) {
+	configContent := `
+limits:
+  default:
+    maxRange: 720h
+    maxQueryLength: 10000
+  clusters:
+    - name: prod-EU
+      minStep: 30s
+  identities:
+    - name: batch
+      maxRange: 2160h
+      maxLokiLimit: 50000
+`
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	viper.Reset()
+	viper.SetConfigFile(configPath)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	setDefaults()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Limits.Default.MaxRange != 720*time.Hour {
+		t.Errorf("expected default max range 720h, got %v", cfg.Limits.Default.MaxRange)
+	}
+	if len(cfg.Limits.Clusters) != 1 || cfg.Limits.Clusters[0].Name != "prod-EU" {
+		t.Fatalf("expected cluster override for prod-EU, got %+v", cfg.Limits.Clusters)
+	}
+	if cfg.Limits.Clusters[0].MinStep != 30*time.Second {
+		t.Errorf("expected cluster min step 30s, got %v", cfg.Limits.Clusters[0].MinStep)
+	}
+	if len(cfg.Limits.Identities) != 1 || cfg.Limits.Identities[0].MaxLokiLimit != 50000 {
+		t.Errorf("expected identity override with maxLokiLimit 50000, got %+v", cfg.Limits.Identities)
+	}
+}
+
+func TestLoad_Concurrency(t *testing.T) {
+	configContent := `
+concurrency:
+  enabled: true
+  maxConcurrent: 16
+  fairBy: tenant
+  clusters:
+    - name: prod-EU
+      maxConcurrent: 64
+`
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	viper.Reset()
+	viper.SetConfigFile(configPath)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	setDefaults()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Concurrency.MaxConcurrent != 16 || cfg.Concurrency.FairBy != "tenant" {
+		t.Errorf("unexpected concurrency config: %+v", cfg.Concurrency)
+	}
+	if cfg.Concurrency.MaxQueued != 256 || cfg.Concurrency.QueueTimeout != 10*time.Second {
+		t.Errorf("expected default queue settings, got %+v", cfg.Concurrency.ConcurrencyLimitsConfig)
+	}
+	if len(cfg.Concurrency.Clusters) != 1 || cfg.Concurrency.Clusters[0].Name != "prod-EU" || cfg.Concurrency.Clusters[0].MaxConcurrent != 64 {
+		t.Errorf("expected cluster override for prod-EU, got %+v", cfg.Concurrency.Clusters)
+	}
+}
+
+func TestLoad_Retry(t *testing.T) {
+	configContent := `
+proxy:
+  retry:
+    enabled: true
+    hedgeAfter: 2s
+`
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	viper.Reset()
+	viper.SetConfigFile(configPath)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	setDefaults()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := cfg.Proxy.Retry
+	if !r.Enabled || r.HedgeAfter != 2*time.Second {
+		t.Errorf("unexpected retry config: %+v", r)
+	}
+	if r.MaxAttempts != 3 || r.InitialBackoff != 100*time.Millisecond || r.MaxBackoff != 2*time.Second || r.BudgetRatio != 0.1 || r.BudgetBurst != 10 {
+		t.Errorf("expected default retry settings, got %+v", r)
+	}
+}
+
+func TestLoad_CircuitBreaker(t *testing.T) {
+	configContent := `
+circuitBreaker:
+  enabled: true
+  consecutiveFailures: 3
+  openTimeout: 1m
+`
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	viper.Reset()
+	viper.SetConfigFile(configPath)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	setDefaults()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cb := cfg.CircuitBreaker
+	if !cb.Enabled || cb.ConsecutiveFailures != 3 || cb.OpenTimeout != time.Minute {
+		t.Errorf("unexpected circuit breaker config: %+v", cb)
+	}
+	if cb.FailureRatio != 0.5 || cb.MinRequests != 20 || cb.Window != time.Minute || cb.HalfOpenRequests != 1 {
+		t.Errorf("expected default circuit breaker settings, got %+v", cb)
+	}
+}
+
 func TestConfig_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -198,6 +351,332 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "identity without token",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Auth: AuthConfig{
+					Identities: []IdentityConfig{{Name: "alice"}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "auth.identities[0].token is required",
+		},
+		{
+			name: "audit enabled without sinks",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Audit: AuditConfig{Enabled: true},
+			},
+			wantErr: true,
+			errMsg:  "audit requires at least one of file or webhook configured",
+		},
+		{
+			name: "audit file without path",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Audit: AuditConfig{Enabled: true, File: &AuditFileConfig{}},
+			},
+			wantErr: true,
+			errMsg:  "audit.file.path is required",
+		},
+		{
+			name: "probe of unknown cluster",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Probes: ProbesConfig{
+					Enabled: true,
+					Queries: []ProbeConfig{{Name: "vector", Cluster: "prod", Backend: "mimir", Query: "vector(1)"}},
+				},
+			},
+			wantErr: true,
+			errMsg:  `probes.queries[0].cluster "prod" is not a configured cluster`,
+		},
+		{
+			name: "critical cluster not configured",
+			config: Config{
+				Proxy:  ProxyConfig{ListenAddress: ":8080"},
+				Health: HealthConfig{Readiness: ReadinessConfig{Policy: "critical", CriticalClusters: []string{"prod"}}},
+			},
+			wantErr: true,
+			errMsg:  `health.readiness.criticalClusters[0] "prod" is not a configured cluster`,
+		},
+		{
+			name: "min healthy clusters exceeds clusters",
+			config: Config{
+				Proxy:  ProxyConfig{ListenAddress: ":8080"},
+				Health: HealthConfig{Readiness: ReadinessConfig{Policy: "minHealthy", MinHealthyClusters: 1}},
+			},
+			wantErr: true,
+			errMsg:  "health.readiness.minHealthyClusters exceeds the number of clusters",
+		},
+		{
+			name: "tenant retention file without retention",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Clusters: []ClusterConfig{{
+					Name:       "test",
+					Type:       "kubeconfig",
+					Kubeconfig: &KubeconfigConfig{Path: "/tmp/kubeconfig"},
+					Mimir:      &ServiceConfig{Namespace: "mimir", Service: "mimir", Port: 8080},
+					Tenants:    TenantsConfig{RetentionFile: "/var/lib/proxy/test.json"},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "clusters[0].tenants.retentionFile requires retention",
+		},
+		{
+			name: "backend tenant source without listing",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Clusters: []ClusterConfig{{
+					Name:       "test",
+					Type:       "kubeconfig",
+					Kubeconfig: &KubeconfigConfig{Path: "/tmp/kubeconfig"},
+					Loki:       &ServiceConfig{Namespace: "loki", Service: "loki", Port: 3100},
+					Tenants:    TenantsConfig{Source: "backends"},
+				}},
+			},
+			wantErr: true,
+			errMsg:  `clusters[0].tenants.source "backends" requires mimir or tenants.backends.lokiPath`,
+		},
+		{
+			name: "slow queries without thresholds",
+			config: Config{
+				Proxy:       ProxyConfig{ListenAddress: ":8080"},
+				SlowQueries: SlowQueriesConfig{Enabled: true, BufferSize: 100},
+			},
+			wantErr: true,
+			errMsg:  "slowQueries requires minDuration or minResponseSizeMB",
+		},
+		{
+			name: "label policy without matchers",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Labels: []LabelPolicyConfig{{Name: "payments"}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "policies.labels[0].matchers is required",
+		},
+		{
+			name: "label policy with invalid matcher",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Labels: []LabelPolicyConfig{{Name: "payments", Matchers: []string{`app=~`}}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "endpoint rule with invalid action",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Endpoints: EndpointPoliciesConfig{
+						Loki: EndpointPolicyConfig{
+							Rules: []EndpointRuleConfig{{Action: "permit", Paths: []string{"/flush"}}},
+						},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "policies.endpoints.loki.rules[0].action must be 'allow' or 'deny'",
+		},
+		{
+			name: "endpoint rule without paths",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Endpoints: EndpointPoliciesConfig{
+						Mimir: EndpointPolicyConfig{
+							Rules: []EndpointRuleConfig{{Action: "allow"}},
+						},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "policies.endpoints.mimir.rules[0].paths is required",
+		},
+		{
+			name: "endpoint rule with relative path",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Endpoints: EndpointPoliciesConfig{
+						Mimir: EndpointPolicyConfig{
+							Rules: []EndpointRuleConfig{{Action: "deny", Paths: []string{"api/v1/push"}}},
+						},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "policies.endpoints.mimir.rules[0].paths[0] must start with /",
+		},
+		{
+			name: "valid endpoint rule",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Endpoints: EndpointPoliciesConfig{
+						Mimir: EndpointPolicyConfig{
+							Rules: []EndpointRuleConfig{{
+								Action: "allow",
+								Groups: []string{"operators"},
+								Paths:  []string{"/api/v1/admin/**"},
+							}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "results cache without size",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Cache: CacheConfig{Results: ResultsCacheConfig{Enabled: true}},
+			},
+			wantErr: true,
+			errMsg:  "cache.results.maxSizeMB must be positive",
+		},
+		{
+			name: "valid results cache",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Cache: CacheConfig{Results: ResultsCacheConfig{Enabled: true, MaxSizeMB: 64}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "concurrency without limit",
+			config: Config{
+				Proxy:       ProxyConfig{ListenAddress: ":8080"},
+				Concurrency: ConcurrencyConfig{Enabled: true},
+			},
+			wantErr: true,
+			errMsg:  "concurrency.maxConcurrent must be positive",
+		},
+		{
+			name: "invalid concurrency fairness",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Concurrency: ConcurrencyConfig{
+					Enabled:                 true,
+					ConcurrencyLimitsConfig: ConcurrencyLimitsConfig{MaxConcurrent: 8},
+					FairBy:                  "dashboard",
+				},
+			},
+			wantErr: true,
+			errMsg:  "concurrency.fairBy must be 'identity' or 'tenant'",
+		},
+		{
+			name: "negative retry backoff",
+			config: Config{
+				Proxy: ProxyConfig{
+					ListenAddress: ":8080",
+					Retry:         RetryConfig{Enabled: true, InitialBackoff: -time.Second},
+				},
+			},
+			wantErr: true,
+			errMsg:  "proxy.retry durations must not be negative",
+		},
+		{
+			name: "invalid circuit breaker failure ratio",
+			config: Config{
+				Proxy:          ProxyConfig{ListenAddress: ":8080"},
+				CircuitBreaker: CircuitBreakerConfig{Enabled: true, FailureRatio: 1.5},
+			},
+			wantErr: true,
+			errMsg:  "circuitBreaker.failureRatio must be between 0 and 1",
+		},
+		{
+			name: "invalid tracing exporter",
+			config: Config{
+				Proxy:   ProxyConfig{ListenAddress: ":8080"},
+				Tracing: TracingConfig{Enabled: true, Exporter: "jaeger"},
+			},
+			wantErr: true,
+			errMsg:  "tracing.exporter must be 'otlp', 'stdout' or 'none'",
+		},
+		{
+			name: "metadata cache without size",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Cache: CacheConfig{Metadata: MetadataCacheConfig{Enabled: true}},
+			},
+			wantErr: true,
+			errMsg:  "cache.metadata.maxSizeMB must be positive",
+		},
+		{
+			name: "negative limit",
+			config: Config{
+				Proxy:  ProxyConfig{ListenAddress: ":8080"},
+				Limits: LimitsConfig{Default: QueryLimitsConfig{MaxRange: -time.Hour}},
+			},
+			wantErr: true,
+			errMsg:  "limits.default.maxRange must not be negative",
+		},
+		{
+			name: "limits override without name",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Limits: LimitsConfig{
+					Identities: []LimitsOverrideConfig{{QueryLimitsConfig: QueryLimitsConfig{MaxPoints: 100}}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "limits.identities[0].name is required",
+		},
+		{
+			name: "redaction rule with invalid pattern",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Redaction: []RedactionRuleConfig{{Name: "emails", Pattern: "(", Lines: true}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "redaction rule without target",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Redaction: []RedactionRuleConfig{{Name: "emails", Pattern: "@"}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "policies.redaction[0] must set lines or labels",
+		},
+		{
+			name: "valid redaction rule",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Redaction: []RedactionRuleConfig{{
+						Name:         "emails",
+						Pattern:      `[a-z]+@[a-z]+\.com`,
+						Lines:        true,
+						Labels:       []string{"user"},
+						ExemptGroups: []string{"payments"},
+					}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid label policy",
+			config: Config{
+				Proxy: ProxyConfig{ListenAddress: ":8080"},
+				Policies: PoliciesConfig{
+					Labels: []LabelPolicyConfig{{Name: "payments", Matchers: []string{`app=~"payments-.*"`}}},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "valid kubeconfig cluster",
 			config: Config{
@@ -0,0 +1,204 @@
+// Package health runs periodic health checks of cluster backends and caches
+// their results for readiness probes.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// State is the outcome of the latest check of a backend.
+type State string
+
+const (
+	// Pending means the backend has not been checked yet.
+	Pending State = "pending"
+	// OK means the latest check succeeded.
+	OK State = "ok"
+	// Failing means the latest check failed.
+	Failing State = "failing"
+)
+
+// Check checks one backend of a cluster.
+type Check struct {
+	Cluster string
+	// Backend is "apiserver", "loki" or "mimir".
+	Backend string
+	Check   func(ctx context.Context) error
+}
+
+// Status is the cached result of a backend's checks.
+type Status struct {
+	State       State     `json:"status"`
+	LastCheck   time.Time `json:"lastCheck,omitzero"`
+	LastSuccess time.Time `json:"lastSuccess,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+	// Since is when the backend entered its current state.
+	Since time.Time `json:"since,omitzero"`
+}
+
+// Config holds configuration for creating a checker.
+type Config struct {
+	// Interval between two rounds of checks. Defaults to 15s.
+	Interval time.Duration
+	// Timeout of a single check. Defaults to 5s.
+	Timeout time.Duration
+}
+
+// Checker runs health checks in the background and caches their results.
+type Checker struct {
+	checks   []Check
+	interval time.Duration
+	timeout  time.Duration
+
+	statuses map[string]map[string]Status
+	mu       sync.RWMutex
+
+	started bool
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// NewChecker creates a checker for the given checks. All backends are
+// pending until the first round of checks completes.
+func NewChecker(cfg Config, checks []Check) *Checker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	statuses := make(map[string]map[string]Status)
+	for _, check := range checks {
+		if statuses[check.Cluster] == nil {
+			statuses[check.Cluster] = make(map[string]Status)
+		}
+		statuses[check.Cluster][check.Backend] = Status{State: Pending}
+	}
+
+	return &Checker{
+		checks:   checks,
+		interval: cfg.Interval,
+		timeout:  cfg.Timeout,
+		statuses: statuses,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+}
+
+// Start runs a round of checks immediately and then on every interval,
+// until Stop is called or ctx is cancelled.
+func (c *Checker) Start(ctx context.Context) {
+	c.mu.Lock()
+	c.started = true
+	c.mu.Unlock()
+
+	go func() {
+		defer close(c.doneCh)
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			c.CheckNow(ctx)
+
+			select {
+			case <-ticker.C:
+			case <-c.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background checks and waits for a running round to finish.
+// It is a no-op if the checker was never started.
+func (c *Checker) Stop() {
+	c.mu.RLock()
+	started := c.started
+	c.mu.RUnlock()
+	if !started {
+		return
+	}
+
+	close(c.stopCh)
+	<-c.doneCh
+}
+
+// CheckNow runs all checks concurrently and records their results.
+func (c *Checker) CheckNow(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+			c.record(check, check.Check(checkCtx))
+		}(check)
+	}
+	wg.Wait()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for cluster, backends := range c.statuses {
+		metrics.RecordClusterHealth(cluster, ClusterHealthy(backends))
+	}
+}
+
+func (c *Checker) record(check Check, err error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := c.statuses[check.Cluster][check.Backend]
+	previous := status.State
+	status.LastCheck = now
+	if err == nil {
+		status.State = OK
+		status.LastSuccess = now
+		status.LastError = ""
+	} else {
+		status.State = Failing
+		status.LastError = err.Error()
+	}
+	if status.State != previous {
+		status.Since = now
+	}
+	c.statuses[check.Cluster][check.Backend] = status
+
+	metrics.RecordBackendHealth(check.Cluster, check.Backend, err == nil)
+
+	// Log state changes only, not every failed check
+	switch {
+	case err != nil && previous != Failing:
+		log.Warn().Err(err).Str("cluster", check.Cluster).Str("backend", check.Backend).Msg("backend health check failing")
+	case err == nil && previous == Failing:
+		log.Info().Str("cluster", check.Cluster).Str("backend", check.Backend).Msg("backend health check recovered")
+	}
+}
+
+// Statuses returns the cached status of every backend by cluster and backend.
+func (c *Checker) Statuses() map[string]map[string]Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	statuses := make(map[string]map[string]Status, len(c.statuses))
+	for cluster, backends := range c.statuses {
+		statuses[cluster] = make(map[string]Status, len(backends))
+		for backend, status := range backends {
+			statuses[cluster][backend] = status
+		}
+	}
+	return statuses
+}
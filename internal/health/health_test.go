@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	var lokiErr error
+	checker := NewChecker(Config{}, []Check{
+		{Cluster: "prod", Backend: "apiserver", Check: func(context.Context) error { return nil }},
+		{Cluster: "prod", Backend: "loki", Check: func(context.Context) error { return lokiErr }},
+	})
+
+	// Backends are pending until checked
+	if state := checker.Statuses()["prod"]["loki"].State; state != Pending {
+		t.Errorf("expected pending, got %s", state)
+	}
+
+	lokiErr = errors.New("no endpoints available")
+	checker.CheckNow(context.Background())
+
+	statuses := checker.Statuses()["prod"]
+	if statuses["apiserver"].State != OK || statuses["apiserver"].LastSuccess.IsZero() {
+		t.Errorf("unexpected apiserver status: %+v", statuses["apiserver"])
+	}
+	loki := statuses["loki"]
+	if loki.State != Failing || loki.LastError != "no endpoints available" || loki.LastCheck.IsZero() || !loki.LastSuccess.IsZero() {
+		t.Errorf("unexpected loki status: %+v", loki)
+	}
+	failingSince := loki.Since
+
+	lokiErr = nil
+	checker.CheckNow(context.Background())
+
+	loki = checker.Statuses()["prod"]["loki"]
+	if loki.State != OK || loki.LastError != "" || !loki.Since.After(failingSince) {
+		t.Errorf("expected loki to recover, got %+v", loki)
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	checker := NewChecker(Config{Timeout: 10 * time.Millisecond}, []Check{
+		{Cluster: "prod", Backend: "mimir", Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	})
+	checker.CheckNow(context.Background())
+
+	if status := checker.Statuses()["prod"]["mimir"]; status.State != Failing {
+		t.Errorf("expected timed out check to fail, got %+v", status)
+	}
+}
+
+func TestChecker_StartStop(t *testing.T) {
+	checked := make(chan struct{}, 10)
+	checker := NewChecker(Config{Interval: time.Hour}, []Check{
+		{Cluster: "prod", Backend: "apiserver", Check: func(context.Context) error {
+			checked <- struct{}{}
+			return nil
+		}},
+	})
+
+	// Stopping a checker that was never started returns immediately
+	NewChecker(Config{}, nil).Stop()
+
+	checker.Start(context.Background())
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Fatal("expected a check right after start")
+	}
+	checker.Stop()
+}
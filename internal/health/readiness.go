@@ -0,0 +1,90 @@
+package health
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Readiness policies.
+const (
+	// PolicyAll is ready while every cluster is healthy.
+	PolicyAll = "all"
+	// PolicyStarted is ready as soon as the proxy serves requests,
+	// regardless of cluster health.
+	PolicyStarted = "started"
+	// PolicyMinHealthy is ready while at least a minimum number of clusters
+	// are healthy.
+	PolicyMinHealthy = "minHealthy"
+	// PolicyCritical is ready while a set of critical clusters are healthy.
+	PolicyCritical = "critical"
+)
+
+// ReadinessPolicy decides whether the proxy is ready from the health of its
+// clusters. A cluster is healthy when all of its backends are.
+type ReadinessPolicy struct {
+	// Policy is one of the Policy constants. Defaults to PolicyAll.
+	Policy string
+	// MinHealthy is the number of healthy clusters required by
+	// PolicyMinHealthy.
+	MinHealthy int
+	// Critical lists the clusters required by PolicyCritical.
+	Critical []string
+}
+
+// Ready evaluates the policy against the statuses of Checker.Statuses. If
+// the proxy is not ready, the reason says why.
+func (p ReadinessPolicy) Ready(statuses map[string]map[string]Status) (bool, string) {
+	switch p.Policy {
+	case PolicyStarted:
+		return true, ""
+
+	case PolicyMinHealthy:
+		healthy := 0
+		for _, backends := range statuses {
+			if ClusterHealthy(backends) {
+				healthy++
+			}
+		}
+		if healthy < p.MinHealthy {
+			return false, fmt.Sprintf("%d of %d required clusters healthy", healthy, p.MinHealthy)
+		}
+		return true, ""
+
+	case PolicyCritical:
+		return requireHealthy(statuses, p.Critical)
+
+	default:
+		return requireHealthy(statuses, slices.Collect(maps.Keys(statuses)))
+	}
+}
+
+// requireHealthy is ready if all the given clusters are healthy.
+func requireHealthy(statuses map[string]map[string]Status, clusters []string) (bool, string) {
+	var unhealthy []string
+	for _, cluster := range clusters {
+		if !ClusterHealthy(statuses[cluster]) {
+			unhealthy = append(unhealthy, cluster)
+		}
+	}
+	if len(unhealthy) > 0 {
+		slices.Sort(unhealthy)
+		return false, "unhealthy clusters: " + strings.Join(unhealthy, ", ")
+	}
+	return true, ""
+}
+
+// ClusterHealthy reports whether every backend of a cluster passed its
+// latest check. A cluster without checks is not healthy.
+func ClusterHealthy(backends map[string]Status) bool {
+	if len(backends) == 0 {
+		return false
+	}
+	for _, status := range backends {
+		if status.State != OK {
+			return false
+		}
+	}
+	return true
+}
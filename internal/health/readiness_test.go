@@ -0,0 +1,35 @@
+package health
+
+import "testing"
+
+func TestReadinessPolicy_Ready(t *testing.T) {
+	statuses := map[string]map[string]Status{
+		"prod":    {"apiserver": {State: OK}, "loki": {State: OK}},
+		"staging": {"apiserver": {State: OK}, "loki": {State: Failing}},
+		"dev":     {"apiserver": {State: Pending}},
+	}
+
+	tests := []struct {
+		name   string
+		policy ReadinessPolicy
+		ready  bool
+		reason string
+	}{
+		{"all", ReadinessPolicy{}, false, "unhealthy clusters: dev, staging"},
+		{"started", ReadinessPolicy{Policy: PolicyStarted}, true, ""},
+		{"min healthy met", ReadinessPolicy{Policy: PolicyMinHealthy, MinHealthy: 1}, true, ""},
+		{"min healthy not met", ReadinessPolicy{Policy: PolicyMinHealthy, MinHealthy: 2}, false, "1 of 2 required clusters healthy"},
+		{"critical healthy", ReadinessPolicy{Policy: PolicyCritical, Critical: []string{"prod"}}, true, ""},
+		{"critical unhealthy", ReadinessPolicy{Policy: PolicyCritical, Critical: []string{"prod", "staging"}}, false, "unhealthy clusters: staging"},
+		{"critical without checks", ReadinessPolicy{Policy: PolicyCritical, Critical: []string{"unknown"}}, false, "unhealthy clusters: unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, reason := tt.policy.Ready(statuses)
+			if ready != tt.ready || reason != tt.reason {
+				t.Errorf("expected (%v, %q), got (%v, %q)", tt.ready, tt.reason, ready, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+// Package limits enforces per-cluster and per-identity query guardrails.
+package limits
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+// Limits holds query guardrails. Zero values disable the corresponding check.
+type Limits struct {
+	// MaxRange is the maximum end-start duration of a range query.
+	MaxRange time.Duration
+	// MinStep is the minimum step of a range query.
+	MinStep time.Duration
+	// MaxPoints is the maximum number of points per series, (end-start)/step.
+	MaxPoints int
+	// MaxQueryLength is the maximum length of the query expression in bytes.
+	MaxQueryLength int
+	// MaxLogLimit is the maximum value of the Loki limit parameter.
+	MaxLogLimit int
+}
+
+// Merge returns l with every non-zero field of override applied on top.
+func (l Limits) Merge(override Limits) Limits {
+	if override.MaxRange != 0 {
+		l.MaxRange = override.MaxRange
+	}
+	if override.MinStep != 0 {
+		l.MinStep = override.MinStep
+	}
+	if override.MaxPoints != 0 {
+		l.MaxPoints = override.MaxPoints
+	}
+	if override.MaxQueryLength != 0 {
+		l.MaxQueryLength = override.MaxQueryLength
+	}
+	if override.MaxLogLimit != 0 {
+		l.MaxLogLimit = override.MaxLogLimit
+	}
+	return l
+}
+
+// CheckQuery validates the length of the query expression.
+func (l Limits) CheckQuery(query string) error {
+	if l.MaxQueryLength > 0 && len(query) > l.MaxQueryLength {
+		return fmt.Errorf("the query length of %d characters exceeds the limit of %d", len(query), l.MaxQueryLength)
+	}
+	return nil
+}
+
+// CheckRange validates the time range and resolution of a range query from its
+// start, end and step parameters. A missing step is not checked, as the
+// backend picks one itself.
+func (l Limits) CheckRange(params url.Values) error {
+	if l.MaxRange == 0 && l.MinStep == 0 && l.MaxPoints == 0 {
+		return nil
+	}
+
+	start, err := ParseTime(params.Get("start"))
+	if err != nil {
+		return fmt.Errorf("invalid parameter \"start\": %w", err)
+	}
+	end, err := ParseTime(params.Get("end"))
+	if err != nil {
+		return fmt.Errorf("invalid parameter \"end\": %w", err)
+	}
+
+	queryRange := end.Sub(start)
+	if l.MaxRange > 0 && queryRange > l.MaxRange {
+		return fmt.Errorf("the query time range exceeds the limit (query length: %s, limit: %s)",
+			model.Duration(queryRange), model.Duration(l.MaxRange))
+	}
+
+	stepParam := params.Get("step")
+	if stepParam == "" {
+		return nil
+	}
+	step, err := ParseDuration(stepParam)
+	if err != nil {
+		return fmt.Errorf("invalid parameter \"step\": %w", err)
+	}
+	if step <= 0 {
+		return fmt.Errorf("zero or negative query resolution step widths are not accepted. Try a positive integer")
+	}
+
+	if l.MinStep > 0 && step < l.MinStep {
+		return fmt.Errorf("the query step of %s is below the minimum of %s", model.Duration(step), model.Duration(l.MinStep))
+	}
+	if l.MaxPoints > 0 && int64(queryRange/step) > int64(l.MaxPoints) {
+		return fmt.Errorf("exceeded maximum resolution of %d points per timeseries. Try decreasing the query resolution (?step=XX)", l.MaxPoints)
+	}
+
+	return nil
+}
+
+// CheckLogLimit validates the Loki limit parameter.
+func (l Limits) CheckLogLimit(params url.Values) error {
+	if l.MaxLogLimit == 0 {
+		return nil
+	}
+
+	limitParam := params.Get("limit")
+	if limitParam == "" {
+		return nil
+	}
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil {
+		return fmt.Errorf("invalid parameter \"limit\": %w", err)
+	}
+	if limit > l.MaxLogLimit {
+		return fmt.Errorf("the limit of %d entries exceeds the maximum of %d", limit, l.MaxLogLimit)
+	}
+	return nil
+}
+
+// Resolver resolves the effective limits for a caller on a cluster.
+// Identity overrides take precedence over cluster overrides, which take
+// precedence over the defaults.
+type Resolver struct {
+	defaults   Limits
+	clusters   map[string]Limits
+	identities map[string]Limits
+}
+
+// NewResolver creates a resolver from default limits and per-cluster and
+// per-identity overrides.
+func NewResolver(defaults Limits, clusters, identities map[string]Limits) *Resolver {
+	return &Resolver{
+		defaults:   defaults,
+		clusters:   clusters,
+		identities: identities,
+	}
+}
+
+// For returns the limits that apply to the caller on the given cluster.
+// A nil resolver returns no limits.
+func (r *Resolver) For(identity middleware.Identity, cluster string) Limits {
+	if r == nil {
+		return Limits{}
+	}
+
+	l := r.defaults
+	if override, ok := r.clusters[cluster]; ok {
+		l = l.Merge(override)
+	}
+	if override, ok := r.identities[identity.Name]; ok {
+		l = l.Merge(override)
+	}
+	return l
+}
+
+// ParseTime parses a timestamp in any of the formats accepted by Prometheus
+// and Loki: RFC3339, Unix seconds with optional fraction, or Unix nanoseconds.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty timestamp")
+	}
+
+	if !strings.Contains(s, ".") {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			// Loki accepts nanosecond timestamps; ten digits cover Unix
+			// seconds until the year 2286.
+			if len(strings.TrimPrefix(s, "-")) <= 10 {
+				return time.Unix(n, 0), nil
+			}
+			return time.Unix(0, n), nil
+		}
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+	}
+	return t, nil
+}
+
+// ParseDuration parses a step or duration given either as a float number of
+// seconds or as a Prometheus duration string such as "30s" or "1d".
+func ParseDuration(s string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	if d, err := model.ParseDuration(s); err == nil {
+		return time.Duration(d), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+}
@@ -0,0 +1,200 @@
+package limits
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+func TestLimits_CheckQuery(t *testing.T) {
+	l := Limits{MaxQueryLength: 10}
+
+	if err := l.CheckQuery("up"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := l.CheckQuery("sum(rate(http_requests_total[5m]))"); err == nil {
+		t.Error("expected error for long query")
+	}
+	if err := (Limits{}).CheckQuery(strings.Repeat("x", 100000)); err != nil {
+		t.Errorf("expected no limit when unset, got %v", err)
+	}
+}
+
+func TestLimits_CheckRange(t *testing.T) {
+	l := Limits{
+		MaxRange:  24 * time.Hour,
+		MinStep:   15 * time.Second,
+		MaxPoints: 11000,
+	}
+
+	tests := []struct {
+		name   string
+		params url.Values
+		errMsg string
+	}{
+		{
+			name:   "within limits",
+			params: url.Values{"start": {"1700000000"}, "end": {"1700003600"}, "step": {"15"}},
+		},
+		{
+			name:   "rfc3339 and duration step",
+			params: url.Values{"start": {"2024-01-01T00:00:00Z"}, "end": {"2024-01-01T06:00:00Z"}, "step": {"1m"}},
+		},
+		{
+			name:   "loki nanosecond timestamps",
+			params: url.Values{"start": {"1700000000000000000"}, "end": {"1700003600000000000"}},
+		},
+		{
+			name:   "range too long",
+			params: url.Values{"start": {"1700000000"}, "end": {"1707776000"}, "step": {"60"}},
+			errMsg: "the query time range exceeds the limit (query length: 90d, limit: 1d)",
+		},
+		{
+			name:   "step too small",
+			params: url.Values{"start": {"1700000000"}, "end": {"1700003600"}, "step": {"1s"}},
+			errMsg: "the query step of 1s is below the minimum of 15s",
+		},
+		{
+			name:   "too many points",
+			params: url.Values{"start": {"1700000000"}, "end": {"1700086400"}, "step": {"5"}},
+			errMsg: "the query step of 5s is below the minimum of 15s",
+		},
+		{
+			name:   "negative step",
+			params: url.Values{"start": {"1700000000"}, "end": {"1700003600"}, "step": {"-1"}},
+			errMsg: "zero or negative query resolution step",
+		},
+		{
+			name:   "invalid start",
+			params: url.Values{"start": {"yesterday"}, "end": {"1700003600"}},
+			errMsg: `invalid parameter "start"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := l.CheckRange(tt.params)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestLimits_CheckRange_MaxPoints(t *testing.T) {
+	l := Limits{MaxPoints: 100}
+
+	err := l.CheckRange(url.Values{"start": {"0"}, "end": {"1000"}, "step": {"1"}})
+	if err == nil || !strings.Contains(err.Error(), "exceeded maximum resolution of 100 points") {
+		t.Errorf("expected max points error, got %v", err)
+	}
+
+	if err := l.CheckRange(url.Values{"start": {"0"}, "end": {"1000"}, "step": {"10"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLimits_CheckLogLimit(t *testing.T) {
+	l := Limits{MaxLogLimit: 5000}
+
+	tests := []struct {
+		limit   string
+		wantErr bool
+	}{
+		{"", false},
+		{"100", false},
+		{"5000", false},
+		{"5001", true},
+		{"lots", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			err := l.CheckLogLimit(url.Values{"limit": {tt.limit}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckLogLimit(%q) error = %v, wantErr %v", tt.limit, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolver_For(t *testing.T) {
+	r := NewResolver(
+		Limits{MaxRange: 24 * time.Hour, MaxQueryLength: 1000},
+		map[string]Limits{"prod-eu": {MaxRange: 6 * time.Hour, MinStep: 30 * time.Second}},
+		map[string]Limits{"batch": {MaxRange: 720 * time.Hour}},
+	)
+
+	tests := []struct {
+		name     string
+		identity string
+		cluster  string
+		expected Limits
+	}{
+		{
+			name:     "defaults",
+			identity: "grafana",
+			cluster:  "prod-us",
+			expected: Limits{MaxRange: 24 * time.Hour, MaxQueryLength: 1000},
+		},
+		{
+			name:     "cluster override",
+			identity: "grafana",
+			cluster:  "prod-eu",
+			expected: Limits{MaxRange: 6 * time.Hour, MinStep: 30 * time.Second, MaxQueryLength: 1000},
+		},
+		{
+			name:     "identity override wins",
+			identity: "batch",
+			cluster:  "prod-eu",
+			expected: Limits{MaxRange: 720 * time.Hour, MinStep: 30 * time.Second, MaxQueryLength: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.For(middleware.Identity{Name: tt.identity}, tt.cluster)
+			if got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+
+	var nilResolver *Resolver
+	if got := nilResolver.For(middleware.Identity{}, "prod-eu"); got != (Limits{}) {
+		t.Errorf("expected no limits from nil resolver, got %+v", got)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"1700000000", time.Unix(1700000000, 0)},
+		{"1700000000.5", time.Unix(1700000000, 500000000)},
+		{"1700000000123456789", time.Unix(0, 1700000000123456789)},
+		{"2024-01-01T00:00:00Z", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseTime(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
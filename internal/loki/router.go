@@ -6,13 +6,27 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/rs/zerolog/log"
-
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tjorri/observability-federation-proxy/internal/audit"
+	"github.com/tjorri/observability-federation-proxy/internal/cache"
+	"github.com/tjorri/observability-federation-proxy/internal/limits"
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+	"github.com/tjorri/observability-federation-proxy/internal/policy"
 	"github.com/tjorri/observability-federation-proxy/internal/proxy"
+	"github.com/tjorri/observability-federation-proxy/internal/redact"
 	"github.com/tjorri/observability-federation-proxy/internal/tenant"
 )
 
+var tracer = otel.Tracer("github.com/tjorri/observability-federation-proxy/internal/loki")
+
 // ProxyClient defines the interface for proxying HTTP requests.
 type ProxyClient interface {
 	ProxyHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request, pathPrefix string, opts *proxy.HTTPOptions)
@@ -23,6 +37,12 @@ type Router struct {
 	clients        map[string]ProxyClient
 	tenantRegistry *tenant.Registry
 	maxOrgIDLength int
+	labelPolicy    *policy.LabelPolicy
+	endpointPolicy *policy.EndpointPolicy
+	limits         *limits.Resolver
+	resultsCache   *cache.ResultsCache
+	metadataCache  *cache.MetadataCache
+	redactor       *redact.Redactor
 }
 
 // RouterConfig holds configuration for creating a Loki router.
@@ -30,6 +50,21 @@ type RouterConfig struct {
 	Clients        map[string]ProxyClient
 	TenantRegistry *tenant.Registry
 	MaxOrgIDLength int
+	LabelPolicy    *policy.LabelPolicy
+	// EndpointPolicy restricts the paths reachable through the catch-all
+	// route. A nil policy allows every path.
+	EndpointPolicy *policy.EndpointPolicy
+	// Limits resolves the query guardrails for each caller. A nil resolver
+	// applies no limits.
+	Limits *limits.Resolver
+	// ResultsCache caches range query results. A nil cache disables caching.
+	ResultsCache *cache.ResultsCache
+	// MetadataCache caches label names and values. A nil cache disables
+	// caching.
+	MetadataCache *cache.MetadataCache
+	// Redactor masks sensitive data in query, tail, series and label values
+	// responses. A nil redactor leaves responses unchanged.
+	Redactor *redact.Redactor
 }
 
 // NewRouter creates a new Loki router.
@@ -38,6 +73,12 @@ func NewRouter(cfg RouterConfig) *Router {
 		clients:        cfg.Clients,
 		tenantRegistry: cfg.TenantRegistry,
 		maxOrgIDLength: cfg.MaxOrgIDLength,
+		labelPolicy:    cfg.LabelPolicy,
+		endpointPolicy: cfg.EndpointPolicy,
+		limits:         cfg.Limits,
+		resultsCache:   cfg.ResultsCache,
+		metadataCache:  cfg.MetadataCache,
+		redactor:       cfg.Redactor,
 	}
 }
 
@@ -81,29 +122,37 @@ func (r *Router) handleQuery(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or loki not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or loki not configured")
 		return
 	}
 
 	// Parse query parameter (can be in URL or form body)
 	if err := req.ParseForm(); err != nil {
-		r.writeError(w, http.StatusBadRequest, "failed to parse form")
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
 		return
 	}
 
 	query := req.Form.Get("query")
 	if query == "" {
-		r.writeError(w, http.StatusBadRequest, "missing required parameter: query")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameter: query")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("query", query).
 		Str("time", req.Form.Get("time")).
 		Msg("loki query request")
 
-	r.proxyRequest(w, req, clusterName, client)
+	if !r.checkLimits(w, req, clusterName, false) {
+		return
+	}
+
+	if !r.enforceLabelPolicy(w, req, clusterName, false) {
+		return
+	}
+
+	r.proxyRedacted(w, req, clusterName, client)
 }
 
 // handleQueryRange handles /api/v1/query_range requests.
@@ -114,29 +163,29 @@ func (r *Router) handleQueryRange(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or loki not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or loki not configured")
 		return
 	}
 
 	if err := req.ParseForm(); err != nil {
-		r.writeError(w, http.StatusBadRequest, "failed to parse form")
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
 		return
 	}
 
 	query := req.Form.Get("query")
 	if query == "" {
-		r.writeError(w, http.StatusBadRequest, "missing required parameter: query")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameter: query")
 		return
 	}
 
 	start := req.Form.Get("start")
 	end := req.Form.Get("end")
 	if start == "" || end == "" {
-		r.writeError(w, http.StatusBadRequest, "missing required parameters: start and end")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameters: start and end")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("query", query).
 		Str("start", start).
@@ -144,7 +193,15 @@ func (r *Router) handleQueryRange(w http.ResponseWriter, req *http.Request) {
 		Str("step", req.Form.Get("step")).
 		Msg("loki query_range request")
 
-	r.proxyRequest(w, req, clusterName, client)
+	if !r.checkLimits(w, req, clusterName, true) {
+		return
+	}
+
+	if !r.enforceLabelPolicy(w, req, clusterName, false) {
+		return
+	}
+
+	r.proxyCached(w, req, clusterName, client)
 }
 
 // handleLabels handles /api/v1/labels requests.
@@ -155,15 +212,19 @@ func (r *Router) handleLabels(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or loki not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or loki not configured")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Msg("loki labels request")
 
-	r.proxyRequest(w, req, clusterName, client)
+	if !r.enforceLabelPolicy(w, req, clusterName, true) {
+		return
+	}
+
+	r.proxyMetadata(w, req, clusterName, client)
 }
 
 // handleLabelValues handles /api/v1/label/{name}/values requests.
@@ -175,21 +236,28 @@ func (r *Router) handleLabelValues(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or loki not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or loki not configured")
 		return
 	}
 
 	if labelName == "" {
-		r.writeError(w, http.StatusBadRequest, "missing label name")
+		r.writeError(w, req, http.StatusBadRequest, "missing label name")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("label", labelName).
 		Msg("loki label values request")
 
-	r.proxyRequest(w, req, clusterName, client)
+	if !r.enforceLabelPolicy(w, req, clusterName, true) {
+		return
+	}
+
+	redactFn := func(body []byte, identity middleware.Identity, tenants []string) ([]byte, error) {
+		return r.redactor.RedactLabelValues(body, labelName, identity, tenants)
+	}
+	r.proxyRedactedWith(w, req, clusterName, client, redactFn, r.proxyMetadataWithOptions)
 }
 
 // handleSeries handles /api/v1/series requests.
@@ -200,27 +268,31 @@ func (r *Router) handleSeries(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or loki not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or loki not configured")
 		return
 	}
 
 	if err := req.ParseForm(); err != nil {
-		r.writeError(w, http.StatusBadRequest, "failed to parse form")
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
 		return
 	}
 
 	matches := req.Form["match[]"]
 	if len(matches) == 0 {
-		r.writeError(w, http.StatusBadRequest, "missing required parameter: match[]")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameter: match[]")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Strs("match", matches).
 		Msg("loki series request")
 
-	r.proxyRequest(w, req, clusterName, client)
+	if !r.enforceLabelPolicy(w, req, clusterName, false) {
+		return
+	}
+
+	r.proxyRedactedWith(w, req, clusterName, client, r.redactor.RedactSeries, r.proxyWithOptions)
 }
 
 // handleIndexStats handles /api/v1/index/stats requests.
@@ -229,14 +301,18 @@ func (r *Router) handleIndexStats(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or loki not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or loki not configured")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Msg("loki index stats request")
 
+	if !r.enforceLabelPolicy(w, req, clusterName, false) {
+		return
+	}
+
 	r.proxyRequest(w, req, clusterName, client)
 }
 
@@ -247,27 +323,35 @@ func (r *Router) handleTail(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or loki not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or loki not configured")
 		return
 	}
 
 	if err := req.ParseForm(); err != nil {
-		r.writeError(w, http.StatusBadRequest, "failed to parse form")
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
 		return
 	}
 
 	query := req.Form.Get("query")
 	if query == "" {
-		r.writeError(w, http.StatusBadRequest, "missing required parameter: query")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameter: query")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("query", query).
 		Msg("loki tail request")
 
-	r.proxyRequest(w, req, clusterName, client)
+	if !r.checkLimits(w, req, clusterName, false) {
+		return
+	}
+
+	if !r.enforceLabelPolicy(w, req, clusterName, false) {
+		return
+	}
+
+	r.proxyRedacted(w, req, clusterName, client)
 }
 
 // handleGenericProxy handles any other Loki API requests.
@@ -276,7 +360,7 @@ func (r *Router) handleGenericProxy(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or loki not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or loki not configured")
 		return
 	}
 
@@ -287,35 +371,323 @@ func (r *Router) handleGenericProxy(w http.ResponseWriter, req *http.Request) {
 		path = "/"
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("path", path).
 		Msg("loki generic proxy request")
 
+	identity := middleware.IdentityFromContext(req.Context())
+	if !r.endpointPolicy.Allowed(identity, req.Method, path) {
+		log.Ctx(req.Context()).Info().
+			Str("cluster", clusterName).
+			Str("identity", identity.Name).
+			Str("method", req.Method).
+			Str("path", path).
+			Msg("loki request blocked by endpoint policy")
+		metrics.BlockedRequestsTotal.WithLabelValues(clusterName, "loki", "endpoint").Inc()
+		r.writeError(w, req, http.StatusForbidden, "endpoint not permitted")
+		return
+	}
+
+	if len(r.labelMatchers(req, clusterName)) > 0 {
+		metrics.BlockedRequestsTotal.WithLabelValues(clusterName, "loki", "label").Inc()
+		r.writeError(w, req, http.StatusForbidden, "endpoint not permitted for callers with label restrictions")
+		return
+	}
+
 	r.proxyRequest(w, req, clusterName, client)
 }
 
+// checkLimits validates the query against the caller's guardrails before
+// any label policy rewriting. It returns false if an error response has been
+// written.
+func (r *Router) checkLimits(w http.ResponseWriter, req *http.Request, clusterName string, rangeQuery bool) bool {
+	l := r.limits.For(middleware.IdentityFromContext(req.Context()), clusterName)
+
+	err := l.CheckQuery(req.Form.Get("query"))
+	if err == nil {
+		err = l.CheckLogLimit(req.Form)
+	}
+	if err == nil && rangeQuery {
+		err = l.CheckRange(req.Form)
+	}
+	if err != nil {
+		metrics.BlockedRequestsTotal.WithLabelValues(clusterName, "loki", "limits").Inc()
+		r.writeBadData(w, req, err.Error())
+		return false
+	}
+	return true
+}
+
+// labelMatchers returns the label matchers enforced for the caller by the label policy.
+func (r *Router) labelMatchers(req *http.Request, clusterName string) []*labels.Matcher {
+	return r.labelPolicy.Matchers(middleware.IdentityFromContext(req.Context()), clusterName)
+}
+
+// enforceLabelPolicy rewrites the query and match[] parameters so that every
+// stream selector carries the caller's mandatory label matchers. When
+// ensureQuery is set, a query selector is added even if the request had none,
+// so the labels endpoints cannot leak labels through autocomplete. It returns
+// false if an error response has been written.
+func (r *Router) enforceLabelPolicy(w http.ResponseWriter, req *http.Request, clusterName string, ensureQuery bool) bool {
+	matchers := r.labelMatchers(req, clusterName)
+	if len(matchers) == 0 {
+		return true
+	}
+
+	if err := req.ParseForm(); err != nil {
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
+		return false
+	}
+
+	if query := req.Form.Get("query"); query != "" {
+		rewritten, err := policy.RewriteLogQL(query, matchers)
+		if err != nil {
+			r.writeError(w, req, http.StatusBadRequest, fmt.Sprintf("failed to parse query: %v", err))
+			return false
+		}
+		req.Form.Set("query", rewritten)
+	} else if ensureQuery {
+		req.Form.Set("query", policy.LogSelectorString(matchers))
+	}
+
+	if selectors := req.Form["match[]"]; len(selectors) > 0 {
+		rewritten := make([]string, 0, len(selectors))
+		for _, selector := range selectors {
+			s, err := policy.RewriteLogQL(selector, matchers)
+			if err != nil {
+				r.writeError(w, req, http.StatusBadRequest, fmt.Sprintf("failed to parse selector: %v", err))
+				return false
+			}
+			rewritten = append(rewritten, s)
+		}
+		req.Form["match[]"] = rewritten
+	}
+
+	return true
+}
+
+// proxyFunc proxies a request with the given proxy options.
+type proxyFunc func(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient, opts *proxy.HTTPOptions)
+
+// redactFunc redacts a response body for the caller. tenants lists the
+// tenants the request was sent for.
+type redactFunc func(body []byte, identity middleware.Identity, tenants []string) ([]byte, error)
+
 // proxyRequest proxies a request to the Loki backend.
 func (r *Router) proxyRequest(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient) {
+	// Build proxy options with X-Scope-OrgID header
+	opts, err := r.buildProxyOptions(req.Context(), clusterName)
+	if err != nil {
+		r.writeError(w, req, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	r.proxyWithOptions(w, req, clusterName, client, opts)
+}
+
+// proxyWithOptions proxies a request to the Loki backend with resolved proxy
+// options.
+func (r *Router) proxyWithOptions(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient, opts *proxy.HTTPOptions) {
 	// Build path prefix for stripping
 	pathPrefix := fmt.Sprintf("/clusters/%s/loki", clusterName)
 
-	// Build proxy options with X-Scope-OrgID header
-	opts := r.buildProxyOptions(clusterName)
+	// Record request details for the audit log
+	params := req.Form
+	if params == nil {
+		params = req.URL.Query()
+	}
+	var orgID string
+	if opts != nil {
+		orgID = opts.AdditionalHeaders.Get("X-Scope-OrgID")
+	}
+	audit.Annotate(req.Context(), "loki", clusterName, params, orgID)
 
 	// Pass the original request (don't clone) to preserve parsed form data
 	client.ProxyHTTP(req.Context(), w, req, pathPrefix, opts)
 }
 
-// buildProxyOptions builds proxy options with tenant headers.
-func (r *Router) buildProxyOptions(clusterName string) *proxy.HTTPOptions {
+// proxyRedacted proxies a request whose response contains log streams, and
+// applies the caller's redaction rules to it.
+func (r *Router) proxyRedacted(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient) {
+	r.proxyRedactedWith(w, req, clusterName, client, r.redactor.Redact, r.proxyWithOptions)
+}
+
+// proxyRedactedWith proxies a request through proxyFn and applies the
+// caller's redaction rules to the response with redactFn. Responses that
+// cannot be redacted are not forwarded.
+func (r *Router) proxyRedactedWith(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient, redactFn redactFunc, proxyFn proxyFunc) {
+	opts, err := r.buildProxyOptions(req.Context(), clusterName)
+	if err != nil {
+		r.writeError(w, req, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	identity := middleware.IdentityFromContext(req.Context())
+	if !r.redactor.Applies(identity) {
+		proxyFn(w, req, clusterName, client, opts)
+		return
+	}
+
+	buf := proxy.NewBufferedResponseWriter()
+	proxyFn(buf, req, clusterName, client, opts)
+
+	if buf.StatusCode >= 200 && buf.StatusCode < 300 {
+		var tenants []string
+		if opts != nil {
+			tenants = strings.Split(opts.AdditionalHeaders.Get("X-Scope-OrgID"), "|")
+		}
+
+		body, err := redactFn(buf.Body.Bytes(), identity, tenants)
+		if err != nil {
+			log.Ctx(req.Context()).Error().Err(err).Str("cluster", clusterName).Msg("failed to redact loki response")
+			r.writeError(w, req, http.StatusBadGateway, "failed to redact response")
+			return
+		}
+		buf.Body.Reset()
+		buf.Body.Write(body)
+	}
+
+	buf.CopyTo(w)
+}
+
+// proxyCached answers a metric range query through the results cache. Log
+// queries and queries that cannot be cached are proxied directly.
+func (r *Router) proxyCached(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient) {
+	// Log queries start with a stream selector, possibly in parentheses;
+	// only metric queries return matrices
+	normalized := strings.TrimSpace(req.Form.Get("query"))
+	if r.resultsCache == nil || strings.HasPrefix(strings.TrimLeft(normalized, "( \t\n"), "{") || !cache.SplittableLogQL(normalized) {
+		r.proxyRedacted(w, req, clusterName, client)
+		return
+	}
+
+	pathPrefix := fmt.Sprintf("/clusters/%s/loki", clusterName)
+	opts, err := r.buildProxyOptions(req.Context(), clusterName)
+	if err != nil {
+		r.writeError(w, req, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	var orgID string
+	if opts != nil {
+		orgID = opts.AdditionalHeaders.Get("X-Scope-OrgID")
+	}
+
+	q, err := cache.ParseRangeQuery(cache.Key(clusterName, orgID, normalized, req.Form), req.Form)
+	if err != nil {
+		r.proxyRedacted(w, req, clusterName, client)
+		return
+	}
+
+	audit.Annotate(req.Context(), "loki", clusterName, req.Form, orgID)
+
+	ctx, span := tracer.Start(req.Context(), "results cache")
+	defer span.End()
+	resp, err := r.resultsCache.Do(ctx, q, func(ctx context.Context, start, end time.Time) (cache.Response, error) {
+		sub := req.Clone(ctx)
+		sub.Form.Set("start", cache.FormatTime(start))
+		sub.Form.Set("end", cache.FormatTime(end))
+
+		buf := proxy.NewBufferedResponseWriter()
+		client.ProxyHTTP(ctx, buf, sub, pathPrefix, opts)
+		return cache.Response{StatusCode: buf.StatusCode, Body: buf.Body.Bytes()}, nil
+	})
+	if err != nil {
+		r.writeError(w, req, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	// The cache keeps unredacted results shared by all callers, and passes
+	// through responses it cannot cache, such as streams of log queries it
+	// did not recognize
+	identity := middleware.IdentityFromContext(req.Context())
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && r.redactor.Applies(identity) {
+		var tenants []string
+		if orgID != "" {
+			tenants = strings.Split(orgID, "|")
+		}
+		body, err := r.redactor.Redact(resp.Body, identity, tenants)
+		if err != nil {
+			log.Ctx(req.Context()).Error().Err(err).Str("cluster", clusterName).Msg("failed to redact loki response")
+			r.writeError(w, req, http.StatusBadGateway, "failed to redact response")
+			return
+		}
+		resp.Body = body
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+// proxyMetadata answers a label names or values request through the metadata
+// cache, falling back to a plain proxy request when caching is disabled.
+func (r *Router) proxyMetadata(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient) {
+	opts, err := r.buildProxyOptions(req.Context(), clusterName)
+	if err != nil {
+		r.writeError(w, req, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	r.proxyMetadataWithOptions(w, req, clusterName, client, opts)
+}
+
+// proxyMetadataWithOptions is proxyMetadata with resolved proxy options.
+func (r *Router) proxyMetadataWithOptions(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient, opts *proxy.HTTPOptions) {
+	if r.metadataCache == nil {
+		r.proxyWithOptions(w, req, clusterName, client, opts)
+		return
+	}
+
+	if err := req.ParseForm(); err != nil {
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	pathPrefix := fmt.Sprintf("/clusters/%s/loki", clusterName)
+	var orgID string
+	if opts != nil {
+		orgID = opts.AdditionalHeaders.Get("X-Scope-OrgID")
+	}
+
+	audit.Annotate(req.Context(), "loki", clusterName, req.Form, orgID)
+
+	// Snapshot the request, as stale entries are refreshed after this handler returns
+	sub := req.Clone(req.Context())
+	key := r.metadataCache.Key(strings.TrimPrefix(req.URL.Path, pathPrefix), orgID, req.Form)
+
+	ctx, span := tracer.Start(req.Context(), "metadata cache")
+	defer span.End()
+	resp, err := r.metadataCache.Do(ctx, clusterName, key, func(ctx context.Context) (cache.Response, error) {
+		buf := proxy.NewBufferedResponseWriter()
+		client.ProxyHTTP(ctx, buf, sub.WithContext(ctx), pathPrefix, opts)
+		return cache.Response{StatusCode: buf.StatusCode, Body: buf.Body.Bytes()}, nil
+	})
+	if err != nil {
+		r.writeError(w, req, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+// buildProxyOptions builds proxy options with tenant headers. It fails if
+// the cluster's tenants must be synced before it is queried.
+func (r *Router) buildProxyOptions(ctx context.Context, clusterName string) (*proxy.HTTPOptions, error) {
 	if r.tenantRegistry == nil {
-		return nil
+		return nil, nil
+	}
+	if err := r.tenantRegistry.CheckSynced(clusterName); err != nil {
+		return nil, err
 	}
 
+	_, span := tracer.Start(ctx, "resolve tenants", trace.WithAttributes(attribute.String("cluster", clusterName)))
 	orgID := r.tenantRegistry.BuildOrgIDHeader(clusterName, r.maxOrgIDLength)
+	span.End()
 	if orgID == "" {
-		return nil
+		return nil, nil
 	}
 
 	headers := make(http.Header)
@@ -323,19 +695,32 @@ func (r *Router) buildProxyOptions(clusterName string) *proxy.HTTPOptions {
 
 	return &proxy.HTTPOptions{
 		AdditionalHeaders: headers,
-	}
+	}, nil
 }
 
-// writeError writes a JSON error response.
-func (r *Router) writeError(w http.ResponseWriter, statusCode int, message string) {
+// writeBadData writes a Prometheus-style bad_data error response, which
+// Grafana displays as a query error.
+func (r *Router) writeBadData(w http.ResponseWriter, req *http.Request, message string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(Response{
+		Status:    "error",
+		ErrorType: "bad_data",
+		Error:     message,
+		RequestID: middleware.RequestIDFromContext(req.Context()),
+	})
+}
+
+// writeError writes a JSON error response.
+func (r *Router) writeError(w http.ResponseWriter, req *http.Request, statusCode int, message string) {
+	middleware.WriteError(req.Context(), w, statusCode, message)
 }
 
 // Response represents a standard Loki API response.
 type Response struct {
-	Status string      `json:"status"`
-	Data   interface{} `json:"data,omitempty"`
-	Error  string      `json:"error,omitempty"`
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
 }
@@ -3,13 +3,20 @@ package loki
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/tjorri/observability-federation-proxy/internal/cache"
+	"github.com/tjorri/observability-federation-proxy/internal/limits"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+	"github.com/tjorri/observability-federation-proxy/internal/policy"
 	"github.com/tjorri/observability-federation-proxy/internal/proxy"
+	"github.com/tjorri/observability-federation-proxy/internal/redact"
 )
 
 // mockProxyClient implements ProxyClient for testing.
@@ -511,3 +518,561 @@ func TestRouter_Tail_Success(t *testing.T) {
 		t.Errorf("expected status 200, got %d", w.Code)
 	}
 }
+
+func newLabelPolicyRouter(t *testing.T, mockClient *mockProxyClient) *http.ServeMux {
+	t.Helper()
+
+	labelPolicy, err := policy.NewLabelPolicy([]policy.LabelRule{
+		{Name: "payments", Identities: []string{"carol"}, Matchers: []string{`app=~"payments-.*"`}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create label policy: %v", err)
+	}
+
+	router := NewRouter(RouterConfig{
+		Clients: map[string]ProxyClient{
+			"test-cluster": mockClient,
+		},
+		LabelPolicy: labelPolicy,
+	})
+
+	mux := http.NewServeMux()
+	router.RegisterRoutes(mux, "/clusters/{cluster}/loki")
+	return mux
+}
+
+func withIdentity(req *http.Request, name string) *http.Request {
+	return req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{Name: name}))
+}
+
+func TestRouter_LabelPolicy_RewritesParams(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		param         string
+		expectedValue string
+	}{
+		{
+			name:          "query",
+			path:          `/clusters/test-cluster/loki/api/v1/query_range?query=sum(rate({job="api"}[5m]))&start=1&end=2`,
+			param:         "query",
+			expectedValue: `sum(rate({job="api", app=~"payments-.*"}[5m]))`,
+		},
+		{
+			name:          "labels without query",
+			path:          "/clusters/test-cluster/loki/api/v1/labels",
+			param:         "query",
+			expectedValue: `{app=~"payments-.*"}`,
+		},
+		{
+			name:          "label values with query",
+			path:          `/clusters/test-cluster/loki/api/v1/label/job/values?query={env="prod"}`,
+			param:         "query",
+			expectedValue: `{env="prod", app=~"payments-.*"}`,
+		},
+		{
+			name:          "series",
+			path:          `/clusters/test-cluster/loki/api/v1/series?match[]={job="api"}`,
+			param:         "match[]",
+			expectedValue: `{job="api", app=~"payments-.*"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &mockProxyClient{}
+			mux := newLabelPolicyRouter(t, mockClient)
+
+			req := withIdentity(httptest.NewRequest(http.MethodGet, tt.path, nil), "carol")
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d; body: %s", w.Code, w.Body.String())
+			}
+			if got := mockClient.lastForm.Get(tt.param); got != tt.expectedValue {
+				t.Errorf("expected %s=%s, got %s", tt.param, tt.expectedValue, got)
+			}
+		})
+	}
+}
+
+func TestRouter_LabelPolicy_DeniesGenericProxy(t *testing.T) {
+	mux := newLabelPolicyRouter(t, &mockProxyClient{})
+
+	req := withIdentity(httptest.NewRequest(http.MethodGet, "/clusters/test-cluster/loki/api/v1/detected_labels", nil), "carol")
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", w.Code)
+	}
+
+	// Unrestricted callers can still use the generic proxy
+	req = withIdentity(httptest.NewRequest(http.MethodGet, "/clusters/test-cluster/loki/api/v1/detected_labels", nil), "admin")
+	w = httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+}
+
+func TestRouter_EndpointPolicy(t *testing.T) {
+	endpointPolicy, err := policy.NewEndpointPolicy(append([]policy.EndpointRule{
+		{Name: "operators", Action: policy.ActionAllow, Identities: []string{"oncall"}, Paths: []string{"/**"}},
+	}, policy.DefaultLokiEndpointRules...))
+	if err != nil {
+		t.Fatalf("failed to create endpoint policy: %v", err)
+	}
+
+	router := NewRouter(RouterConfig{
+		Clients: map[string]ProxyClient{
+			"test-cluster": &mockProxyClient{},
+		},
+		EndpointPolicy: endpointPolicy,
+	})
+
+	mux := http.NewServeMux()
+	router.RegisterRoutes(mux, "/clusters/{cluster}/loki")
+
+	tests := []struct {
+		name           string
+		identity       string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"read endpoint", "grafana", http.MethodGet, "/clusters/test-cluster/loki/api/v1/status/buildinfo", http.StatusOK},
+		{"push", "grafana", http.MethodPost, "/clusters/test-cluster/loki/api/v1/push", http.StatusForbidden},
+		{"flush", "grafana", http.MethodPost, "/clusters/test-cluster/loki/flush", http.StatusForbidden},
+		{"operator exception", "oncall", http.MethodPost, "/clusters/test-cluster/loki/flush", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req = req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{Name: tt.identity}))
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_Limits(t *testing.T) {
+	router := NewRouter(RouterConfig{
+		Clients: map[string]ProxyClient{
+			"test-cluster": &mockProxyClient{},
+		},
+		Limits: limits.NewResolver(
+			limits.Limits{MaxRange: 24 * time.Hour, MinStep: 15 * time.Second, MaxQueryLength: 100, MaxLogLimit: 5000},
+			nil,
+			map[string]limits.Limits{"batch": {MaxRange: 2160 * time.Hour}},
+		),
+	})
+
+	mux := http.NewServeMux()
+	router.RegisterRoutes(mux, "/clusters/{cluster}/loki")
+
+	tests := []struct {
+		name           string
+		identity       string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "within limits",
+			path:           `/clusters/test-cluster/loki/api/v1/query_range?query={job="api"}&start=1700000000&end=1700003600&step=15`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "range too long",
+			path:           `/clusters/test-cluster/loki/api/v1/query_range?query={job="api"}&start=1700000000&end=1707776000&step=3600`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "identity override",
+			identity:       "batch",
+			path:           `/clusters/test-cluster/loki/api/v1/query_range?query={job="api"}&start=1700000000&end=1707776000&step=3600`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "step too small",
+			path:           `/clusters/test-cluster/loki/api/v1/query_range?query={job="api"}&start=1700000000&end=1700003600&step=1`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "query too long",
+			path:           "/clusters/test-cluster/loki/api/v1/query?query=" + strings.Repeat("a", 101),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "limit too high",
+			path:           `/clusters/test-cluster/loki/api/v1/query?query={job="api"}&limit=10000`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req = req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{Name: tt.identity}))
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d; body: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusBadRequest {
+				return
+			}
+
+			var resp map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp["status"] != "error" || resp["errorType"] != "bad_data" || resp["error"] == "" {
+				t.Errorf("expected bad_data error response, got %v", resp)
+			}
+		})
+	}
+}
+
+func TestRouter_Redaction(t *testing.T) {
+	redactor, err := redact.NewRedactor([]redact.Rule{
+		{Name: "emails", Pattern: `[a-z]+@example\.com`, Lines: true, Labels: []string{"user"}, ExemptGroups: []string{"payments"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create redactor: %v", err)
+	}
+
+	streams := []byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"api"},"values":[["1","login jane@example.com"]]}]}}`)
+
+	tests := []struct {
+		name       string
+		groups     []string
+		path       string
+		response   []byte
+		statusCode int
+		redacted   bool
+	}{
+		{
+			name:     "query_range is redacted",
+			path:     `/clusters/test-cluster/loki/api/v1/query_range?query={app="api"}&start=1&end=2`,
+			redacted: true,
+		},
+		{
+			name:     "tail is redacted",
+			path:     `/clusters/test-cluster/loki/api/v1/tail?query={app="api"}`,
+			redacted: true,
+		},
+		{
+			name:     "series is redacted",
+			path:     `/clusters/test-cluster/loki/api/v1/series?match[]={app="api"}`,
+			response: []byte(`{"status":"success","data":[{"app":"api","user":"jane@example.com"}]}`),
+			redacted: true,
+		},
+		{
+			name:     "label values are redacted",
+			path:     `/clusters/test-cluster/loki/api/v1/label/user/values`,
+			response: []byte(`{"status":"success","data":["jane@example.com","system"]}`),
+			redacted: true,
+		},
+		{
+			name:     "exempt group is not redacted",
+			groups:   []string{"payments"},
+			path:     `/clusters/test-cluster/loki/api/v1/query?query={app="api"}`,
+			redacted: false,
+		},
+		{
+			name:       "error responses are passed through",
+			path:       `/clusters/test-cluster/loki/api/v1/query?query={app="api"}`,
+			statusCode: http.StatusInternalServerError,
+			redacted:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := tt.response
+			if response == nil {
+				response = streams
+			}
+			router := NewRouter(RouterConfig{
+				Clients: map[string]ProxyClient{
+					"test-cluster": &mockProxyClient{response: response, statusCode: tt.statusCode},
+				},
+				Redactor: redactor,
+			})
+
+			mux := http.NewServeMux()
+			router.RegisterRoutes(mux, "/clusters/{cluster}/loki")
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req = req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{Name: "grafana", Groups: tt.groups}))
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			leaked := strings.Contains(w.Body.String(), "jane@example.com")
+			if leaked == tt.redacted {
+				t.Errorf("expected redacted=%v, got body %s", tt.redacted, w.Body.String())
+			}
+			if tt.statusCode != 0 && w.Code != tt.statusCode {
+				t.Errorf("expected status %d, got %d", tt.statusCode, w.Code)
+			}
+		})
+	}
+}
+
+// matrixProxyClient returns a single-series matrix for the requested range.
+type matrixProxyClient struct {
+	calls int
+	// metric is the label set of the series, {"app":"api"} if empty
+	metric string
+}
+
+func (m *matrixProxyClient) ProxyHTTP(_ context.Context, w http.ResponseWriter, r *http.Request, _ string, _ *proxy.HTTPOptions) {
+	m.calls++
+
+	metric := m.metric
+	if metric == "" {
+		metric = `{"app":"api"}`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":%s,"values":[[%s,"1"]]}]}}`,
+		metric, r.Form.Get("start"))
+}
+
+func TestRouter_ResultsCache(t *testing.T) {
+	resultsCache, err := cache.NewResultsCache(cache.ResultsCacheConfig{
+		Cache:   cache.NewLRU("test", 1<<20),
+		Backend: "loki",
+	})
+	if err != nil {
+		t.Fatalf("failed to create results cache: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedCalls int
+	}{
+		{
+			name:          "metric query is cached",
+			query:         `sum(count_over_time({app="api"}[5m]))`,
+			expectedCalls: 1,
+		},
+		{
+			name:          "log query is not cached",
+			query:         `{app="api"} |= "error"`,
+			expectedCalls: 2,
+		},
+		{
+			name:          "query with @ end() is not cached",
+			query:         `sum(count_over_time({app="api"}[5m] @ end()))`,
+			expectedCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &matrixProxyClient{}
+			router := NewRouter(RouterConfig{
+				Clients:      map[string]ProxyClient{"test-cluster": client},
+				ResultsCache: resultsCache,
+			})
+
+			mux := http.NewServeMux()
+			router.RegisterRoutes(mux, "/clusters/{cluster}/loki")
+
+			path := "/clusters/test-cluster/loki/api/v1/query_range?" + url.Values{
+				"query": {tt.query},
+				"start": {"1700000000000000000"},
+				"end":   {"1700003600000000000"},
+				"step":  {"60s"},
+			}.Encode()
+
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				if w.Code != http.StatusOK {
+					t.Fatalf("expected status 200, got %d; body: %s", w.Code, w.Body.String())
+				}
+			}
+
+			if client.calls != tt.expectedCalls {
+				t.Errorf("expected %d upstream requests, got %d", tt.expectedCalls, client.calls)
+			}
+		})
+	}
+}
+
+func TestRouter_ResultsCache_Redaction(t *testing.T) {
+	redactor, err := redact.NewRedactor([]redact.Rule{
+		{Name: "emails", Pattern: `[a-z]+@example\.com`, Lines: true, Labels: []string{"user"}, ExemptGroups: []string{"payments"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create redactor: %v", err)
+	}
+	resultsCache, err := cache.NewResultsCache(cache.ResultsCacheConfig{
+		Cache:   cache.NewLRU("test", 1<<20),
+		Backend: "loki",
+	})
+	if err != nil {
+		t.Fatalf("failed to create results cache: %v", err)
+	}
+
+	streams := []byte(`{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"api"},"values":[["1","login jane@example.com"]]}]}}`)
+
+	tests := []struct {
+		name   string
+		query  string
+		client ProxyClient
+	}{
+		{
+			name:   "parenthesised log query",
+			query:  `({app="api"} |= "login")`,
+			client: &mockProxyClient{response: streams},
+		},
+		{
+			name:   "streams response on the cached path",
+			query:  `last_over_time({app="api"}[5m])`,
+			client: &mockProxyClient{response: streams},
+		},
+		{
+			name:   "metric labels",
+			query:  `sum by (user) (count_over_time({app="api"} | json [5m]))`,
+			client: &matrixProxyClient{metric: `{"user":"jane@example.com"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter(RouterConfig{
+				Clients:      map[string]ProxyClient{"test-cluster": tt.client},
+				ResultsCache: resultsCache,
+				Redactor:     redactor,
+			})
+
+			mux := http.NewServeMux()
+			router.RegisterRoutes(mux, "/clusters/{cluster}/loki")
+
+			path := "/clusters/test-cluster/loki/api/v1/query_range?" + url.Values{
+				"query": {tt.query},
+				"start": {"1700000000000000000"},
+				"end":   {"1700003600000000000"},
+				"step":  {"60s"},
+			}.Encode()
+
+			// Cache misses and hits are redacted, but the cache keeps the
+			// original results for exempt callers
+			for _, groups := range [][]string{nil, nil, {"payments"}} {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req = req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{Name: "grafana", Groups: groups}))
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Fatalf("expected status 200, got %d; body: %s", w.Code, w.Body.String())
+				}
+
+				leaked := strings.Contains(w.Body.String(), "jane@example.com")
+				if exempt := groups != nil; leaked != exempt {
+					t.Errorf("expected redacted=%v for groups %v, got body %s", !exempt, groups, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+// countingProxyClient returns a fixed label list and counts upstream requests.
+type countingProxyClient struct {
+	calls int
+}
+
+func (m *countingProxyClient) ProxyHTTP(_ context.Context, w http.ResponseWriter, _ *http.Request, _ string, _ *proxy.HTTPOptions) {
+	m.calls++
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"success","data":["job"]}`))
+}
+
+func TestRouter_MetadataCache(t *testing.T) {
+	metadataCache, err := cache.NewMetadataCache(cache.MetadataCacheConfig{
+		Cache:   cache.NewLRU("test", 1<<20),
+		Backend: "loki",
+	})
+	if err != nil {
+		t.Fatalf("failed to create metadata cache: %v", err)
+	}
+
+	client := &countingProxyClient{}
+	router := NewRouter(RouterConfig{
+		Clients:       map[string]ProxyClient{"test-cluster": client},
+		MetadataCache: metadataCache,
+	})
+
+	mux := http.NewServeMux()
+	router.RegisterRoutes(mux, "/clusters/{cluster}/loki")
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedCalls int
+	}{
+		{
+			name:          "miss",
+			path:          "/clusters/test-cluster/loki/api/v1/labels?start=1700000000&end=1700003600",
+			expectedCalls: 1,
+		},
+		{
+			name:          "hit within the same minute",
+			path:          "/clusters/test-cluster/loki/api/v1/labels?start=1700000010&end=1700003610",
+			expectedCalls: 1,
+		},
+		{
+			name:          "different selector",
+			path:          "/clusters/test-cluster/loki/api/v1/labels?query=%7Bjob=%22api%22%7D&start=1700000000&end=1700003600",
+			expectedCalls: 2,
+		},
+		{
+			name:          "label values",
+			path:          "/clusters/test-cluster/loki/api/v1/label/job/values?start=1700000000&end=1700003600",
+			expectedCalls: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d; body: %s", tt.name, w.Code, w.Body.String())
+		}
+		if w.Body.String() != `{"status":"success","data":["job"]}` {
+			t.Errorf("%s: unexpected body: %s", tt.name, w.Body.String())
+		}
+		if client.calls != tt.expectedCalls {
+			t.Errorf("%s: expected %d upstream requests, got %d", tt.name, tt.expectedCalls, client.calls)
+		}
+	}
+
+	// A tenant change invalidates the cluster's entries
+	metadataCache.Invalidate("test-cluster")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tests[0].path, nil))
+	if client.calls != 4 {
+		t.Errorf("expected invalidated entry to be fetched again, got %d upstream requests", client.calls)
+	}
+}
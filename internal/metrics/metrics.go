@@ -33,23 +33,45 @@ var (
 		},
 	)
 
-	// ProxyRequestsTotal counts total proxy requests by cluster and backend type.
+	// ProxyRequestsTotal counts upstream requests to backend clusters.
 	ProxyRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "proxy_requests_total",
-			Help: "Total number of proxy requests to backend clusters",
+			Help: "Total number of upstream requests to backend clusters by cluster, backend, endpoint, status and error type",
 		},
-		[]string{"cluster", "backend", "status"},
+		[]string{"cluster", "backend", "endpoint", "status", "error_type"},
 	)
 
-	// ProxyRequestDuration measures proxy request duration in seconds.
+	// ProxyRequestDuration measures upstream request duration in seconds.
 	ProxyRequestDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "proxy_request_duration_seconds",
-			Help:    "Proxy request duration to backend clusters in seconds",
+			Help:    "Upstream request duration to backend clusters in seconds",
 			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
 		},
-		[]string{"cluster", "backend"},
+		[]string{"cluster", "backend", "endpoint"},
+	)
+
+	// ProxyTimeToFirstByte measures the time from sending an upstream
+	// request until the first response byte arrives. The remainder of the
+	// request duration is spent transferring the response.
+	ProxyTimeToFirstByte = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_time_to_first_byte_seconds",
+			Help:    "Time until the first byte of upstream responses from backend clusters in seconds",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"cluster", "backend", "endpoint"},
+	)
+
+	// ProxyResponseBytes measures the size of upstream response bodies.
+	ProxyResponseBytes = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_response_bytes",
+			Help:    "Size of upstream response bodies from backend clusters in bytes",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+		},
+		[]string{"cluster", "backend", "endpoint"},
 	)
 
 	// ClusterHealthStatus tracks cluster health status (1 = healthy, 0 = unhealthy).
@@ -61,6 +83,44 @@ var (
 		[]string{"cluster"},
 	)
 
+	// BackendHealthStatus tracks the result of the latest health check of
+	// each cluster backend.
+	BackendHealthStatus = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "backend_health_status",
+			Help: "Backend health status by cluster and backend (1 = healthy, 0 = unhealthy)",
+		},
+		[]string{"cluster", "backend"},
+	)
+
+	// ProbeSuccess tracks the result of the latest run of each canary query.
+	ProbeSuccess = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "probe_success",
+			Help: "Whether the latest run of the canary query succeeded (1 = success, 0 = failure)",
+		},
+		[]string{"probe", "cluster", "backend"},
+	)
+
+	// ProbeDuration measures the duration of canary queries in seconds.
+	ProbeDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "probe_duration_seconds",
+			Help:    "Duration of canary queries in seconds",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"probe", "cluster", "backend"},
+	)
+
+	// ProbeLastSuccess tracks when each canary query last succeeded.
+	ProbeLastSuccess = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "probe_last_success_timestamp_seconds",
+			Help: "Unix time of the latest successful run of the canary query",
+		},
+		[]string{"probe", "cluster", "backend"},
+	)
+
 	// TenantCount tracks the number of discovered tenants per cluster.
 	TenantCount = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -70,6 +130,43 @@ var (
 		[]string{"cluster"},
 	)
 
+	// TenantWatcherSynced tracks whether the namespace cache of each tenant
+	// watcher is synced.
+	TenantWatcherSynced = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tenant_watcher_synced",
+			Help: "Whether the tenant watcher's namespace cache is synced (1 = synced, 0 = not synced)",
+		},
+		[]string{"cluster"},
+	)
+
+	// TenantWatcherRestarts counts tenant watcher restarts after failed syncs.
+	TenantWatcherRestarts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tenant_watcher_restarts_total",
+			Help: "Total number of tenant watcher restarts after a failed namespace cache sync",
+		},
+		[]string{"cluster"},
+	)
+
+	// TenantWatcherLastRefresh tracks when each tenant list was last rebuilt.
+	TenantWatcherLastRefresh = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tenant_watcher_last_refresh_timestamp_seconds",
+			Help: "Unix time of the latest refresh of the tenant list",
+		},
+		[]string{"cluster"},
+	)
+
+	// TenantChanges counts tenants added to and removed from tenant lists.
+	TenantChanges = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tenant_changes_total",
+			Help: "Total number of tenants added to or removed from the tenant list",
+		},
+		[]string{"cluster", "change"},
+	)
+
 	// ClusterInfo provides static cluster configuration info.
 	ClusterInfo = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -78,6 +175,192 @@ var (
 		},
 		[]string{"cluster", "type", "has_loki", "has_mimir"},
 	)
+
+	// AuditEventsTotal counts audit events by sink and delivery result.
+	AuditEventsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_events_total",
+			Help: "Total number of audit events by sink and result",
+		},
+		[]string{"sink", "result"},
+	)
+
+	// SlowQueriesTotal counts queries recorded in the slow query log.
+	SlowQueriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "slow_queries_total",
+			Help: "Total number of queries exceeding the slow query thresholds by cluster and backend",
+		},
+		[]string{"cluster", "backend"},
+	)
+
+	// BlockedRequestsTotal counts requests rejected by access policies.
+	BlockedRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_blocked_requests_total",
+			Help: "Total number of requests blocked by access policies",
+		},
+		[]string{"cluster", "backend", "policy"},
+	)
+
+	// RedactionsTotal counts redacted matches in Loki responses by rule and
+	// target (line or label).
+	RedactionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redactions_total",
+			Help: "Total number of redacted matches in log responses by rule and target",
+		},
+		[]string{"rule", "target"},
+	)
+
+	// CacheSizeBytes tracks the size of keys and values held by each cache.
+	CacheSizeBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cache_size_bytes",
+			Help: "Size of keys and values held in the cache in bytes",
+		},
+		[]string{"cache"},
+	)
+
+	// CacheEvictionsTotal counts entries evicted to stay within the cache size limit.
+	CacheEvictionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_evictions_total",
+			Help: "Total number of entries evicted from the cache",
+		},
+		[]string{"cache"},
+	)
+
+	// ResultsCacheRequestsTotal counts range queries served through the
+	// results cache by backend and result (hit, partial, miss, uncacheable).
+	ResultsCacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "results_cache_requests_total",
+			Help: "Total number of range queries handled by the results cache by backend and result",
+		},
+		[]string{"backend", "result"},
+	)
+
+	// MetadataCacheRequestsTotal counts label metadata requests served through
+	// the metadata cache by backend and result (hit, stale, miss).
+	MetadataCacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "metadata_cache_requests_total",
+			Help: "Total number of label metadata requests handled by the metadata cache by backend and result",
+		},
+		[]string{"backend", "result"},
+	)
+
+	// CoalescedRequestsTotal counts requests that shared an in-flight
+	// upstream call instead of sending their own.
+	CoalescedRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_coalesced_requests_total",
+			Help: "Total number of requests served by sharing an identical in-flight upstream request",
+		},
+		[]string{"cluster", "backend"},
+	)
+
+	// ClientThrottleDuration measures how long proxied requests wait for the
+	// client-side rate limiter of the cluster's REST client.
+	ClientThrottleDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_client_throttle_duration_seconds",
+			Help:    "Time proxied requests spent waiting for the client-side rate limiter in seconds",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+		},
+		[]string{"cluster"},
+	)
+
+	// QueueDepth tracks the number of requests waiting for a concurrency slot.
+	QueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_queue_depth",
+			Help: "Number of requests waiting for a concurrency slot by cluster and backend",
+		},
+		[]string{"cluster", "backend"},
+	)
+
+	// QueueWaitDuration measures how long admitted requests waited for a
+	// concurrency slot.
+	QueueWaitDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_queue_wait_duration_seconds",
+			Help:    "Time requests waited for a concurrency slot in seconds",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"cluster", "backend"},
+	)
+
+	// QueueRejectedTotal counts requests rejected by the concurrency limiter
+	// by reason (queue_full, queue_timeout).
+	QueueRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_queue_rejected_total",
+			Help: "Total number of requests rejected by the concurrency limiter by cluster, backend and reason",
+		},
+		[]string{"cluster", "backend", "reason"},
+	)
+
+	// CircuitBreakerState tracks the circuit breaker state of each cluster
+	// backend (0 = closed, 1 = half-open, 2 = open).
+	CircuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "Circuit breaker state by cluster and backend (0 = closed, 1 = half-open, 2 = open)",
+		},
+		[]string{"cluster", "backend"},
+	)
+
+	// CircuitBreakerTransitionsTotal counts circuit breaker state changes by
+	// the state entered.
+	CircuitBreakerTransitionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_transitions_total",
+			Help: "Total number of circuit breaker state changes by cluster, backend and state entered",
+		},
+		[]string{"cluster", "backend", "state"},
+	)
+
+	// CircuitBreakerRejectedTotal counts requests failed fast by an open
+	// circuit breaker.
+	CircuitBreakerRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_rejected_total",
+			Help: "Total number of requests rejected by an open circuit breaker by cluster and backend",
+		},
+		[]string{"cluster", "backend"},
+	)
+
+	// RetriesTotal counts retried upstream requests by the reason of the
+	// failed attempt.
+	RetriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_retries_total",
+			Help: "Total number of retried upstream requests by cluster, backend and reason",
+		},
+		[]string{"cluster", "backend", "reason"},
+	)
+
+	// RetryBudgetExhaustedTotal counts retries and hedged requests skipped
+	// because the retry budget was spent.
+	RetryBudgetExhaustedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_retry_budget_exhausted_total",
+			Help: "Total number of retries and hedged requests skipped because the retry budget was spent",
+		},
+		[]string{"cluster", "backend"},
+	)
+
+	// HedgedRequestsTotal counts duplicate requests sent because the first
+	// attempt was slow, and whether the duplicate answered first.
+	HedgedRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_hedged_requests_total",
+			Help: "Total number of hedged upstream requests by cluster, backend and whether the hedge won",
+		},
+		[]string{"cluster", "backend", "won"},
+	)
 )
 
 // RecordClusterInfo records static cluster configuration.
@@ -102,6 +385,15 @@ func RecordClusterHealth(cluster string, healthy bool) {
 	ClusterHealthStatus.WithLabelValues(cluster).Set(value)
 }
 
+// RecordBackendHealth records backend health status.
+func RecordBackendHealth(cluster, backend string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1.0
+	}
+	BackendHealthStatus.WithLabelValues(cluster, backend).Set(value)
+}
+
 // RecordTenantCount records the number of tenants for a cluster.
 func RecordTenantCount(cluster string, count int) {
 	TenantCount.WithLabelValues(cluster).Set(float64(count))
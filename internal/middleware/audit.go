@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tjorri/observability-federation-proxy/internal/audit"
+)
+
+// Audit returns middleware that emits one audit event per federated request.
+// It must run after authentication so that the caller identity is known.
+// Routers annotate the event with cluster, tenant and query details via
+// audit.FromContext.
+func Audit(logger *audit.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Only data-plane requests are audited
+			if !logger.Enabled() || !strings.HasPrefix(r.URL.Path, "/clusters/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			identity := IdentityFromContext(r.Context())
+			event := &audit.Event{
+				Timestamp:  start.UTC(),
+				RequestID:  RequestIDFromContext(r.Context()),
+				Identity:   identity.Name,
+				Groups:     identity.Groups,
+				RemoteAddr: r.RemoteAddr,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+			}
+
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, r.WithContext(audit.WithEvent(r.Context(), event)))
+
+			event.Status = rw.statusCode
+			event.Bytes = rw.written
+			event.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+
+			logger.Emit(*event)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/tjorri/observability-federation-proxy/internal/audit"
+)
+
+type recordingSink struct {
+	events []audit.Event
+	mu     sync.Mutex
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Emit(event audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestAudit(t *testing.T) {
+	sink := &recordingSink{}
+	logger := audit.NewLogger(sink)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		audit.Annotate(r.Context(), "mimir", "prod", url.Values{"query": {"up"}}, "a|b")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("hello"))
+	})
+
+	chain := Audit(logger)(handler)
+
+	req := httptest.NewRequest(http.MethodGet, "/clusters/prod/mimir/api/v1/query?query=up", nil)
+	req = req.WithContext(WithIdentity(WithRequestID(req.Context(), "req-1"), Identity{Name: "alice", Groups: []string{"sre"}}))
+	chain.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Management endpoints are not audited
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/clusters", nil))
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(sink.events))
+	}
+
+	event := sink.events[0]
+	if event.RequestID != "req-1" {
+		t.Errorf("expected request ID req-1, got %s", event.RequestID)
+	}
+	if event.Identity != "alice" {
+		t.Errorf("expected identity alice, got %s", event.Identity)
+	}
+	if event.Backend != "mimir" || event.Query != "up" {
+		t.Errorf("unexpected backend/query: %s %s", event.Backend, event.Query)
+	}
+	if len(event.Tenants) != 2 {
+		t.Errorf("expected 2 tenants, got %v", event.Tenants)
+	}
+	if event.Status != http.StatusOK {
+		t.Errorf("expected status 200, got %d", event.Status)
+	}
+	if event.Bytes != 5 {
+		t.Errorf("expected 5 bytes, got %d", event.Bytes)
+	}
+	if event.Timestamp.IsZero() {
+		t.Error("expected timestamp to be set")
+	}
+}
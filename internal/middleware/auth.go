@@ -1,23 +1,74 @@
 package middleware
 
 import (
+	"context"
 	"crypto/subtle"
+	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// AnonymousIdentity is the identity name used when a request is not authenticated.
+const AnonymousIdentity = "anonymous"
+
+// Identity describes the authenticated caller of a request.
+type Identity struct {
+	// Name identifies the caller.
+	Name string
+	// Groups are the groups the caller belongs to.
+	Groups []string
+}
+
+// InGroup returns true if the identity is a member of the given group.
+func (i Identity) InGroup(group string) bool {
+	for _, g := range i.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenIdentity maps a bearer token to a named identity.
+type TokenIdentity struct {
+	Token  string
+	Name   string
+	Groups []string
+}
+
 // AuthConfig holds authentication configuration.
 type AuthConfig struct {
 	// Enabled controls whether authentication is required.
 	Enabled bool
 	// BearerTokens is a list of valid bearer tokens.
+	// Callers using these tokens are identified as "token-<index>".
 	BearerTokens []string
+	// Identities is a list of bearer tokens mapped to named identities.
+	Identities []TokenIdentity
 	// SkipPaths are paths that don't require authentication.
 	SkipPaths []string
 }
 
+type identityContextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the given identity.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, id)
+}
+
+// IdentityFromContext returns the caller identity stored in ctx.
+// If no identity is present, the anonymous identity is returned.
+func IdentityFromContext(ctx context.Context) Identity {
+	if id, ok := ctx.Value(identityContextKey{}).(Identity); ok {
+		return id
+	}
+	return Identity{Name: AnonymousIdentity}
+}
+
 // Auth returns middleware that validates authentication.
 func Auth(cfg AuthConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -35,48 +86,64 @@ func Auth(cfg AuthConfig) func(http.Handler) http.Handler {
 				}
 			}
 
-			// Get authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				log.Debug().
+			_, span := tracer.Start(r.Context(), "auth")
+			identity, reason := cfg.authenticate(r)
+			if reason != "" {
+				span.SetStatus(codes.Error, reason)
+				span.End()
+				log.Ctx(r.Context()).Debug().
 					Str("path", r.URL.Path).
 					Str("remote_addr", r.RemoteAddr).
-					Msg("missing authorization header")
-				http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+					Msg(reason)
+				WriteError(r.Context(), w, http.StatusUnauthorized, "unauthorized")
 				return
 			}
+			span.SetAttributes(attribute.String("enduser.id", identity.Name))
+			span.End()
 
-			// Check for bearer token
-			if !strings.HasPrefix(authHeader, "Bearer ") {
-				log.Debug().
-					Str("path", r.URL.Path).
-					Str("remote_addr", r.RemoteAddr).
-					Msg("invalid authorization header format")
-				http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
-				return
-			}
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+		})
+	}
+}
 
-			token := strings.TrimPrefix(authHeader, "Bearer ")
+// authenticate returns the identity of the bearer token in the request's
+// Authorization header, or the reason the request is not authenticated.
+func (cfg AuthConfig) authenticate(r *http.Request) (Identity, string) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return Identity{}, "missing authorization header"
+	}
 
-			// Validate token
-			valid := false
-			for _, validToken := range cfg.BearerTokens {
-				if subtle.ConstantTimeCompare([]byte(token), []byte(validToken)) == 1 {
-					valid = true
-					break
-				}
-			}
+	// Check for bearer token
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return Identity{}, "invalid authorization header format"
+	}
 
-			if !valid {
-				log.Debug().
-					Str("path", r.URL.Path).
-					Str("remote_addr", r.RemoteAddr).
-					Msg("invalid bearer token")
-				http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
-				return
-			}
+	identity, valid := cfg.lookupToken(strings.TrimPrefix(authHeader, "Bearer "))
+	if !valid {
+		return Identity{}, "invalid bearer token"
+	}
+	return identity, ""
+}
 
-			next.ServeHTTP(w, r)
-		})
+// lookupToken returns the identity associated with a bearer token.
+// All configured tokens are compared to keep the lookup constant-time.
+func (cfg AuthConfig) lookupToken(token string) (Identity, bool) {
+	var identity Identity
+	valid := false
+
+	for _, ti := range cfg.Identities {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(ti.Token)) == 1 && !valid {
+			identity = Identity{Name: ti.Name, Groups: ti.Groups}
+			valid = true
+		}
 	}
+	for i, validToken := range cfg.BearerTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(validToken)) == 1 && !valid {
+			identity = Identity{Name: fmt.Sprintf("token-%d", i)}
+			valid = true
+		}
+	}
+
+	return identity, valid
 }
@@ -179,3 +179,55 @@ func TestAuth_SkipPathPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestAuth_Identities(t *testing.T) {
+	var got Identity
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = IdentityFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	authMiddleware := Auth(AuthConfig{
+		Enabled:      true,
+		BearerTokens: []string{"legacy"},
+		Identities: []TokenIdentity{
+			{Token: "alice-token", Name: "alice", Groups: []string{"sre"}},
+		},
+	})
+
+	tests := []struct {
+		token        string
+		expectedName string
+		inSRE        bool
+	}{
+		{"alice-token", "alice", true},
+		{"legacy", "token-0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+
+			authMiddleware(handler).ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+			if got.Name != tt.expectedName {
+				t.Errorf("expected identity %q, got %q", tt.expectedName, got.Name)
+			}
+			if got.InGroup("sre") != tt.inSRE {
+				t.Errorf("expected InGroup(sre) = %v", tt.inSRE)
+			}
+		})
+	}
+}
+
+func TestIdentityFromContext_Anonymous(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	if id := IdentityFromContext(req.Context()); id.Name != AnonymousIdentity {
+		t.Errorf("expected anonymous identity, got %q", id.Name)
+	}
+}
@@ -64,18 +64,19 @@ func Logging(next http.Handler) http.Handler {
 		duration := time.Since(start)
 
 		// Skip logging for health check endpoints at debug level
-		logEvent := log.Debug()
+		logger := log.Ctx(r.Context())
+		logEvent := logger.Debug()
 		if rw.statusCode >= 400 {
-			logEvent = log.Warn()
+			logEvent = logger.Warn()
 		}
 		if rw.statusCode >= 500 {
-			logEvent = log.Error()
+			logEvent = logger.Error()
 		}
 
 		// Skip verbose logging for health endpoints
 		path := r.URL.Path
 		if path == "/healthz" || path == "/readyz" || path == "/metrics" {
-			logEvent = log.Trace()
+			logEvent = logger.Trace()
 		}
 
 		logEvent.
@@ -95,13 +96,13 @@ func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Error().
+				log.Ctx(r.Context()).Error().
 					Interface("panic", err).
 					Str("method", r.Method).
 					Str("path", r.URL.Path).
 					Msg("recovered from panic")
 
-				http.Error(w, `{"error": "internal server error"}`, http.StatusInternalServerError)
+				WriteError(r.Context(), w, http.StatusInternalServerError, "internal server error")
 			}
 		}()
 		next.ServeHTTP(w, r)
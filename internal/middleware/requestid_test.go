@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{"uses valid incoming ID", "grafana-3f2a:1", true},
+		{"generates missing ID", "", false},
+		{"replaces ID with invalid characters", "abc\ndef", false},
+		{"replaces overlong ID", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = RequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if id == "" || id != ctxID {
+				t.Fatalf("expected response and context to carry the same ID, got %q and %q", id, ctxID)
+			}
+			if (id == tt.incoming) != tt.wantSame {
+				t.Errorf("unexpected request ID %q for incoming %q", id, tt.incoming)
+			}
+		})
+	}
+}
+
+func TestRequestID_ContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = original })
+
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Ctx(r.Context()).Info().Msg("downstream")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to parse log line %q: %v", buf.String(), err)
+	}
+	if entry["request_id"] != "req-42" {
+		t.Errorf("expected request_id in log line, got %v", entry)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	WriteError(WithRequestID(req.Context(), "req-7"), w, http.StatusNotFound, "cluster not found")
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if body["error"] != "cluster not found" || body["requestId"] != "req-7" {
+		t.Errorf("unexpected error body: %v", body)
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tjorri/observability-federation-proxy/internal/audit"
+	"github.com/tjorri/observability-federation-proxy/internal/slowquery"
+)
+
+// SlowQueries returns middleware that records federated requests exceeding
+// the thresholds of the slow query log. It must run after authentication so
+// that the caller identity is known. The cluster, tenants and query are
+// taken from the audit event that routers annotate; if the request is not
+// audited, an event is created for this purpose only.
+func SlowQueries(slowLog *slowquery.Log) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Only data-plane requests are recorded
+			if !strings.HasPrefix(r.URL.Path, "/clusters/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			event := audit.FromContext(ctx)
+			if event == nil {
+				event = &audit.Event{}
+				ctx = audit.WithEvent(ctx, event)
+			}
+
+			start := time.Now()
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, r.WithContext(ctx))
+			duration := time.Since(start)
+
+			if !slowLog.IsSlow(duration, rw.written) {
+				return
+			}
+
+			record := slowquery.Record{
+				Timestamp:  start.UTC(),
+				RequestID:  RequestIDFromContext(ctx),
+				Identity:   IdentityFromContext(ctx).Name,
+				Backend:    event.Backend,
+				Path:       r.URL.Path,
+				Query:      event.Query,
+				Tenants:    len(event.Tenants),
+				Status:     rw.statusCode,
+				Bytes:      rw.written,
+				DurationMS: float64(duration.Microseconds()) / 1000,
+			}
+			if len(event.Clusters) > 0 {
+				record.Cluster = event.Clusters[0]
+			}
+			slowLog.Add(record)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/tjorri/observability-federation-proxy/internal/audit"
+	"github.com/tjorri/observability-federation-proxy/internal/slowquery"
+)
+
+func TestSlowQueries(t *testing.T) {
+	slowLog := slowquery.New(slowquery.Config{MinBytes: 5})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		audit.Annotate(r.Context(), "loki", "prod", url.Values{"query": {`{app="a"}`}}, "a|b|c")
+		w.Write([]byte(r.URL.Query().Get("body")))
+	})
+	chain := SlowQueries(slowLog)(handler)
+
+	serve := func(path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(WithIdentity(WithRequestID(req.Context(), "req-1"), Identity{Name: "alice"}))
+		chain.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Below the threshold
+	serve("/clusters/prod/loki/api/v1/query?body=abc")
+	// Management endpoints are not recorded
+	serve("/api/v1/clusters?body=hello")
+	serve("/clusters/prod/loki/api/v1/query?body=hello")
+
+	records := slowLog.List(slowquery.Filter{})
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+
+	r := records[0]
+	if r.RequestID != "req-1" || r.Identity != "alice" {
+		t.Errorf("unexpected request ID/identity: %s %s", r.RequestID, r.Identity)
+	}
+	if r.Backend != "loki" || r.Cluster != "prod" || r.Query != `{app="a"}` {
+		t.Errorf("unexpected backend/cluster/query: %s %s %s", r.Backend, r.Cluster, r.Query)
+	}
+	if r.Tenants != 3 {
+		t.Errorf("expected 3 tenants, got %d", r.Tenants)
+	}
+	if r.Status != http.StatusOK || r.Bytes != 5 {
+		t.Errorf("unexpected status/bytes: %d %d", r.Status, r.Bytes)
+	}
+}
@@ -6,13 +6,27 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/rs/zerolog/log"
-
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tjorri/observability-federation-proxy/internal/audit"
+	"github.com/tjorri/observability-federation-proxy/internal/cache"
+	"github.com/tjorri/observability-federation-proxy/internal/limits"
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+	"github.com/tjorri/observability-federation-proxy/internal/policy"
 	"github.com/tjorri/observability-federation-proxy/internal/proxy"
 	"github.com/tjorri/observability-federation-proxy/internal/tenant"
 )
 
+var tracer = otel.Tracer("github.com/tjorri/observability-federation-proxy/internal/mimir")
+
 // ProxyClient defines the interface for proxying HTTP requests.
 type ProxyClient interface {
 	ProxyHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request, pathPrefix string, opts *proxy.HTTPOptions)
@@ -23,6 +37,11 @@ type Router struct {
 	clients        map[string]ProxyClient
 	tenantRegistry *tenant.Registry
 	maxOrgIDLength int
+	labelPolicy    *policy.LabelPolicy
+	endpointPolicy *policy.EndpointPolicy
+	limits         *limits.Resolver
+	resultsCache   *cache.ResultsCache
+	metadataCache  *cache.MetadataCache
 }
 
 // RouterConfig holds configuration for creating a Mimir router.
@@ -30,6 +49,18 @@ type RouterConfig struct {
 	Clients        map[string]ProxyClient
 	TenantRegistry *tenant.Registry
 	MaxOrgIDLength int
+	LabelPolicy    *policy.LabelPolicy
+	// EndpointPolicy restricts the paths reachable through the catch-all
+	// route. A nil policy allows every path.
+	EndpointPolicy *policy.EndpointPolicy
+	// Limits resolves the query guardrails for each caller. A nil resolver
+	// applies no limits.
+	Limits *limits.Resolver
+	// ResultsCache caches range query results. A nil cache disables caching.
+	ResultsCache *cache.ResultsCache
+	// MetadataCache caches label names and values. A nil cache disables
+	// caching.
+	MetadataCache *cache.MetadataCache
 }
 
 // NewRouter creates a new Mimir router.
@@ -38,6 +69,11 @@ func NewRouter(cfg RouterConfig) *Router {
 		clients:        cfg.Clients,
 		tenantRegistry: cfg.TenantRegistry,
 		maxOrgIDLength: cfg.MaxOrgIDLength,
+		labelPolicy:    cfg.LabelPolicy,
+		endpointPolicy: cfg.EndpointPolicy,
+		limits:         cfg.Limits,
+		resultsCache:   cfg.ResultsCache,
+		metadataCache:  cfg.MetadataCache,
 	}
 }
 
@@ -84,27 +120,35 @@ func (r *Router) handleQuery(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or mimir not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or mimir not configured")
 		return
 	}
 
 	if err := req.ParseForm(); err != nil {
-		r.writeError(w, http.StatusBadRequest, "failed to parse form")
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
 		return
 	}
 
 	query := req.Form.Get("query")
 	if query == "" {
-		r.writeError(w, http.StatusBadRequest, "missing required parameter: query")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameter: query")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("query", query).
 		Str("time", req.Form.Get("time")).
 		Msg("mimir query request")
 
+	if !r.checkLimits(w, req, clusterName, false) {
+		return
+	}
+
+	if !r.enforceLabelPolicy(w, req, clusterName, false) {
+		return
+	}
+
 	r.proxyRequest(w, req, clusterName, client)
 }
 
@@ -116,29 +160,29 @@ func (r *Router) handleQueryRange(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or mimir not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or mimir not configured")
 		return
 	}
 
 	if err := req.ParseForm(); err != nil {
-		r.writeError(w, http.StatusBadRequest, "failed to parse form")
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
 		return
 	}
 
 	query := req.Form.Get("query")
 	if query == "" {
-		r.writeError(w, http.StatusBadRequest, "missing required parameter: query")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameter: query")
 		return
 	}
 
 	start := req.Form.Get("start")
 	end := req.Form.Get("end")
 	if start == "" || end == "" {
-		r.writeError(w, http.StatusBadRequest, "missing required parameters: start and end")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameters: start and end")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("query", query).
 		Str("start", start).
@@ -146,7 +190,15 @@ func (r *Router) handleQueryRange(w http.ResponseWriter, req *http.Request) {
 		Str("step", req.Form.Get("step")).
 		Msg("mimir query_range request")
 
-	r.proxyRequest(w, req, clusterName, client)
+	if !r.checkLimits(w, req, clusterName, true) {
+		return
+	}
+
+	if !r.enforceLabelPolicy(w, req, clusterName, false) {
+		return
+	}
+
+	r.proxyCached(w, req, clusterName, client)
 }
 
 // handleLabels handles /api/v1/labels requests.
@@ -157,15 +209,19 @@ func (r *Router) handleLabels(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or mimir not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or mimir not configured")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Msg("mimir labels request")
 
-	r.proxyRequest(w, req, clusterName, client)
+	if !r.enforceLabelPolicy(w, req, clusterName, true) {
+		return
+	}
+
+	r.proxyMetadata(w, req, clusterName, client)
 }
 
 // handleLabelValues handles /api/v1/label/{name}/values requests.
@@ -177,21 +233,25 @@ func (r *Router) handleLabelValues(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or mimir not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or mimir not configured")
 		return
 	}
 
 	if labelName == "" {
-		r.writeError(w, http.StatusBadRequest, "missing label name")
+		r.writeError(w, req, http.StatusBadRequest, "missing label name")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("label", labelName).
 		Msg("mimir label values request")
 
-	r.proxyRequest(w, req, clusterName, client)
+	if !r.enforceLabelPolicy(w, req, clusterName, true) {
+		return
+	}
+
+	r.proxyMetadata(w, req, clusterName, client)
 }
 
 // handleSeries handles /api/v1/series requests.
@@ -202,26 +262,30 @@ func (r *Router) handleSeries(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or mimir not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or mimir not configured")
 		return
 	}
 
 	if err := req.ParseForm(); err != nil {
-		r.writeError(w, http.StatusBadRequest, "failed to parse form")
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
 		return
 	}
 
 	matches := req.Form["match[]"]
 	if len(matches) == 0 {
-		r.writeError(w, http.StatusBadRequest, "missing required parameter: match[]")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameter: match[]")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Strs("match", matches).
 		Msg("mimir series request")
 
+	if !r.enforceLabelPolicy(w, req, clusterName, false) {
+		return
+	}
+
 	r.proxyRequest(w, req, clusterName, client)
 }
 
@@ -233,11 +297,11 @@ func (r *Router) handleMetadata(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or mimir not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or mimir not configured")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("metric", req.URL.Query().Get("metric")).
 		Msg("mimir metadata request")
@@ -253,26 +317,30 @@ func (r *Router) handleQueryExemplars(w http.ResponseWriter, req *http.Request)
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or mimir not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or mimir not configured")
 		return
 	}
 
 	if err := req.ParseForm(); err != nil {
-		r.writeError(w, http.StatusBadRequest, "failed to parse form")
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
 		return
 	}
 
 	query := req.Form.Get("query")
 	if query == "" {
-		r.writeError(w, http.StatusBadRequest, "missing required parameter: query")
+		r.writeError(w, req, http.StatusBadRequest, "missing required parameter: query")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("query", query).
 		Msg("mimir query_exemplars request")
 
+	if !r.enforceLabelPolicy(w, req, clusterName, false) {
+		return
+	}
+
 	r.proxyRequest(w, req, clusterName, client)
 }
 
@@ -282,14 +350,20 @@ func (r *Router) handleRemoteRead(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or mimir not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or mimir not configured")
 		return
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Msg("mimir remote read request")
 
+	if len(r.labelMatchers(req, clusterName)) > 0 {
+		metrics.BlockedRequestsTotal.WithLabelValues(clusterName, "mimir", "label").Inc()
+		r.writeError(w, req, http.StatusForbidden, "endpoint not permitted for callers with label restrictions")
+		return
+	}
+
 	r.proxyRequest(w, req, clusterName, client)
 }
 
@@ -299,7 +373,7 @@ func (r *Router) handleGenericProxy(w http.ResponseWriter, req *http.Request) {
 
 	client, ok := r.clients[clusterName]
 	if !ok {
-		r.writeError(w, http.StatusNotFound, "cluster not found or mimir not configured")
+		r.writeError(w, req, http.StatusNotFound, "cluster not found or mimir not configured")
 		return
 	}
 
@@ -310,35 +384,238 @@ func (r *Router) handleGenericProxy(w http.ResponseWriter, req *http.Request) {
 		path = "/"
 	}
 
-	log.Debug().
+	log.Ctx(req.Context()).Debug().
 		Str("cluster", clusterName).
 		Str("path", path).
 		Msg("mimir generic proxy request")
 
+	identity := middleware.IdentityFromContext(req.Context())
+	if !r.endpointPolicy.Allowed(identity, req.Method, path) {
+		log.Ctx(req.Context()).Info().
+			Str("cluster", clusterName).
+			Str("identity", identity.Name).
+			Str("method", req.Method).
+			Str("path", path).
+			Msg("mimir request blocked by endpoint policy")
+		metrics.BlockedRequestsTotal.WithLabelValues(clusterName, "mimir", "endpoint").Inc()
+		r.writeError(w, req, http.StatusForbidden, "endpoint not permitted")
+		return
+	}
+
+	if len(r.labelMatchers(req, clusterName)) > 0 {
+		metrics.BlockedRequestsTotal.WithLabelValues(clusterName, "mimir", "label").Inc()
+		r.writeError(w, req, http.StatusForbidden, "endpoint not permitted for callers with label restrictions")
+		return
+	}
+
 	r.proxyRequest(w, req, clusterName, client)
 }
 
+// checkLimits validates the query against the caller's guardrails before
+// any label policy rewriting. It returns false if an error response has been
+// written.
+func (r *Router) checkLimits(w http.ResponseWriter, req *http.Request, clusterName string, rangeQuery bool) bool {
+	l := r.limits.For(middleware.IdentityFromContext(req.Context()), clusterName)
+
+	err := l.CheckQuery(req.Form.Get("query"))
+	if err == nil && rangeQuery {
+		err = l.CheckRange(req.Form)
+	}
+	if err != nil {
+		metrics.BlockedRequestsTotal.WithLabelValues(clusterName, "mimir", "limits").Inc()
+		r.writeBadData(w, req, err.Error())
+		return false
+	}
+	return true
+}
+
+// labelMatchers returns the label matchers enforced for the caller by the label policy.
+func (r *Router) labelMatchers(req *http.Request, clusterName string) []*labels.Matcher {
+	return r.labelPolicy.Matchers(middleware.IdentityFromContext(req.Context()), clusterName)
+}
+
+// enforceLabelPolicy rewrites the query and match[] parameters so that every
+// selector carries the caller's mandatory label matchers. When ensureMatch is
+// set, a match[] selector is added even if the request had none, so metadata
+// endpoints cannot leak labels through autocomplete. It returns false if an
+// error response has been written.
+func (r *Router) enforceLabelPolicy(w http.ResponseWriter, req *http.Request, clusterName string, ensureMatch bool) bool {
+	matchers := r.labelMatchers(req, clusterName)
+	if len(matchers) == 0 {
+		return true
+	}
+
+	if err := req.ParseForm(); err != nil {
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
+		return false
+	}
+
+	if query := req.Form.Get("query"); query != "" {
+		rewritten, err := policy.RewritePromQL(query, matchers)
+		if err != nil {
+			r.writeError(w, req, http.StatusBadRequest, err.Error())
+			return false
+		}
+		req.Form.Set("query", rewritten)
+	}
+
+	if selectors := req.Form["match[]"]; len(selectors) > 0 || ensureMatch {
+		rewritten, err := policy.RewriteSeriesSelectors(selectors, matchers)
+		if err != nil {
+			r.writeError(w, req, http.StatusBadRequest, err.Error())
+			return false
+		}
+		req.Form["match[]"] = rewritten
+	}
+
+	return true
+}
+
 // proxyRequest proxies a request to the Mimir backend.
 func (r *Router) proxyRequest(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient) {
 	// Build path prefix for stripping
 	pathPrefix := fmt.Sprintf("/clusters/%s/mimir", clusterName)
 
 	// Build proxy options with X-Scope-OrgID header
-	opts := r.buildProxyOptions(clusterName)
+	opts, err := r.buildProxyOptions(req.Context(), clusterName)
+	if err != nil {
+		r.writeError(w, req, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	// Record request details for the audit log
+	params := req.Form
+	if params == nil {
+		params = req.URL.Query()
+	}
+	var orgID string
+	if opts != nil {
+		orgID = opts.AdditionalHeaders.Get("X-Scope-OrgID")
+	}
+	audit.Annotate(req.Context(), "mimir", clusterName, params, orgID)
 
 	// Pass the original request (don't clone) to preserve parsed form data
 	client.ProxyHTTP(req.Context(), w, req, pathPrefix, opts)
 }
 
-// buildProxyOptions builds proxy options with tenant headers.
-func (r *Router) buildProxyOptions(clusterName string) *proxy.HTTPOptions {
+// proxyCached answers a range query through the results cache, falling back
+// to a plain proxy request when the query cannot be parsed or split.
+func (r *Router) proxyCached(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient) {
+	if r.resultsCache == nil {
+		r.proxyRequest(w, req, clusterName, client)
+		return
+	}
+
+	// Let the backend report parse errors
+	expr, err := parser.ParseExpr(req.Form.Get("query"))
+	if err != nil || !cache.Splittable(expr) {
+		r.proxyRequest(w, req, clusterName, client)
+		return
+	}
+	normalized := expr.String()
+
+	pathPrefix := fmt.Sprintf("/clusters/%s/mimir", clusterName)
+	opts, err := r.buildProxyOptions(req.Context(), clusterName)
+	if err != nil {
+		r.writeError(w, req, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	var orgID string
+	if opts != nil {
+		orgID = opts.AdditionalHeaders.Get("X-Scope-OrgID")
+	}
+
+	q, err := cache.ParseRangeQuery(cache.Key(clusterName, orgID, normalized, req.Form), req.Form)
+	if err != nil {
+		r.proxyRequest(w, req, clusterName, client)
+		return
+	}
+
+	audit.Annotate(req.Context(), "mimir", clusterName, req.Form, orgID)
+
+	ctx, span := tracer.Start(req.Context(), "results cache")
+	defer span.End()
+	resp, err := r.resultsCache.Do(ctx, q, func(ctx context.Context, start, end time.Time) (cache.Response, error) {
+		sub := req.Clone(ctx)
+		sub.Form.Set("start", cache.FormatTime(start))
+		sub.Form.Set("end", cache.FormatTime(end))
+
+		buf := proxy.NewBufferedResponseWriter()
+		client.ProxyHTTP(ctx, buf, sub, pathPrefix, opts)
+		return cache.Response{StatusCode: buf.StatusCode, Body: buf.Body.Bytes()}, nil
+	})
+	if err != nil {
+		r.writeError(w, req, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+// proxyMetadata answers a label names or values request through the metadata
+// cache, falling back to a plain proxy request when caching is disabled.
+func (r *Router) proxyMetadata(w http.ResponseWriter, req *http.Request, clusterName string, client ProxyClient) {
+	if r.metadataCache == nil {
+		r.proxyRequest(w, req, clusterName, client)
+		return
+	}
+
+	if err := req.ParseForm(); err != nil {
+		r.writeError(w, req, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	pathPrefix := fmt.Sprintf("/clusters/%s/mimir", clusterName)
+	opts, err := r.buildProxyOptions(req.Context(), clusterName)
+	if err != nil {
+		r.writeError(w, req, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	var orgID string
+	if opts != nil {
+		orgID = opts.AdditionalHeaders.Get("X-Scope-OrgID")
+	}
+
+	audit.Annotate(req.Context(), "mimir", clusterName, req.Form, orgID)
+
+	// Snapshot the request, as stale entries are refreshed after this handler returns
+	sub := req.Clone(req.Context())
+	key := r.metadataCache.Key(strings.TrimPrefix(req.URL.Path, pathPrefix), orgID, req.Form)
+
+	ctx, span := tracer.Start(req.Context(), "metadata cache")
+	defer span.End()
+	resp, err := r.metadataCache.Do(ctx, clusterName, key, func(ctx context.Context) (cache.Response, error) {
+		buf := proxy.NewBufferedResponseWriter()
+		client.ProxyHTTP(ctx, buf, sub.WithContext(ctx), pathPrefix, opts)
+		return cache.Response{StatusCode: buf.StatusCode, Body: buf.Body.Bytes()}, nil
+	})
+	if err != nil {
+		r.writeError(w, req, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+// buildProxyOptions builds proxy options with tenant headers. It fails if
+// the cluster's tenants must be synced before it is queried.
+func (r *Router) buildProxyOptions(ctx context.Context, clusterName string) (*proxy.HTTPOptions, error) {
 	if r.tenantRegistry == nil {
-		return nil
+		return nil, nil
+	}
+	if err := r.tenantRegistry.CheckSynced(clusterName); err != nil {
+		return nil, err
 	}
 
+	_, span := tracer.Start(ctx, "resolve tenants", trace.WithAttributes(attribute.String("cluster", clusterName)))
 	orgID := r.tenantRegistry.BuildOrgIDHeader(clusterName, r.maxOrgIDLength)
+	span.End()
 	if orgID == "" {
-		return nil
+		return nil, nil
 	}
 
 	headers := make(http.Header)
@@ -346,14 +623,25 @@ func (r *Router) buildProxyOptions(clusterName string) *proxy.HTTPOptions {
 
 	return &proxy.HTTPOptions{
 		AdditionalHeaders: headers,
-	}
+	}, nil
 }
 
-// writeError writes a JSON error response.
-func (r *Router) writeError(w http.ResponseWriter, statusCode int, message string) {
+// writeBadData writes a Prometheus-style bad_data error response, which
+// Grafana displays as a query error.
+func (r *Router) writeBadData(w http.ResponseWriter, req *http.Request, message string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(PrometheusResponse{
+		Status:    "error",
+		ErrorType: "bad_data",
+		Error:     message,
+		RequestID: middleware.RequestIDFromContext(req.Context()),
+	})
+}
+
+// writeError writes a JSON error response.
+func (r *Router) writeError(w http.ResponseWriter, req *http.Request, statusCode int, message string) {
+	middleware.WriteError(req.Context(), w, statusCode, message)
 }
 
 // PrometheusResponse represents a standard Prometheus/Mimir API response.
@@ -362,5 +650,6 @@ type PrometheusResponse struct {
 	Data      interface{} `json:"data,omitempty"`
 	ErrorType string      `json:"errorType,omitempty"`
 	Error     string      `json:"error,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
 	Warnings  []string    `json:"warnings,omitempty"`
 }
@@ -3,12 +3,18 @@ package mimir
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/tjorri/observability-federation-proxy/internal/cache"
+	"github.com/tjorri/observability-federation-proxy/internal/limits"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+	"github.com/tjorri/observability-federation-proxy/internal/policy"
 	"github.com/tjorri/observability-federation-proxy/internal/proxy"
 )
 
@@ -557,3 +563,439 @@ func TestRouter_GenericProxy(t *testing.T) {
 		t.Errorf("expected status 200, got %d", w.Code)
 	}
 }
+
+func newLabelPolicyRouter(t *testing.T, mockClient *mockProxyClient) *http.ServeMux {
+	t.Helper()
+
+	labelPolicy, err := policy.NewLabelPolicy([]policy.LabelRule{
+		{Name: "payments", Groups: []string{"payments"}, Matchers: []string{`app=~"payments-.*"`}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create label policy: %v", err)
+	}
+
+	router := NewRouter(RouterConfig{
+		Clients: map[string]ProxyClient{
+			"test-cluster": mockClient,
+		},
+		LabelPolicy: labelPolicy,
+	})
+
+	mux := http.NewServeMux()
+	router.RegisterRoutes(mux, "/clusters/{cluster}/mimir")
+	return mux
+}
+
+func withIdentity(req *http.Request, name string, groups ...string) *http.Request {
+	return req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{Name: name, Groups: groups}))
+}
+
+func TestRouter_LabelPolicy_RewritesQuery(t *testing.T) {
+	mockClient := &mockProxyClient{}
+	mux := newLabelPolicyRouter(t, mockClient)
+
+	req := httptest.NewRequest(http.MethodGet, `/clusters/test-cluster/mimir/api/v1/query_range?query=sum(rate(http_requests_total[5m]))&start=1&end=2`, nil)
+	req = withIdentity(req, "carol", "payments")
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d; body: %s", w.Code, w.Body.String())
+	}
+	expected := `sum(rate(http_requests_total{app=~"payments-.*"}[5m]))`
+	if got := mockClient.lastForm.Get("query"); got != expected {
+		t.Errorf("expected query %s, got %s", expected, got)
+	}
+}
+
+func TestRouter_LabelPolicy_UnrestrictedCaller(t *testing.T) {
+	mockClient := &mockProxyClient{}
+	mux := newLabelPolicyRouter(t, mockClient)
+
+	req := httptest.NewRequest(http.MethodGet, `/clusters/test-cluster/mimir/api/v1/query?query=up`, nil)
+	req = withIdentity(req, "admin", "sre")
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	if got := mockClient.lastForm.Get("query"); got != "up" {
+		t.Errorf("expected query unchanged, got %s", got)
+	}
+}
+
+func TestRouter_LabelPolicy_MetadataMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected []string
+	}{
+		{
+			name:     "labels without match adds selector",
+			path:     "/clusters/test-cluster/mimir/api/v1/labels",
+			expected: []string{`{app=~"payments-.*"}`},
+		},
+		{
+			name:     "label values without match adds selector",
+			path:     "/clusters/test-cluster/mimir/api/v1/label/job/values",
+			expected: []string{`{app=~"payments-.*"}`},
+		},
+		{
+			name:     "series match is rewritten",
+			path:     `/clusters/test-cluster/mimir/api/v1/series?match[]={job="api"}`,
+			expected: []string{`{app=~"payments-.*",job="api"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &mockProxyClient{}
+			mux := newLabelPolicyRouter(t, mockClient)
+
+			req := withIdentity(httptest.NewRequest(http.MethodGet, tt.path, nil), "carol", "payments")
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d; body: %s", w.Code, w.Body.String())
+			}
+			got := mockClient.lastForm["match[]"]
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected match[] %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("expected match[] %s, got %s", tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRouter_LabelPolicy_DeniesUnfilterableEndpoints(t *testing.T) {
+	mockClient := &mockProxyClient{}
+	mux := newLabelPolicyRouter(t, mockClient)
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/clusters/test-cluster/mimir/api/v1/read"},
+		{http.MethodGet, "/clusters/test-cluster/mimir/api/v1/cardinality/label_names"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := withIdentity(httptest.NewRequest(tt.method, tt.path, nil), "carol", "payments")
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("expected status 403, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_LabelPolicy_InvalidQuery(t *testing.T) {
+	mux := newLabelPolicyRouter(t, &mockProxyClient{})
+
+	req := withIdentity(httptest.NewRequest(http.MethodGet, `/clusters/test-cluster/mimir/api/v1/query?query=sum(`, nil), "carol", "payments")
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestRouter_EndpointPolicy(t *testing.T) {
+	endpointPolicy, err := policy.NewEndpointPolicy(append([]policy.EndpointRule{
+		{Name: "operators", Action: policy.ActionAllow, Identities: []string{"oncall"}, Paths: []string{"/**"}},
+	}, policy.DefaultMimirEndpointRules...))
+	if err != nil {
+		t.Fatalf("failed to create endpoint policy: %v", err)
+	}
+
+	router := NewRouter(RouterConfig{
+		Clients: map[string]ProxyClient{
+			"test-cluster": &mockProxyClient{},
+		},
+		EndpointPolicy: endpointPolicy,
+	})
+
+	mux := http.NewServeMux()
+	router.RegisterRoutes(mux, "/clusters/{cluster}/mimir")
+
+	tests := []struct {
+		name           string
+		identity       string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"read endpoint", "grafana", http.MethodGet, "/clusters/test-cluster/mimir/api/v1/status/buildinfo", http.StatusOK},
+		{"push", "grafana", http.MethodPost, "/clusters/test-cluster/mimir/api/v1/push", http.StatusForbidden},
+		{"flush", "grafana", http.MethodPost, "/clusters/test-cluster/mimir/flush", http.StatusForbidden},
+		{"operator exception", "oncall", http.MethodPost, "/clusters/test-cluster/mimir/flush", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req = req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{Name: tt.identity}))
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_Limits(t *testing.T) {
+	router := NewRouter(RouterConfig{
+		Clients: map[string]ProxyClient{
+			"test-cluster": &mockProxyClient{},
+		},
+		Limits: limits.NewResolver(
+			limits.Limits{MaxRange: 24 * time.Hour, MinStep: 15 * time.Second, MaxQueryLength: 100, MaxLogLimit: 5000},
+			nil,
+			map[string]limits.Limits{"batch": {MaxRange: 2160 * time.Hour}},
+		),
+	})
+
+	mux := http.NewServeMux()
+	router.RegisterRoutes(mux, "/clusters/{cluster}/mimir")
+
+	tests := []struct {
+		name           string
+		identity       string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "within limits",
+			path:           `/clusters/test-cluster/mimir/api/v1/query_range?query=up&start=1700000000&end=1700003600&step=15`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "range too long",
+			path:           `/clusters/test-cluster/mimir/api/v1/query_range?query=up&start=1700000000&end=1707776000&step=3600`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "identity override",
+			identity:       "batch",
+			path:           `/clusters/test-cluster/mimir/api/v1/query_range?query=up&start=1700000000&end=1707776000&step=3600`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "step too small",
+			path:           `/clusters/test-cluster/mimir/api/v1/query_range?query=up&start=1700000000&end=1700003600&step=1`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "query too long",
+			path:           "/clusters/test-cluster/mimir/api/v1/query?query=" + strings.Repeat("a", 101),
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req = req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{Name: tt.identity}))
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d; body: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusBadRequest {
+				return
+			}
+
+			var resp map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp["status"] != "error" || resp["errorType"] != "bad_data" || resp["error"] == "" {
+				t.Errorf("expected bad_data error response, got %v", resp)
+			}
+		})
+	}
+}
+
+// matrixProxyClient returns a single-series matrix for the requested range.
+type matrixProxyClient struct {
+	calls []url.Values
+}
+
+func (m *matrixProxyClient) ProxyHTTP(_ context.Context, w http.ResponseWriter, r *http.Request, _ string, _ *proxy.HTTPOptions) {
+	m.calls = append(m.calls, r.Form)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"api"},"values":[[%s,"1"],[%s,"1"]]}]}}`,
+		r.Form.Get("start"), r.Form.Get("end"))
+}
+
+func TestRouter_ResultsCache(t *testing.T) {
+	resultsCache, err := cache.NewResultsCache(cache.ResultsCacheConfig{
+		Cache:   cache.NewLRU("test", 1<<20),
+		Backend: "mimir",
+	})
+	if err != nil {
+		t.Fatalf("failed to create results cache: %v", err)
+	}
+
+	client := &matrixProxyClient{}
+	router := NewRouter(RouterConfig{
+		Clients:      map[string]ProxyClient{"test-cluster": client},
+		ResultsCache: resultsCache,
+	})
+
+	mux := http.NewServeMux()
+	router.RegisterRoutes(mux, "/clusters/{cluster}/mimir")
+
+	// Equivalent queries are normalized to the same cache entry
+	paths := []string{
+		"/clusters/test-cluster/mimir/api/v1/query_range?query=sum(rate(http_requests_total[5m]))&start=1700000000&end=1700003600&step=60",
+		"/clusters/test-cluster/mimir/api/v1/query_range?query=sum(rate(http_requests_total[5m]))&start=1700000000&end=1700003600&step=60",
+		"/clusters/test-cluster/mimir/api/v1/query_range?query=sum%20(rate(http_requests_total[5m]))&start=1700000000&end=1700003600&step=60",
+	}
+	for _, path := range paths {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d; body: %s", w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), `"resultType":"matrix"`) {
+			t.Errorf("expected matrix response, got %s", w.Body.String())
+		}
+	}
+
+	if len(client.calls) != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", len(client.calls))
+	}
+	// Upstream requests are aligned to the step
+	if got := client.calls[0].Get("start"); got != "1699999980" {
+		t.Errorf("expected aligned start 1699999980, got %s", got)
+	}
+
+	// A different step is a different cache entry
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/clusters/test-cluster/mimir/api/v1/query_range?query=sum(rate(http_requests_total[5m]))&start=1700000000&end=1700003600&step=30", nil))
+	if len(client.calls) != 2 {
+		t.Errorf("expected 2 upstream requests, got %d", len(client.calls))
+	}
+
+	// @ start() resolves against the bounds of each request, so the query
+	// is sent as is
+	path := "/clusters/test-cluster/mimir/api/v1/query_range?" + url.Values{
+		"query": {"http_requests_total @ start()"},
+		"start": {"1700000000"},
+		"end":   {"1700003600"},
+		"step":  {"60"},
+	}.Encode()
+	for range 2 {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if len(client.calls) != 4 {
+		t.Fatalf("expected 4 upstream requests, got %d", len(client.calls))
+	}
+	if got := client.calls[3].Get("start"); got != "1700000000" {
+		t.Errorf("expected the client's start 1700000000, got %s", got)
+	}
+}
+
+// countingProxyClient returns a fixed label list and counts upstream requests.
+type countingProxyClient struct {
+	calls int
+}
+
+func (m *countingProxyClient) ProxyHTTP(_ context.Context, w http.ResponseWriter, _ *http.Request, _ string, _ *proxy.HTTPOptions) {
+	m.calls++
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"success","data":["job"]}`))
+}
+
+func TestRouter_MetadataCache(t *testing.T) {
+	metadataCache, err := cache.NewMetadataCache(cache.MetadataCacheConfig{
+		Cache:   cache.NewLRU("test", 1<<20),
+		Backend: "mimir",
+	})
+	if err != nil {
+		t.Fatalf("failed to create metadata cache: %v", err)
+	}
+
+	client := &countingProxyClient{}
+	router := NewRouter(RouterConfig{
+		Clients:       map[string]ProxyClient{"test-cluster": client},
+		MetadataCache: metadataCache,
+	})
+
+	mux := http.NewServeMux()
+	router.RegisterRoutes(mux, "/clusters/{cluster}/mimir")
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedCalls int
+	}{
+		{
+			name:          "miss",
+			path:          "/clusters/test-cluster/mimir/api/v1/labels?start=1700000000&end=1700003600",
+			expectedCalls: 1,
+		},
+		{
+			name:          "hit within the same minute",
+			path:          "/clusters/test-cluster/mimir/api/v1/labels?start=1700000010&end=1700003610",
+			expectedCalls: 1,
+		},
+		{
+			name:          "different selector",
+			path:          "/clusters/test-cluster/mimir/api/v1/labels?match[]=%7Bjob=%22api%22%7D&start=1700000000&end=1700003600",
+			expectedCalls: 2,
+		},
+		{
+			name:          "label values",
+			path:          "/clusters/test-cluster/mimir/api/v1/label/job/values?start=1700000000&end=1700003600",
+			expectedCalls: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d; body: %s", tt.name, w.Code, w.Body.String())
+		}
+		if w.Body.String() != `{"status":"success","data":["job"]}` {
+			t.Errorf("%s: unexpected body: %s", tt.name, w.Body.String())
+		}
+		if client.calls != tt.expectedCalls {
+			t.Errorf("%s: expected %d upstream requests, got %d", tt.name, tt.expectedCalls, client.calls)
+		}
+	}
+
+	// A tenant change invalidates the cluster's entries
+	metadataCache.Invalidate("test-cluster")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tests[0].path, nil))
+	if client.calls != 4 {
+		t.Errorf("expected invalidated entry to be fetched again, got %d upstream requests", client.calls)
+	}
+}
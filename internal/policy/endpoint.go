@@ -0,0 +1,203 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+// Endpoint rule actions.
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// EndpointRule allows or denies requests to backend paths that are not served
+// by a dedicated handler.
+type EndpointRule struct {
+	// Name identifies the rule in logs.
+	Name string
+	// Action is either ActionAllow or ActionDeny.
+	Action string
+	// Methods the rule applies to. Empty means all methods.
+	Methods []string
+	// Paths are patterns relative to the backend prefix, e.g. "/api/v1/*".
+	// A "*" matches within a single path segment; a trailing "/**" matches
+	// the prefix and everything below it.
+	Paths []string
+	// Identities and Groups select the callers the rule applies to.
+	// A rule with neither applies to every caller.
+	Identities []string
+	Groups     []string
+}
+
+// DefaultLokiEndpointRules permits the read-only Loki endpoints that are not
+// covered by dedicated handlers, and blocks ingestion and deletion.
+var DefaultLokiEndpointRules = []EndpointRule{
+	{Name: "deny-writes", Action: ActionDeny, Paths: []string{"/api/v1/push", "/api/v1/delete/**"}},
+	{Name: "allow-read", Action: ActionAllow, Methods: []string{http.MethodGet}, Paths: []string{"/api/v1/**"}},
+	{
+		Name:    "allow-read-post",
+		Action:  ActionAllow,
+		Methods: []string{http.MethodPost},
+		Paths: []string{
+			"/api/v1/detected_labels",
+			"/api/v1/detected_fields",
+			"/api/v1/patterns",
+			"/api/v1/index/volume",
+			"/api/v1/index/volume_range",
+			"/api/v1/format_query",
+		},
+	},
+}
+
+// DefaultMimirEndpointRules permits the read-only Prometheus API endpoints
+// that are not covered by dedicated handlers, and blocks ingestion and admin
+// operations.
+var DefaultMimirEndpointRules = []EndpointRule{
+	{Name: "deny-writes", Action: ActionDeny, Paths: []string{"/api/v1/push", "/api/v1/otlp/**", "/api/v1/admin/**"}},
+	{Name: "allow-read", Action: ActionAllow, Methods: []string{http.MethodGet}, Paths: []string{"/api/v1/**"}},
+	{
+		Name:    "allow-read-post",
+		Action:  ActionAllow,
+		Methods: []string{http.MethodPost},
+		Paths: []string{
+			"/api/v1/cardinality/**",
+			"/api/v1/format_query",
+		},
+	},
+}
+
+type compiledEndpointRule struct {
+	name       string
+	allow      bool
+	methods    map[string]bool
+	paths      []string
+	identities map[string]bool
+	groups     []string
+}
+
+// EndpointPolicy decides whether a caller may reach a backend path.
+// Rules are evaluated in order and the first match wins. Requests that match
+// no rule are denied.
+type EndpointPolicy struct {
+	rules []compiledEndpointRule
+}
+
+// NewEndpointPolicy compiles the given rules into an endpoint policy.
+func NewEndpointPolicy(rules []EndpointRule) (*EndpointPolicy, error) {
+	p := &EndpointPolicy{rules: make([]compiledEndpointRule, 0, len(rules))}
+
+	for i, rule := range rules {
+		if rule.Action != ActionAllow && rule.Action != ActionDeny {
+			return nil, fmt.Errorf("endpoint policy %d (%s) has invalid action %q", i, rule.Name, rule.Action)
+		}
+		if len(rule.Paths) == 0 {
+			return nil, fmt.Errorf("endpoint policy %d (%s) has no paths", i, rule.Name)
+		}
+		for _, pattern := range rule.Paths {
+			if err := ValidatePathPattern(pattern); err != nil {
+				return nil, fmt.Errorf("endpoint policy %d (%s): %w", i, rule.Name, err)
+			}
+		}
+
+		methods := make(map[string]bool, len(rule.Methods))
+		for _, m := range rule.Methods {
+			methods[strings.ToUpper(m)] = true
+		}
+
+		p.rules = append(p.rules, compiledEndpointRule{
+			name:       rule.Name,
+			allow:      rule.Action == ActionAllow,
+			methods:    methods,
+			paths:      rule.Paths,
+			identities: toSet(rule.Identities),
+			groups:     rule.Groups,
+		})
+	}
+
+	return p, nil
+}
+
+// ValidatePathPattern checks that pattern is a valid endpoint path pattern.
+func ValidatePathPattern(pattern string) error {
+	if !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("invalid path pattern %q: must start with /", pattern)
+	}
+	if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+		return fmt.Errorf("invalid path pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// Allowed reports whether the caller may send a request with the given method
+// to the given backend path. A nil policy allows everything.
+func (p *EndpointPolicy) Allowed(identity middleware.Identity, method, requestPath string) bool {
+	if p == nil {
+		return true
+	}
+
+	requestPath = path.Clean("/" + requestPath)
+	for _, rule := range p.rules {
+		if rule.matches(identity, method, requestPath) {
+			return rule.allow
+		}
+	}
+	return false
+}
+
+func (r compiledEndpointRule) matches(identity middleware.Identity, method, requestPath string) bool {
+	if len(r.methods) > 0 && !r.methods[method] {
+		return false
+	}
+	if !r.appliesTo(identity) {
+		return false
+	}
+	for _, pattern := range r.paths {
+		if matchPath(pattern, requestPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r compiledEndpointRule) appliesTo(identity middleware.Identity) bool {
+	if len(r.identities) == 0 && len(r.groups) == 0 {
+		return true
+	}
+	if r.identities[identity.Name] {
+		return true
+	}
+	for _, g := range r.groups {
+		if identity.InGroup(g) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(pattern, requestPath string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		if prefix == "" {
+			return true
+		}
+		if ok, _ := path.Match(prefix, requestPath); ok {
+			return true
+		}
+		// Match the prefix against the leading segments of the path
+		segments := strings.Count(prefix, "/")
+		parts := strings.SplitAfterN(requestPath, "/", segments+2)
+		if len(parts) <= segments+1 {
+			return false
+		}
+		head := strings.TrimSuffix(strings.Join(parts[:segments+1], ""), "/")
+		ok, _ := path.Match(prefix, head)
+		return ok
+	}
+
+	ok, _ := path.Match(pattern, requestPath)
+	return ok
+}
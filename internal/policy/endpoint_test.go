@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+func TestNewEndpointPolicy_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []EndpointRule
+		errMsg string
+	}{
+		{
+			name:   "invalid action",
+			rules:  []EndpointRule{{Name: "bad", Action: "permit", Paths: []string{"/api/v1/*"}}},
+			errMsg: "invalid action",
+		},
+		{
+			name:   "no paths",
+			rules:  []EndpointRule{{Name: "empty", Action: ActionAllow}},
+			errMsg: "has no paths",
+		},
+		{
+			name:   "relative path",
+			rules:  []EndpointRule{{Name: "relative", Action: ActionAllow, Paths: []string{"api/v1/*"}}},
+			errMsg: "must start with /",
+		},
+		{
+			name:   "malformed pattern",
+			rules:  []EndpointRule{{Name: "malformed", Action: ActionAllow, Paths: []string{"/api/[v1"}}},
+			errMsg: "invalid path pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEndpointPolicy(tt.rules)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestEndpointPolicy_Allowed(t *testing.T) {
+	rules := append([]EndpointRule{
+		{Name: "operators", Action: ActionAllow, Groups: []string{"operators"}, Paths: []string{"/**"}},
+	}, DefaultMimirEndpointRules...)
+
+	p, err := NewEndpointPolicy(rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	user := middleware.Identity{Name: "grafana"}
+	operator := middleware.Identity{Name: "oncall", Groups: []string{"operators"}}
+
+	tests := []struct {
+		name     string
+		identity middleware.Identity
+		method   string
+		path     string
+		expected bool
+	}{
+		{"read endpoint", user, http.MethodGet, "/api/v1/status/buildinfo", true},
+		{"nested read endpoint", user, http.MethodGet, "/api/v1/cardinality/label_names", true},
+		{"post to read endpoint", user, http.MethodPost, "/api/v1/cardinality/label_values", true},
+		{"post to unlisted endpoint", user, http.MethodPost, "/api/v1/status/buildinfo", false},
+		{"push", user, http.MethodPost, "/api/v1/push", false},
+		{"admin", user, http.MethodGet, "/api/v1/admin/tsdb/delete_series", false},
+		{"path traversal", user, http.MethodGet, "/api/v1/../../flush", false},
+		{"outside api", user, http.MethodGet, "/flush", false},
+		{"ruler config", user, http.MethodPost, "/config/v1/rules/ns", false},
+		{"operator exception", operator, http.MethodPost, "/api/v1/admin/tsdb/delete_series", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Allowed(tt.identity, tt.method, tt.path); got != tt.expected {
+				t.Errorf("Allowed(%s %s) = %v, expected %v", tt.method, tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEndpointPolicy_DefaultLokiRules(t *testing.T) {
+	p, err := NewEndpointPolicy(DefaultLokiEndpointRules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	user := middleware.Identity{Name: "grafana"}
+
+	tests := []struct {
+		method   string
+		path     string
+		expected bool
+	}{
+		{http.MethodGet, "/api/v1/detected_labels", true},
+		{http.MethodPost, "/api/v1/patterns", true},
+		{http.MethodGet, "/api/v1/delete", false},
+		{http.MethodPost, "/api/v1/delete", false},
+		{http.MethodPost, "/api/v1/push", false},
+		{http.MethodPost, "/flush", false},
+		{http.MethodGet, "/config", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := p.Allowed(user, tt.method, tt.path); got != tt.expected {
+				t.Errorf("Allowed(%s %s) = %v, expected %v", tt.method, tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEndpointPolicy_Nil(t *testing.T) {
+	var p *EndpointPolicy
+	if !p.Allowed(middleware.Identity{}, http.MethodPost, "/flush") {
+		t.Error("expected nil policy to allow all requests")
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/api/v1/*", "/api/v1/labels", true},
+		{"/api/v1/*", "/api/v1/label/job/values", false},
+		{"/api/v1/**", "/api/v1", true},
+		{"/api/v1/**", "/api/v1/label/job/values", true},
+		{"/api/v1/**", "/api/v10/labels", false},
+		{"/api/*/rules/**", "/api/v1/rules/ns/group", true},
+		{"/**", "/anything/at/all", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			if got := matchPath(tt.pattern, tt.path); got != tt.expected {
+				t.Errorf("matchPath(%q, %q) = %v, expected %v", tt.pattern, tt.path, got, tt.expected)
+			}
+		})
+	}
+}
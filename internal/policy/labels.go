@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+// LabelRule restricts matching callers to series carrying the given label matchers.
+type LabelRule struct {
+	// Name identifies the rule in logs.
+	Name string
+	// Identities and Groups select the callers the rule applies to.
+	// A rule with neither applies to every caller.
+	Identities []string
+	Groups     []string
+	// Clusters limits the rule to specific clusters. Empty means all clusters.
+	Clusters []string
+	// Matchers are PromQL-style label matchers, e.g. `app=~"payments-.*"`.
+	Matchers []string
+}
+
+type compiledLabelRule struct {
+	name       string
+	identities map[string]bool
+	groups     []string
+	clusters   map[string]bool
+	matchers   []*labels.Matcher
+}
+
+// LabelPolicy resolves the mandatory label matchers for a caller.
+type LabelPolicy struct {
+	rules []compiledLabelRule
+}
+
+// NewLabelPolicy compiles the given rules into a label policy.
+func NewLabelPolicy(rules []LabelRule) (*LabelPolicy, error) {
+	p := &LabelPolicy{rules: make([]compiledLabelRule, 0, len(rules))}
+
+	for i, rule := range rules {
+		if len(rule.Matchers) == 0 {
+			return nil, fmt.Errorf("label policy %d (%s) has no matchers", i, rule.Name)
+		}
+
+		compiled := compiledLabelRule{
+			name:       rule.Name,
+			identities: toSet(rule.Identities),
+			groups:     rule.Groups,
+			clusters:   toSet(rule.Clusters),
+		}
+		for _, m := range rule.Matchers {
+			matchers, err := ParseMatcher(m)
+			if err != nil {
+				return nil, fmt.Errorf("label policy %d (%s): %w", i, rule.Name, err)
+			}
+			compiled.matchers = append(compiled.matchers, matchers...)
+		}
+
+		p.rules = append(p.rules, compiled)
+	}
+
+	return p, nil
+}
+
+// ParseMatcher parses a single PromQL-style matcher expression such as
+// `app=~"payments-.*"`. Several comma-separated matchers are also accepted.
+func ParseMatcher(s string) ([]*labels.Matcher, error) {
+	matchers, err := parser.ParseMetricSelector("{" + s + "}")
+	if err != nil {
+		return nil, fmt.Errorf("invalid matcher %q: %w", s, err)
+	}
+	return matchers, nil
+}
+
+// Matchers returns the label matchers that must be enforced for the caller on
+// the given cluster. It returns nil if no rule applies.
+func (p *LabelPolicy) Matchers(identity middleware.Identity, cluster string) []*labels.Matcher {
+	if p == nil {
+		return nil
+	}
+
+	var result []*labels.Matcher
+	seen := make(map[string]bool)
+	for _, rule := range p.rules {
+		if !rule.appliesTo(identity, cluster) {
+			continue
+		}
+		for _, m := range rule.matchers {
+			if key := m.String(); !seen[key] {
+				seen[key] = true
+				result = append(result, m)
+			}
+		}
+	}
+	return result
+}
+
+func (r compiledLabelRule) appliesTo(identity middleware.Identity, cluster string) bool {
+	if len(r.clusters) > 0 && !r.clusters[cluster] {
+		return false
+	}
+	if len(r.identities) == 0 && len(r.groups) == 0 {
+		return true
+	}
+	if r.identities[identity.Name] {
+		return true
+	}
+	for _, g := range r.groups {
+		if identity.InGroup(g) {
+			return true
+		}
+	}
+	return false
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+func TestNewLabelPolicy_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []LabelRule
+		errMsg string
+	}{
+		{
+			name:   "no matchers",
+			rules:  []LabelRule{{Name: "empty"}},
+			errMsg: "has no matchers",
+		},
+		{
+			name:   "invalid matcher",
+			rules:  []LabelRule{{Name: "bad", Matchers: []string{`app=~`}}},
+			errMsg: "invalid matcher",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLabelPolicy(tt.rules)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestLabelPolicy_Matchers(t *testing.T) {
+	p, err := NewLabelPolicy([]LabelRule{
+		{Name: "payments", Groups: []string{"payments"}, Matchers: []string{`app=~"payments-.*"`}},
+		{Name: "alice", Identities: []string{"alice"}, Matchers: []string{`env="prod"`}},
+		{Name: "eu-only", Identities: []string{"bob"}, Clusters: []string{"prod-eu"}, Matchers: []string{`region="eu"`}},
+		{Name: "duplicate", Groups: []string{"payments"}, Matchers: []string{`app=~"payments-.*"`}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		identity middleware.Identity
+		cluster  string
+		expected []string
+	}{
+		{
+			name:     "group member",
+			identity: middleware.Identity{Name: "carol", Groups: []string{"payments"}},
+			cluster:  "prod-us",
+			expected: []string{`app=~"payments-.*"`},
+		},
+		{
+			name:     "identity and group combined",
+			identity: middleware.Identity{Name: "alice", Groups: []string{"payments"}},
+			cluster:  "prod-us",
+			expected: []string{`app=~"payments-.*"`, `env="prod"`},
+		},
+		{
+			name:     "cluster-scoped rule applies",
+			identity: middleware.Identity{Name: "bob"},
+			cluster:  "prod-eu",
+			expected: []string{`region="eu"`},
+		},
+		{
+			name:     "cluster-scoped rule does not apply elsewhere",
+			identity: middleware.Identity{Name: "bob"},
+			cluster:  "prod-us",
+			expected: nil,
+		},
+		{
+			name:     "unrestricted caller",
+			identity: middleware.Identity{Name: "admin", Groups: []string{"sre"}},
+			cluster:  "prod-us",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchers := p.Matchers(tt.identity, tt.cluster)
+			if len(matchers) != len(tt.expected) {
+				t.Fatalf("expected %d matchers, got %v", len(tt.expected), matchers)
+			}
+			for i, m := range matchers {
+				if m.String() != tt.expected[i] {
+					t.Errorf("matcher %d: expected %s, got %s", i, tt.expected[i], m.String())
+				}
+			}
+		})
+	}
+}
+
+func TestLabelPolicy_AppliesToEveryone(t *testing.T) {
+	p, err := NewLabelPolicy([]LabelRule{{Name: "global", Matchers: []string{`env="prod"`}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := p.Matchers(middleware.Identity{Name: middleware.AnonymousIdentity}, "any"); len(got) != 1 {
+		t.Errorf("expected rule without selectors to apply to everyone, got %v", got)
+	}
+
+	var nilPolicy *LabelPolicy
+	if got := nilPolicy.Matchers(middleware.Identity{Name: "alice"}, "any"); got != nil {
+		t.Errorf("expected nil policy to return no matchers, got %v", got)
+	}
+}
@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// RewriteLogQL adds the given matchers to every stream selector in a LogQL query.
+//
+// Stream selectors are the only place where braces appear in LogQL outside of
+// string literals (line_format and label_format templates are always quoted),
+// so the query is scanned for brace pairs while skipping strings. Queries with
+// comments are rejected. The rest of the query is left untouched.
+func RewriteLogQL(query string, matchers []*labels.Matcher) (string, error) {
+	if len(matchers) == 0 {
+		return query, nil
+	}
+
+	extra := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		extra = append(extra, m.String())
+	}
+	injected := strings.Join(extra, ", ")
+
+	var out strings.Builder
+	selectorStart := -1
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch c {
+		case '"', '`':
+			end, err := skipString(query, i)
+			if err != nil {
+				return "", err
+			}
+			if selectorStart < 0 {
+				out.WriteString(query[i : end+1])
+			}
+			i = end
+			continue
+		case '#':
+			// A comment can hide a closing brace or a quote from the scanner,
+			// and leave part of a selector without the injected matchers
+			return "", fmt.Errorf("comments are not allowed in queries under a label policy (position %d)", i)
+		case '{':
+			if selectorStart >= 0 {
+				return "", fmt.Errorf("unexpected '{' in stream selector at position %d", i)
+			}
+			selectorStart = i
+			continue
+		case '}':
+			if selectorStart < 0 {
+				return "", fmt.Errorf("unexpected '}' at position %d", i)
+			}
+			body := strings.TrimSpace(query[selectorStart+1 : i])
+			out.WriteByte('{')
+			if body != "" {
+				out.WriteString(body)
+				out.WriteString(", ")
+			}
+			out.WriteString(injected)
+			out.WriteByte('}')
+			selectorStart = -1
+			continue
+		}
+
+		if selectorStart < 0 {
+			out.WriteByte(c)
+		}
+	}
+
+	if selectorStart >= 0 {
+		return "", fmt.Errorf("unterminated stream selector")
+	}
+
+	return out.String(), nil
+}
+
+// LogSelectorString formats matchers as a LogQL stream selector.
+func LogSelectorString(matchers []*labels.Matcher) string {
+	parts := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		parts = append(parts, m.String())
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// skipString returns the index of the closing quote of the string literal
+// starting at query[start].
+func skipString(query string, start int) (int, error) {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			// Backtick strings are raw and have no escapes
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string literal at position %d", start)
+}
@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestRewriteLogQL(t *testing.T) {
+	matchers, err := ParseMatcher(`app=~"payments-.*"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "simple selector",
+			query:    `{job="api"}`,
+			expected: `{job="api", app=~"payments-.*"}`,
+		},
+		{
+			name:     "empty selector",
+			query:    `{}`,
+			expected: `{app=~"payments-.*"}`,
+		},
+		{
+			name:     "pipeline with braces in strings",
+			query:    `{job="api"} |= "{not a selector}" | line_format "{{.msg}}"`,
+			expected: `{job="api", app=~"payments-.*"} |= "{not a selector}" | line_format "{{.msg}}"`,
+		},
+		{
+			name:     "backtick template",
+			query:    "{job=\"api\"} | label_format x=`{{.y}}`",
+			expected: "{job=\"api\", app=~\"payments-.*\"} | label_format x=`{{.y}}`",
+		},
+		{
+			name:     "escaped quote in selector value",
+			query:    `{msg="a \"}\" b"}`,
+			expected: `{msg="a \"}\" b", app=~"payments-.*"}`,
+		},
+		{
+			name:     "metric query with multiple selectors",
+			query:    `sum(rate({job="a"}[5m])) / sum(rate({job="b"}[5m]))`,
+			expected: `sum(rate({job="a", app=~"payments-.*"}[5m])) / sum(rate({job="b", app=~"payments-.*"}[5m]))`,
+		},
+		{
+			name:     "hash in string",
+			query:    `{job="a#b"} |= "# not a comment"`,
+			expected: `{job="a#b", app=~"payments-.*"} |= "# not a comment"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RewriteLogQL(tt.query, matchers)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRewriteLogQL_Invalid(t *testing.T) {
+	matchers, _ := ParseMatcher(`app="x"`)
+
+	queries := []string{
+		`{job="a"`,
+		`job="a"}`,
+		`{job="a}`,
+		`{{job="a"}}`,
+		"{job=\"a\"} # {ignored}\n|= \"x\"",
+		// A comment hiding the closing brace of the selector
+		"{job=\"x\" # \"\n} # \"}",
+	}
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			if _, err := RewriteLogQL(query, matchers); err == nil {
+				t.Errorf("expected error for %q", query)
+			}
+		})
+	}
+}
+
+func TestLogSelectorString(t *testing.T) {
+	matchers, _ := ParseMatcher(`app="x", env!="dev"`)
+	if got := LogSelectorString(matchers); got != `{app="x", env!="dev"}` {
+		t.Errorf("unexpected selector: %s", got)
+	}
+}
@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+func init() {
+	// The proxy only parses queries to rewrite them, so it must not reject
+	// syntax that the backend itself accepts.
+	parser.EnableExperimentalFunctions = true
+	parser.ExperimentalDurationExpr = true
+}
+
+// RewritePromQL adds the given matchers to every vector selector in a PromQL query.
+func RewritePromQL(query string, matchers []*labels.Matcher) (string, error) {
+	if len(matchers) == 0 {
+		return query, nil
+	}
+
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse query: %w", err)
+	}
+
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			vs.LabelMatchers = appendMatchers(vs.LabelMatchers, matchers)
+		}
+		return nil
+	})
+
+	return expr.String(), nil
+}
+
+// RewriteSeriesSelectors adds the given matchers to each series selector, as
+// used by the match[] parameter of the metadata endpoints. If selectors is
+// empty, a single selector consisting of only the matchers is returned so that
+// unfiltered requests are restricted too.
+func RewriteSeriesSelectors(selectors []string, matchers []*labels.Matcher) ([]string, error) {
+	if len(matchers) == 0 {
+		return selectors, nil
+	}
+	if len(selectors) == 0 {
+		return []string{SelectorString(matchers)}, nil
+	}
+
+	rewritten := make([]string, 0, len(selectors))
+	for _, s := range selectors {
+		existing, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse selector %q: %w", s, err)
+		}
+		vs := &parser.VectorSelector{LabelMatchers: appendMatchers(existing, matchers)}
+		rewritten = append(rewritten, vs.String())
+	}
+	return rewritten, nil
+}
+
+// SelectorString formats matchers as a selector, e.g. {app=~"payments-.*"}.
+func SelectorString(matchers []*labels.Matcher) string {
+	vs := &parser.VectorSelector{LabelMatchers: matchers}
+	return vs.String()
+}
+
+func appendMatchers(existing, extra []*labels.Matcher) []*labels.Matcher {
+	result := make([]*labels.Matcher, 0, len(existing)+len(extra))
+	result = append(result, existing...)
+	return append(result, extra...)
+}
@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestRewritePromQL(t *testing.T) {
+	matchers, err := ParseMatcher(`app=~"payments-.*"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			query:    `up`,
+			expected: `up{app=~"payments-.*"}`,
+		},
+		{
+			query:    `sum by (job) (rate(http_requests_total{status="500"}[5m]))`,
+			expected: `sum by (job) (rate(http_requests_total{app=~"payments-.*",status="500"}[5m]))`,
+		},
+		{
+			query:    `a / on(job) b`,
+			expected: `a{app=~"payments-.*"} / on (job) b{app=~"payments-.*"}`,
+		},
+		{
+			query:    `max_over_time(rate(x[1m])[10m:1m])`,
+			expected: `max_over_time(rate(x{app=~"payments-.*"}[1m])[10m:1m])`,
+		},
+		{
+			// Existing matchers on the same label are kept, both must match
+			query:    `up{app="other"}`,
+			expected: `up{app="other",app=~"payments-.*"}`,
+		},
+		{
+			query:    `vector(1)`,
+			expected: `vector(1)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := RewritePromQL(tt.query, matchers)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRewritePromQL_Invalid(t *testing.T) {
+	matchers, _ := ParseMatcher(`app="x"`)
+	if _, err := RewritePromQL(`sum(`, matchers); err == nil {
+		t.Error("expected error for invalid query")
+	}
+}
+
+func TestRewritePromQL_NoMatchers(t *testing.T) {
+	got, err := RewritePromQL(`sum(`, nil)
+	if err != nil || got != `sum(` {
+		t.Errorf("expected query unchanged without matchers, got %q, %v", got, err)
+	}
+}
+
+func TestRewriteSeriesSelectors(t *testing.T) {
+	matchers, _ := ParseMatcher(`app="payments"`)
+
+	got, err := RewriteSeriesSelectors([]string{`up`, `{job="api"}`}, matchers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{`{__name__="up",app="payments"}`, `{app="payments",job="api"}`}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("selector %d: expected %s, got %s", i, expected[i], got[i])
+		}
+	}
+
+	got, err = RewriteSeriesSelectors(nil, matchers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0] != `{app="payments"}` {
+		t.Errorf("expected a selector to be added, got %v", got)
+	}
+
+	if _, err := RewriteSeriesSelectors([]string{`{`}, matchers); err == nil {
+		t.Error("expected error for invalid selector")
+	}
+}
@@ -0,0 +1,372 @@
+// Package prober runs canary queries against each cluster through the
+// proxy's own routes, so that broken federation is noticed before users
+// notice it.
+package prober
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+// Identity is the caller identity of canary queries, as seen by policies,
+// limits and logs.
+const Identity = "prober"
+
+// defaultLokiRange is the range of Loki probes without one, since Loki does
+// not run log queries as instant queries.
+const defaultLokiRange = 5 * time.Minute
+
+// Probe is a canary query and the result it must return.
+type Probe struct {
+	Name    string
+	Cluster string
+	// Backend is "loki" or "mimir".
+	Backend string
+	Query   string
+	// Range runs a range query over the last Range instead of an instant
+	// query.
+	Range  time.Duration
+	Expect Expectation
+}
+
+// Expectation lists the assertions on a probe result. Unset fields are not
+// checked.
+type Expectation struct {
+	// ResultType is the expected resultType, such as "vector" or "streams".
+	ResultType string
+	// MinResults is the minimum number of series or streams.
+	MinResults int
+	// Value is the expected value of the first series: its sample for
+	// instant queries, or its latest sample for range queries.
+	Value *float64
+}
+
+// Result is the outcome of the latest run of a probe.
+type Result struct {
+	Name        string    `json:"name"`
+	Cluster     string    `json:"cluster"`
+	Backend     string    `json:"backend"`
+	Query       string    `json:"query"`
+	Success     bool      `json:"success"`
+	LastRun     time.Time `json:"lastRun,omitzero"`
+	LastSuccess time.Time `json:"lastSuccess,omitzero"`
+	DurationMS  float64   `json:"durationMs"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Config holds configuration for creating a prober.
+type Config struct {
+	// Handler serves the probe requests, normally the proxy's handler chain
+	// without authentication.
+	Handler http.Handler
+	// Interval between two rounds of probes. Defaults to 1m.
+	Interval time.Duration
+	// Timeout of a single probe. Defaults to 10s.
+	Timeout time.Duration
+	Probes  []Probe
+}
+
+// Prober runs probes in the background and keeps their latest results.
+type Prober struct {
+	handler  http.Handler
+	probes   []Probe
+	interval time.Duration
+	timeout  time.Duration
+
+	results map[string]Result
+	mu      sync.RWMutex
+
+	started bool
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// New creates a prober.
+func New(cfg Config) (*Prober, error) {
+	if cfg.Handler == nil {
+		return nil, fmt.Errorf("handler is required")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	probes := make([]Probe, 0, len(cfg.Probes))
+	results := make(map[string]Result, len(cfg.Probes))
+	for _, p := range cfg.Probes {
+		if p.Backend != "loki" && p.Backend != "mimir" {
+			return nil, fmt.Errorf("probe %s: unknown backend %q", p.Name, p.Backend)
+		}
+		if p.Backend == "loki" && p.Range == 0 {
+			p.Range = defaultLokiRange
+		}
+		probes = append(probes, p)
+		results[p.Name] = Result{Name: p.Name, Cluster: p.Cluster, Backend: p.Backend, Query: p.Query}
+	}
+
+	return &Prober{
+		handler:  cfg.Handler,
+		probes:   probes,
+		interval: cfg.Interval,
+		timeout:  cfg.Timeout,
+		results:  results,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}, nil
+}
+
+// Start runs all probes immediately and then on every interval, until Stop
+// is called or ctx is cancelled.
+func (p *Prober) Start(ctx context.Context) {
+	p.mu.Lock()
+	p.started = true
+	p.mu.Unlock()
+
+	go func() {
+		defer close(p.doneCh)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			p.RunNow(ctx)
+
+			select {
+			case <-ticker.C:
+			case <-p.stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background probes and waits for a running round to finish.
+// It is a no-op if the prober was never started.
+func (p *Prober) Stop() {
+	p.mu.RLock()
+	started := p.started
+	p.mu.RUnlock()
+	if !started {
+		return
+	}
+
+	close(p.stopCh)
+	<-p.doneCh
+}
+
+// RunNow runs all probes concurrently and records their results.
+func (p *Prober) RunNow(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, probe := range p.probes {
+		wg.Add(1)
+		go func(probe Probe) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := p.run(ctx, probe, start)
+			p.record(probe, start, time.Since(start), err)
+		}(probe)
+	}
+	wg.Wait()
+}
+
+// Results returns the latest result of every probe, sorted by name.
+func (p *Prober) Results() []Result {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	results := make([]Result, 0, len(p.results))
+	for _, r := range p.results {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+func (p *Prober) record(probe Probe, start time.Time, duration time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := p.results[probe.Name]
+	wasFailing := !result.LastRun.IsZero() && !result.Success
+	result.LastRun = start
+	result.DurationMS = float64(duration.Microseconds()) / 1000
+	result.Success = err == nil
+	result.Error = ""
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.LastSuccess = start
+	}
+	p.results[probe.Name] = result
+
+	labels := []string{probe.Name, probe.Cluster, probe.Backend}
+	metrics.ProbeDuration.WithLabelValues(labels...).Observe(duration.Seconds())
+	if err != nil {
+		metrics.ProbeSuccess.WithLabelValues(labels...).Set(0)
+	} else {
+		metrics.ProbeSuccess.WithLabelValues(labels...).Set(1)
+		metrics.ProbeLastSuccess.WithLabelValues(labels...).Set(float64(start.Unix()))
+	}
+
+	// Log state changes only, not every failed run
+	switch {
+	case err != nil && !wasFailing:
+		log.Warn().Err(err).Str("probe", probe.Name).Str("cluster", probe.Cluster).Str("backend", probe.Backend).Msg("probe failing")
+	case err == nil && wasFailing:
+		log.Info().Str("probe", probe.Name).Str("cluster", probe.Cluster).Str("backend", probe.Backend).Msg("probe recovered")
+	}
+}
+
+// run sends the probe's query through the handler and checks the result.
+func (p *Prober) run(ctx context.Context, probe Probe, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	ctx = middleware.WithIdentity(ctx, middleware.Identity{Name: Identity})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.url(now), nil)
+	if err != nil {
+		return err
+	}
+
+	w := newResponseRecorder()
+	p.handler.ServeHTTP(w, req)
+
+	var resp apiResponse
+	if err := json.Unmarshal(w.body.Bytes(), &resp); err != nil {
+		if w.statusCode != http.StatusOK {
+			return fmt.Errorf("status %d: %s", w.statusCode, strings.TrimSpace(w.body.String()))
+		}
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if w.statusCode != http.StatusOK || resp.Status != "success" {
+		return fmt.Errorf("status %d: %s", w.statusCode, resp.Error)
+	}
+	return probe.Expect.check(resp)
+}
+
+// url returns the path and query of the probe's request on the proxy.
+func (p Probe) url(now time.Time) string {
+	params := url.Values{"query": {p.Query}}
+	endpoint := "query"
+	if p.Range > 0 {
+		endpoint = "query_range"
+		step := max(p.Range/60, time.Second)
+		params.Set("start", strconv.FormatInt(now.Add(-p.Range).Unix(), 10))
+		params.Set("end", strconv.FormatInt(now.Unix(), 10))
+		params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	} else {
+		params.Set("time", strconv.FormatInt(now.Unix(), 10))
+	}
+
+	return fmt.Sprintf("/clusters/%s/%s/api/v1/%s?%s", url.PathEscape(p.Cluster), p.Backend, endpoint, params.Encode())
+}
+
+// apiResponse is a Prometheus or Loki query response.
+type apiResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// series is an element of a vector, matrix or streams result.
+type series struct {
+	Value  []json.RawMessage   `json:"value"`
+	Values [][]json.RawMessage `json:"values"`
+}
+
+func (e Expectation) check(resp apiResponse) error {
+	resultType := resp.Data.ResultType
+	if e.ResultType != "" && resultType != e.ResultType {
+		return fmt.Errorf("expected result type %s, got %s", e.ResultType, resultType)
+	}
+
+	// Scalars and strings are a single [time, value] pair
+	var results []series
+	if resultType == "scalar" || resultType == "string" {
+		var sample []json.RawMessage
+		if err := json.Unmarshal(resp.Data.Result, &sample); err != nil {
+			return fmt.Errorf("invalid %s result: %w", resultType, err)
+		}
+		results = []series{{Value: sample}}
+	} else if err := json.Unmarshal(resp.Data.Result, &results); err != nil {
+		return fmt.Errorf("invalid %s result: %w", resultType, err)
+	}
+
+	if len(results) < e.MinResults {
+		return fmt.Errorf("expected at least %d results, got %d", e.MinResults, len(results))
+	}
+
+	if e.Value == nil {
+		return nil
+	}
+	if resultType == "streams" {
+		return fmt.Errorf("cannot check the value of a streams result")
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("expected value %g, got no results", *e.Value)
+	}
+	sample := results[0].Value
+	if values := results[0].Values; len(values) > 0 {
+		sample = values[len(values)-1]
+	}
+	if len(sample) != 2 {
+		return fmt.Errorf("expected value %g, got no samples", *e.Value)
+	}
+	var raw string
+	if err := json.Unmarshal(sample[1], &raw); err != nil {
+		return fmt.Errorf("invalid sample value: %w", err)
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return fmt.Errorf("invalid sample value %q", raw)
+	}
+	if value != *e.Value {
+		return fmt.Errorf("expected value %g, got %g", *e.Value, value)
+	}
+	return nil
+}
+
+// responseRecorder captures the response of the handler to a probe.
+type responseRecorder struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	r.statusCode = code
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
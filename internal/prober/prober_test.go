@@ -0,0 +1,138 @@
+package prober
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+func float(v float64) *float64 { return &v }
+
+func TestProber(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		if middleware.IdentityFromContext(r.Context()).Name != Identity {
+			t.Errorf("expected probe identity, got %s", middleware.IdentityFromContext(r.Context()).Name)
+		}
+		switch r.URL.Query().Get("query") {
+		case "vector(1)":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"1"]}]}}`))
+		case `{app="api"}`:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("no endpoints available"))
+		}
+	})
+
+	p, err := New(Config{
+		Handler: handler,
+		Probes: []Probe{
+			{Name: "mimir", Cluster: "prod", Backend: "mimir", Query: "vector(1)", Expect: Expectation{ResultType: "vector", Value: float(1)}},
+			{Name: "loki", Cluster: "prod", Backend: "loki", Query: `{app="api"}`, Expect: Expectation{MinResults: 1}},
+			{Name: "broken", Cluster: "dev", Backend: "mimir", Query: "up"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create prober: %v", err)
+	}
+
+	// Results are listed before the first run
+	if results := p.Results(); len(results) != 3 || !results[0].LastRun.IsZero() {
+		t.Fatalf("unexpected initial results: %+v", results)
+	}
+
+	p.RunNow(context.Background())
+
+	results := make(map[string]Result)
+	for _, r := range p.Results() {
+		results[r.Name] = r
+	}
+	if r := results["mimir"]; !r.Success || r.LastSuccess.IsZero() || r.Error != "" {
+		t.Errorf("expected mimir probe to succeed, got %+v", r)
+	}
+	if r := results["loki"]; r.Success || r.Error != "expected at least 1 results, got 0" {
+		t.Errorf("expected loki probe to fail its assertion, got %+v", r)
+	}
+	if r := results["broken"]; r.Success || r.Error != "status 502: no endpoints available" {
+		t.Errorf("expected broken probe to fail, got %+v", r)
+	}
+
+	paths := make(map[string]*http.Request)
+	for _, r := range requests {
+		paths[r.URL.Path] = r
+	}
+	if r, ok := paths["/clusters/prod/mimir/api/v1/query"]; !ok || r.URL.Query().Get("time") == "" {
+		t.Errorf("expected an instant Mimir query, got %v", paths)
+	}
+	r, ok := paths["/clusters/prod/loki/api/v1/query_range"]
+	if !ok {
+		t.Fatalf("expected a Loki range query, got %v", paths)
+	}
+	if r.URL.Query().Get("step") != "5" {
+		t.Errorf("expected a 5m range in 5s steps, got %s", r.URL.RawQuery)
+	}
+}
+
+func TestExpectation_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		expect  Expectation
+		data    string
+		wantErr string
+	}{
+		{"scalar value", Expectation{Value: float(1)}, `{"resultType":"scalar","result":[1700000000,"1"]}`, ""},
+		{"wrong value", Expectation{Value: float(2)}, `{"resultType":"vector","result":[{"value":[1700000000,"1"]}]}`, "expected value 2, got 1"},
+		{"latest sample of matrix", Expectation{Value: float(3)}, `{"resultType":"matrix","result":[{"values":[[1,"1"],[2,"3"]]}]}`, ""},
+		{"wrong result type", Expectation{ResultType: "streams"}, `{"resultType":"matrix","result":[]}`, "expected result type streams, got matrix"},
+		{"value of empty result", Expectation{Value: float(1)}, `{"resultType":"vector","result":[]}`, "expected value 1, got no results"},
+		{"value of streams", Expectation{Value: float(1)}, `{"resultType":"streams","result":[{"values":[["1","line"]]}]}`, "cannot check the value of a streams result"},
+		{"no assertions", Expectation{}, `{"resultType":"vector","result":[]}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := New(Config{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{"status":"success","data":` + tt.data + `}`))
+				}),
+				Probes: []Probe{{Name: "probe", Backend: "mimir", Query: "q", Expect: tt.expect}},
+			})
+			p.RunNow(context.Background())
+
+			if got := p.Results()[0].Error; got != tt.wantErr {
+				t.Errorf("expected error %q, got %q", tt.wantErr, got)
+			}
+		})
+	}
+}
+
+func TestProbe_URL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	probe := Probe{Cluster: "prod", Backend: "mimir", Query: "sum(up)", Range: time.Hour}
+
+	u, err := url.Parse(probe.url(now))
+	if err != nil {
+		t.Fatalf("invalid URL: %v", err)
+	}
+	if u.Path != "/clusters/prod/mimir/api/v1/query_range" {
+		t.Errorf("unexpected path %s", u.Path)
+	}
+	q := u.Query()
+	if q.Get("query") != "sum(up)" || q.Get("start") != "1699996400" || q.Get("end") != "1700000000" || q.Get("step") != "60" {
+		t.Errorf("unexpected parameters %s", u.RawQuery)
+	}
+	if strings.Contains(u.RawQuery, "time=") {
+		t.Errorf("range query should not set time, got %s", u.RawQuery)
+	}
+}
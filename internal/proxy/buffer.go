@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// BufferedResponseWriter captures a response in memory so that it can be
+// inspected or rewritten before being sent to the client.
+type BufferedResponseWriter struct {
+	header     http.Header
+	StatusCode int
+	Body       bytes.Buffer
+}
+
+// NewBufferedResponseWriter creates an empty buffered response writer.
+func NewBufferedResponseWriter() *BufferedResponseWriter {
+	return &BufferedResponseWriter{
+		header:     make(http.Header),
+		StatusCode: http.StatusOK,
+	}
+}
+
+// Header returns the captured response headers.
+func (b *BufferedResponseWriter) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader records the status code.
+func (b *BufferedResponseWriter) WriteHeader(statusCode int) {
+	b.StatusCode = statusCode
+}
+
+// Write appends to the captured body.
+func (b *BufferedResponseWriter) Write(p []byte) (int, error) {
+	return b.Body.Write(p)
+}
+
+// CopyTo writes the captured headers, status code and body to w.
+func (b *BufferedResponseWriter) CopyTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(b.StatusCode)
+	w.Write(b.Body.Bytes())
+}
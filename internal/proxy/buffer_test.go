@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBufferedResponseWriter(t *testing.T) {
+	buf := NewBufferedResponseWriter()
+
+	if buf.StatusCode != http.StatusOK {
+		t.Errorf("expected default status 200, got %d", buf.StatusCode)
+	}
+
+	buf.Header().Set("Content-Type", "application/json")
+	buf.Header().Set("Content-Length", "2")
+	buf.WriteHeader(http.StatusTeapot)
+	buf.Write([]byte(`{}`))
+
+	buf.Body.Reset()
+	buf.Body.WriteString(`{"rewritten":true}`)
+
+	w := httptest.NewRecorder()
+	buf.CopyTo(w)
+
+	if w.Code != http.StatusTeapot {
+		t.Errorf("expected status 418, got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected content type application/json, got %s", got)
+	}
+	if got := w.Header().Get("Content-Length"); got != "" {
+		t.Errorf("expected stale content length to be dropped, got %s", got)
+	}
+	if got := w.Body.String(); got != `{"rewritten":true}` {
+		t.Errorf("unexpected body: %s", got)
+	}
+}
@@ -2,16 +2,24 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+
+	"github.com/tjorri/observability-federation-proxy/internal/breaker"
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+	"github.com/tjorri/observability-federation-proxy/internal/queue"
 )
 
 // Client proxies HTTP requests through the Kubernetes API service proxy.
@@ -19,21 +27,50 @@ import (
 type Client struct {
 	k8sClient  kubernetes.Interface
 	restClient rest.Interface
+	cluster    string
+	backend    string
 	namespace  string
 	service    string
 	port       int
 	pathPrefix string
 	timeout    time.Duration
+	coalescer  *coalescer
+	limiter    *queue.Limiter
+	fairBy     string
+	breaker    *breaker.Breaker
+	retry      *retryPolicy
 }
 
 // ClientConfig holds configuration for creating a proxy client.
 type ClientConfig struct {
-	K8sClient  kubernetes.Interface
+	K8sClient kubernetes.Interface
+	// RESTClient is used to reach the API server. Defaults to the core REST
+	// client of K8sClient, which shares its rate limiter with every other
+	// user of K8sClient.
+	RESTClient rest.Interface
+	// Cluster and Backend identify the client in metrics and logs.
+	Cluster    string
+	Backend    string
 	Namespace  string
 	Service    string
 	Port       int
 	PathPrefix string
 	Timeout    time.Duration
+	// Coalesce shares one upstream call between identical concurrent
+	// requests.
+	Coalesce bool
+	// Limiter limits concurrent upstream requests. A nil limiter allows any
+	// number of requests.
+	Limiter *queue.Limiter
+	// FairBy selects how queued requests are grouped for fairness: by
+	// "identity" (the default) or by "tenant" header.
+	FairBy string
+	// Breaker fails requests fast while the backend is unavailable. A nil
+	// breaker sends every request.
+	Breaker *breaker.Breaker
+	// Retry retries and hedges read requests. A nil config sends each
+	// request once.
+	Retry *RetryConfig
 }
 
 // NewClient creates a new K8s API proxy client.
@@ -56,30 +93,164 @@ func NewClient(cfg ClientConfig) (*Client, error) {
 		timeout = 30 * time.Second
 	}
 
-	return &Client{
+	restClient := cfg.RESTClient
+	if restClient == nil {
+		restClient = cfg.K8sClient.CoreV1().RESTClient()
+	}
+
+	client := &Client{
 		k8sClient:  cfg.K8sClient,
-		restClient: cfg.K8sClient.CoreV1().RESTClient(),
+		restClient: restClient,
+		cluster:    cfg.Cluster,
+		backend:    cfg.Backend,
 		namespace:  cfg.Namespace,
 		service:    cfg.Service,
 		port:       cfg.Port,
 		pathPrefix: cfg.PathPrefix,
 		timeout:    timeout,
-	}, nil
+		limiter:    cfg.Limiter,
+		fairBy:     cfg.FairBy,
+		breaker:    cfg.Breaker,
+	}
+	if cfg.Coalesce {
+		client.coalescer = newCoalescer()
+	}
+	if cfg.Retry != nil {
+		client.retry = newRetryPolicy(*cfg.Retry)
+	}
+	return client, nil
+}
+
+// ProxyRequest proxies an HTTP request through the K8s API server. When
+// coalescing is enabled, identical concurrent requests share one upstream
+// call and receive the same response. Read requests are retried if a retry
+// policy is configured.
+func (c *Client) ProxyRequest(ctx context.Context, req *Request) (resp *Response, err error) {
+	ctx, span := c.startSpan(ctx, "proxy "+endpointClass(req.Path))
+	defer func() { endSpan(span, err) }()
+
+	if c.coalescer == nil {
+		return c.sendWithRetries(ctx, req)
+	}
+
+	key, ok := c.coalesceKey(req)
+	if !ok {
+		return c.sendWithRetries(ctx, req)
+	}
+
+	resp, shared, err := c.coalescer.do(ctx, key, func(ctx context.Context) (*Response, error) {
+		return c.sendWithRetries(ctx, req)
+	})
+	if shared {
+		// The upstream request belongs to the trace of the first caller
+		span.SetAttributes(attribute.Bool("coalesced", true))
+		metrics.CoalescedRequestsTotal.WithLabelValues(c.cluster, c.backend).Inc()
+	}
+	return resp, err
+}
+
+// Breaker returns the client's circuit breaker, or nil if it has none.
+func (c *Client) Breaker() *breaker.Breaker {
+	return c.breaker
+}
+
+// Ready checks the backend through its readiness endpoint at path, which is
+// not under the path prefix of the API. The check bypasses the circuit breaker,
+// concurrency limiter and retries, so that it reports the state of the
+// backend itself.
+func (c *Client) Ready(ctx context.Context, path string) error {
+	resp, err := c.doRequest(ctx, &Request{Method: http.MethodGet, Path: path, noPathPrefix: true})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("readiness check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ProxyAdminRequest sends a request to an admin endpoint of the backend,
+// such as the distributor's tenant listing, which is not under the path
+// prefix of the API. It goes through the circuit breaker and concurrency
+// limiter, but is not retried or coalesced.
+func (c *Client) ProxyAdminRequest(ctx context.Context, req *Request) (resp *Response, err error) {
+	ctx, span := c.startSpan(ctx, "proxy "+endpointClass(req.Path))
+	defer func() { endSpan(span, err) }()
+
+	admin := *req
+	admin.noPathPrefix = true
+	return c.send(ctx, &admin)
 }
 
-// ProxyRequest proxies an HTTP request through the K8s API server.
-func (c *Client) ProxyRequest(ctx context.Context, req *Request) (*Response, error) {
+// send sends the request unless the circuit breaker is open, and reports the
+// outcome to the breaker.
+func (c *Client) send(ctx context.Context, req *Request) (*Response, error) {
+	if c.breaker == nil {
+		return c.admit(ctx, req)
+	}
+
+	done, err := c.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.admit(ctx, req)
+	done(breakerOutcome(ctx, resp, err))
+	return resp, err
+}
+
+// breakerOutcome classifies a result for the circuit breaker. Only errors
+// and 5xx responses count as failures; 4xx responses mean the backend is
+// answering. Cancelled and queue-rejected requests say nothing about the
+// backend.
+func breakerOutcome(ctx context.Context, resp *Response, err error) breaker.Outcome {
+	var rejected *queue.RejectedError
+	switch {
+	case err == nil:
+		return breaker.Success
+	case ctx.Err() != nil, errors.As(err, &rejected):
+		return breaker.Ignored
+	case resp == nil, resp.StatusCode >= 500:
+		return breaker.Failure
+	default:
+		return breaker.Success
+	}
+}
+
+// admit waits for a concurrency slot, if limited, and sends the request.
+func (c *Client) admit(ctx context.Context, req *Request) (*Response, error) {
+	if c.limiter != nil {
+		queueCtx, span := c.startSpan(ctx, "queue")
+		release, err := c.limiter.Acquire(queueCtx, c.fairnessKey(ctx, req))
+		endSpan(span, err)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	return c.doRequest(ctx, req)
+}
+
+// fairnessKey groups queued requests by caller identity or tenant header.
+func (c *Client) fairnessKey(ctx context.Context, req *Request) string {
+	if c.fairBy == "tenant" {
+		return req.Headers.Get("X-Scope-OrgID")
+	}
+	return middleware.IdentityFromContext(ctx).Name
+}
+
+// doRequest sends a single request through the K8s API server.
+func (c *Client) doRequest(ctx context.Context, req *Request) (*Response, error) {
 	if c.restClient == nil {
 		return nil, fmt.Errorf("REST client not initialized")
 	}
 
 	// Build the full path including any path prefix
-	fullPath := c.pathPrefix + req.Path
+	fullPath := c.fullPath(req)
 
 	// Build the proxy path (for logging)
 	proxyPath := c.buildProxyPath(fullPath)
 
-	log.Debug().
+	log.Ctx(ctx).Debug().
 		Str("namespace", c.namespace).
 		Str("service", c.service).
 		Int("port", c.port).
@@ -105,6 +276,11 @@ func (c *Client) ProxyRequest(ctx context.Context, req *Request) (*Response, err
 		RequestURI(servicePath).
 		Timeout(c.timeout)
 
+	// Retries are left to the retry policy, which keeps them within budget
+	if c.retry != nil {
+		restReq = restReq.MaxRetries(0)
+	}
+
 	// Add headers
 	for key, values := range req.Headers {
 		for _, value := range values {
@@ -117,6 +293,18 @@ func (c *Client) ProxyRequest(ctx context.Context, req *Request) (*Response, err
 		restReq = restReq.Body(req.Body)
 	}
 
+	// Continue the trace in the backend, replacing any trace context of the
+	// caller
+	ctx, observer := c.observeUpstream(ctx, req)
+	for key, values := range traceHeaders(ctx) {
+		restReq = restReq.SetHeader(key, values...)
+	}
+
+	// Let backend logs be correlated with ours
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		restReq = restReq.SetHeader(middleware.RequestIDHeader, id)
+	}
+
 	// Execute the request
 	result := restReq.Do(ctx)
 
@@ -127,21 +315,20 @@ func (c *Client) ProxyRequest(ctx context.Context, req *Request) (*Response, err
 		var statusCode int
 		result.StatusCode(&statusCode)
 		if statusCode == 0 {
-			statusCode = http.StatusBadGateway
-		}
-
-		// Build a more informative error message
-		errMsg := err.Error()
-		if errMsg == "" && len(rawBody) > 0 {
-			errMsg = string(rawBody)
+			if code, body, ok := unstructuredResponse(err); ok {
+				statusCode, rawBody = code, body
+			}
 		}
-		if errMsg == "" {
-			errMsg = fmt.Sprintf("upstream returned status %d", statusCode)
+		upstreamErr := c.classifyError(err, statusCode, rawBody)
+		observer.done(statusCode, upstreamErr.Type, len(rawBody))
+		if statusCode == 0 {
+			statusCode = http.StatusBadGateway
 		}
 
-		log.Error().
+		log.Ctx(ctx).Error().
 			Err(err).
 			Int("status_code", statusCode).
+			Str("error_type", string(upstreamErr.Type)).
 			Str("response_body", string(rawBody)).
 			Msg("proxy request failed")
 
@@ -149,7 +336,7 @@ func (c *Client) ProxyRequest(ctx context.Context, req *Request) (*Response, err
 			StatusCode: statusCode,
 			Body:       rawBody,
 			Headers:    make(http.Header),
-		}, fmt.Errorf("%s", errMsg)
+		}, upstreamErr
 	}
 
 	// Get status code
@@ -158,6 +345,7 @@ func (c *Client) ProxyRequest(ctx context.Context, req *Request) (*Response, err
 	if statusCode == 0 {
 		statusCode = http.StatusOK
 	}
+	observer.done(statusCode, "", len(rawBody))
 
 	return &Response{
 		StatusCode: statusCode,
@@ -222,11 +410,31 @@ func (c *Client) ProxyHTTP(ctx context.Context, w http.ResponseWriter, r *http.R
 
 	// Execute proxy request
 	resp, err := c.ProxyRequest(ctx, req)
-	if err != nil {
-		log.Error().Err(err).Msg("proxy request failed")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadGateway)
-		fmt.Fprintf(w, `{"error": "proxy request failed: %s"}`, err.Error())
+	var rejected *queue.RejectedError
+	if errors.As(err, &rejected) {
+		w.Header().Set("Retry-After", strconv.Itoa(rejected.RetryAfterSeconds()))
+		middleware.WriteError(ctx, w, http.StatusTooManyRequests, rejected.Error())
+		return
+	}
+	if errors.Is(err, breaker.ErrOpen) {
+		middleware.WriteError(ctx, w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	var upstreamErr *UpstreamError
+	switch {
+	case errors.As(err, &upstreamErr) && upstreamErr.Type == ErrorTypeUpstream:
+		// The backend answered; pass its error response through untouched
+	case errors.As(err, &upstreamErr):
+		writeUpstreamError(ctx, w, upstreamErr)
+		return
+	case err != nil:
+		log.Ctx(ctx).Error().Err(err).Msg("proxy request failed")
+		writeUpstreamError(ctx, w, &UpstreamError{
+			Type:       ErrorTypeInternal,
+			StatusCode: http.StatusBadGateway,
+			Message:    fmt.Sprintf("proxy request failed: %s", err.Error()),
+			Err:        err,
+		})
 		return
 	}
 
@@ -249,6 +457,14 @@ func (c *Client) ProxyHTTP(ctx context.Context, w http.ResponseWriter, r *http.R
 	}
 }
 
+// fullPath returns the path of the request on the backend service.
+func (c *Client) fullPath(req *Request) string {
+	if req.noPathPrefix {
+		return req.Path
+	}
+	return c.pathPrefix + req.Path
+}
+
 func (c *Client) buildProxyPath(path string) string {
 	return fmt.Sprintf("/api/v1/namespaces/%s/services/%s:%d/proxy%s",
 		c.namespace, c.service, c.port, path)
@@ -261,6 +477,10 @@ type Request struct {
 	Query   url.Values
 	Headers http.Header
 	Body    io.Reader
+
+	// noPathPrefix sends the request to Path as is, for endpoints outside
+	// the API such as readiness checks and admin endpoints.
+	noPathPrefix bool
 }
 
 // Response represents a response from the proxied service.
@@ -1,14 +1,23 @@
 package proxy
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/tjorri/observability-federation-proxy/internal/breaker"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+	"github.com/tjorri/observability-federation-proxy/internal/queue"
 )
 
 func TestNewClient(t *testing.T) {
@@ -315,3 +324,221 @@ func TestClient_ProxyHTTP_Integration(t *testing.T) {
 	// Real integration tests require a running K8s cluster.
 	t.Skip("fake k8s client doesn't support service proxy - requires real cluster for integration tests")
 }
+
+func TestClient_ProxyHTTP_QueueRejected(t *testing.T) {
+	limiter, err := queue.NewLimiter(queue.Config{MaxConcurrent: 1, QueueTimeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create limiter: %v", err)
+	}
+	client, err := NewClient(ClientConfig{
+		K8sClient: fake.NewSimpleClientset(),
+		Namespace: "observability",
+		Service:   "loki-gateway",
+		Port:      80,
+		Limiter:   limiter,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// Hold the only slot so the request times out in the queue
+	release, _ := limiter.Acquire(context.Background(), "other")
+	defer release()
+
+	req := httptest.NewRequest(http.MethodGet, "/clusters/prod/loki/api/v1/query?query=up", nil)
+	w := httptest.NewRecorder()
+	client.ProxyHTTP(context.Background(), w, req, "/clusters/prod/loki", nil)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+}
+
+func TestClient_ProxyHTTP_BreakerOpen(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	restClient, err := NewRESTClient(&rest.Config{Host: server.URL}, RESTClientConfig{Cluster: "prod"})
+	if err != nil {
+		t.Fatalf("failed to create REST client: %v", err)
+	}
+	b := breaker.New(breaker.Config{Cluster: "prod", Backend: "loki", ConsecutiveFailures: 2})
+	client, err := NewClient(ClientConfig{
+		K8sClient:  fake.NewSimpleClientset(),
+		RESTClient: restClient,
+		Namespace:  "observability",
+		Service:    "loki-gateway",
+		Port:       80,
+		Breaker:    b,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	proxy := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/clusters/prod/loki/api/v1/query?query=up", nil)
+		w := httptest.NewRecorder()
+		client.ProxyHTTP(context.Background(), w, req, "/clusters/prod/loki", nil)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := proxy(); w.Code != http.StatusBadGateway {
+			t.Fatalf("expected status 502, got %d", w.Code)
+		}
+	}
+	if b.State() != breaker.Open {
+		t.Fatalf("expected breaker to open, got %s", b.State())
+	}
+
+	// While open, requests fail fast without reaching the backend
+	if w := proxy(); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", w.Code)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", got)
+	}
+}
+
+func TestClient_ProxyHTTP_RequestID(t *testing.T) {
+	var upstreamID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamID = r.Header.Get(middleware.RequestIDHeader)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"ServiceUnavailable","message":"no endpoints available","code":503}`))
+	}))
+	defer server.Close()
+
+	restClient, err := NewRESTClient(&rest.Config{Host: server.URL}, RESTClientConfig{Cluster: "prod"})
+	if err != nil {
+		t.Fatalf("failed to create REST client: %v", err)
+	}
+	client, err := NewClient(ClientConfig{
+		K8sClient:  fake.NewSimpleClientset(),
+		RESTClient: restClient,
+		Cluster:    "prod",
+		Namespace:  "observability",
+		Service:    "loki-gateway",
+		Port:       80,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	ctx := middleware.WithRequestID(context.Background(), "req-123")
+	req := httptest.NewRequest(http.MethodGet, "/clusters/prod/loki/api/v1/query?query=up", nil)
+	w := httptest.NewRecorder()
+	client.ProxyHTTP(ctx, w, req, "/clusters/prod/loki", nil)
+
+	if upstreamID != "req-123" {
+		t.Errorf("expected request ID to be forwarded upstream, got %q", upstreamID)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if body["requestId"] != "req-123" {
+		t.Errorf("expected request ID in error response, got %v", body)
+	}
+}
+
+func TestClient_Ready(t *testing.T) {
+	var path string
+	ready := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Ingester not ready"))
+			return
+		}
+		w.Write([]byte("ready"))
+	}))
+	defer server.Close()
+
+	restClient, err := NewRESTClient(&rest.Config{Host: server.URL}, RESTClientConfig{Cluster: "prod"})
+	if err != nil {
+		t.Fatalf("failed to create REST client: %v", err)
+	}
+	client, err := NewClient(ClientConfig{
+		K8sClient:  fake.NewSimpleClientset(),
+		RESTClient: restClient,
+		Cluster:    "prod",
+		Backend:    "mimir",
+		Namespace:  "observability",
+		Service:    "mimir-gateway",
+		Port:       80,
+		PathPrefix: "/prometheus",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	if err := client.Ready(context.Background(), "/ready"); err != nil {
+		t.Errorf("expected backend to be ready, got %v", err)
+	}
+	if want := "/api/v1/namespaces/observability/services/mimir-gateway:80/proxy/ready"; path != want {
+		t.Errorf("expected path %s, got %s", want, path)
+	}
+
+	ready = false
+	if err := client.Ready(context.Background(), "/ready"); err == nil || !strings.Contains(err.Error(), "Ingester not ready") {
+		t.Errorf("expected readiness error from backend, got %v", err)
+	}
+}
+
+func TestClient_ProxyAdminRequest(t *testing.T) {
+	var path, accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		accept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"userID":"payments"}]`))
+	}))
+	defer server.Close()
+
+	restClient, err := NewRESTClient(&rest.Config{Host: server.URL}, RESTClientConfig{Cluster: "prod"})
+	if err != nil {
+		t.Fatalf("failed to create REST client: %v", err)
+	}
+	client, err := NewClient(ClientConfig{
+		K8sClient:  fake.NewSimpleClientset(),
+		RESTClient: restClient,
+		Cluster:    "prod",
+		Backend:    "mimir",
+		Namespace:  "observability",
+		Service:    "mimir-gateway",
+		Port:       80,
+		PathPrefix: "/prometheus",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	resp, err := client.ProxyAdminRequest(context.Background(), &Request{
+		Method:  http.MethodGet,
+		Path:    "/distributor/all_user_stats",
+		Headers: http.Header{"Accept": {"application/json"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != `[{"userID":"payments"}]` {
+		t.Errorf("unexpected response: %d %s", resp.StatusCode, resp.Body)
+	}
+	if want := "/api/v1/namespaces/observability/services/mimir-gateway:80/proxy/distributor/all_user_stats"; path != want {
+		t.Errorf("expected path %s, got %s", want, path)
+	}
+	if accept != "application/json" {
+		t.Errorf("expected Accept header to be forwarded, got %q", accept)
+	}
+}
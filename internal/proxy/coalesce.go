@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// coalescer shares one upstream call between identical concurrent requests.
+// Unlike a plain singleflight, a waiter whose context is cancelled leaves
+// without affecting the others. The upstream call is only cancelled once
+// every waiter has left.
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	resp    *Response
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{calls: make(map[string]*flight)}
+}
+
+// do calls fn once for all concurrent callers with the same key. The context
+// passed to fn carries the values of the first caller's context but is only
+// cancelled when all callers have left. The returned response is shared and
+// must not be modified. shared reports whether the caller joined an existing
+// call.
+func (g *coalescer) do(ctx context.Context, key string, fn func(ctx context.Context) (*Response, error)) (resp *Response, shared bool, err error) {
+	g.mu.Lock()
+	if f, ok := g.calls[key]; ok {
+		f.waiters++
+		g.mu.Unlock()
+		resp, err = g.wait(ctx, key, f)
+		return resp, true, err
+	}
+
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	f := &flight{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	g.calls[key] = f
+	g.mu.Unlock()
+
+	go func() {
+		f.resp, f.err = fn(callCtx)
+		cancel()
+
+		g.mu.Lock()
+		if g.calls[key] == f {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		close(f.done)
+	}()
+
+	resp, err = g.wait(ctx, key, f)
+	return resp, false, err
+}
+
+func (g *coalescer) wait(ctx context.Context, key string, f *flight) (*Response, error) {
+	select {
+	case <-f.done:
+		return f.resp, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			// Don't let new callers join a cancelled call
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// coalesceKey identifies requests that can share an upstream call. It
+// returns false for requests that must not be coalesced: requests with a body
+// that cannot be compared, and streaming tail requests.
+func (c *Client) coalesceKey(req *Request) (string, bool) {
+	if req.Body != nil || strings.HasSuffix(req.Path, "/tail") {
+		return "", false
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		return "", false
+	}
+
+	h := sha256.New()
+	for _, part := range []string{
+		c.cluster,
+		c.backend,
+		req.Method,
+		req.Path,
+		req.Query.Encode(),
+		req.Headers.Get("X-Scope-OrgID"),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
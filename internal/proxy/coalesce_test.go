@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescer_SharesCall(t *testing.T) {
+	g := newCoalescer()
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	fn := func(context.Context) (*Response, error) {
+		calls.Add(1)
+		<-release
+		return &Response{StatusCode: http.StatusOK, Body: []byte("ok")}, nil
+	}
+
+	const waiters = 10
+	var wg sync.WaitGroup
+	var shared atomic.Int32
+	results := make(chan *Response, waiters)
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, s, err := g.do(context.Background(), "k", fn)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if s {
+				shared.Add(1)
+			}
+			results <- resp
+		}()
+	}
+
+	// Wait for every caller to join before releasing the upstream call
+	waitForWaiters(t, g, "k", waiters)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 upstream call, got %d", calls.Load())
+	}
+	if shared.Load() != waiters-1 {
+		t.Errorf("expected %d shared callers, got %d", waiters-1, shared.Load())
+	}
+	for resp := range results {
+		if string(resp.Body) != "ok" {
+			t.Errorf("unexpected response body: %s", resp.Body)
+		}
+	}
+
+	// Completed calls are not reused
+	go func() { g.do(context.Background(), "k", fn) }()
+	waitFor(t, func() bool { return calls.Load() == 2 })
+}
+
+func TestCoalescer_CancelledWaiter(t *testing.T) {
+	g := newCoalescer()
+	release := make(chan struct{})
+	started := make(chan context.Context, 1)
+
+	fn := func(ctx context.Context) (*Response, error) {
+		started <- ctx
+		select {
+		case <-release:
+			return &Response{StatusCode: http.StatusOK}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// The first caller starts the call, then goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() {
+		_, _, err := g.do(ctx, "k", fn)
+		firstDone <- err
+	}()
+	upstreamCtx := <-started
+
+	secondDone := make(chan *Response, 1)
+	go func() {
+		resp, _, _ := g.do(context.Background(), "k", fn)
+		secondDone <- resp
+	}()
+	waitForWaiters(t, g, "k", 2)
+
+	cancel()
+	if err := <-firstDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled caller to return context.Canceled, got %v", err)
+	}
+	if upstreamCtx.Err() != nil {
+		t.Fatal("expected upstream call to continue for the remaining waiter")
+	}
+
+	close(release)
+	if resp := <-secondDone; resp == nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("expected remaining waiter to get the response, got %+v", resp)
+	}
+}
+
+func TestCoalescer_AllWaitersCancelled(t *testing.T) {
+	g := newCoalescer()
+	started := make(chan context.Context, 1)
+
+	fn := func(ctx context.Context) (*Response, error) {
+		started <- ctx
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go g.do(ctx, "k", fn)
+
+	upstreamCtx := <-started
+	cancel()
+
+	select {
+	case <-upstreamCtx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected upstream call to be cancelled once every waiter left")
+	}
+}
+
+func TestClient_CoalesceKey(t *testing.T) {
+	c := &Client{cluster: "prod", backend: "mimir"}
+	headers := orgIDHeader("team-a")
+	base, ok := c.coalesceKey(&Request{
+		Method:  http.MethodGet,
+		Path:    "/api/v1/query",
+		Query:   url.Values{"query": {"up"}, "time": {"1700000000"}},
+		Headers: headers,
+	})
+	if !ok {
+		t.Fatal("expected GET query to be coalescible")
+	}
+
+	tests := []struct {
+		name     string
+		client   *Client
+		req      *Request
+		wantOK   bool
+		wantSame bool
+	}{
+		{
+			name:   "parameter order is ignored",
+			client: c,
+			req: &Request{
+				Method:  http.MethodGet,
+				Path:    "/api/v1/query",
+				Query:   url.Values{"time": {"1700000000"}, "query": {"up"}},
+				Headers: http.Header{"X-Scope-Orgid": {"team-a"}, "User-Agent": {"grafana"}},
+			},
+			wantOK:   true,
+			wantSame: true,
+		},
+		{
+			name:   "different tenant header",
+			client: c,
+			req: &Request{
+				Method:  http.MethodGet,
+				Path:    "/api/v1/query",
+				Query:   url.Values{"query": {"up"}, "time": {"1700000000"}},
+				Headers: orgIDHeader("team-b"),
+			},
+			wantOK: true,
+		},
+		{
+			name:   "different cluster",
+			client: &Client{cluster: "staging", backend: "mimir"},
+			req: &Request{
+				Method:  http.MethodGet,
+				Path:    "/api/v1/query",
+				Query:   url.Values{"query": {"up"}, "time": {"1700000000"}},
+				Headers: headers,
+			},
+			wantOK: true,
+		},
+		{
+			name:   "request body",
+			client: c,
+			req: &Request{
+				Method:  http.MethodPost,
+				Path:    "/api/v1/read",
+				Headers: headers,
+				Body:    strings.NewReader("data"),
+			},
+		},
+		{
+			name:   "tail",
+			client: c,
+			req: &Request{
+				Method:  http.MethodGet,
+				Path:    "/loki/api/v1/tail",
+				Query:   url.Values{"query": {`{job="api"}`}},
+				Headers: headers,
+			},
+		},
+		{
+			name:   "delete",
+			client: c,
+			req: &Request{
+				Method:  http.MethodDelete,
+				Path:    "/api/v1/query",
+				Headers: headers,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := tt.client.coalesceKey(tt.req)
+			if ok != tt.wantOK {
+				t.Fatalf("expected coalescible = %v, got %v", tt.wantOK, ok)
+			}
+			if ok && (key == base) != tt.wantSame {
+				t.Errorf("expected same key = %v", tt.wantSame)
+			}
+		})
+	}
+}
+
+func orgIDHeader(orgID string) http.Header {
+	headers := make(http.Header)
+	headers.Set("X-Scope-OrgID", orgID)
+	return headers
+}
+
+func waitForWaiters(t *testing.T, g *coalescer, key string, n int) {
+	t.Helper()
+	waitFor(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		f, ok := g.calls[key]
+		return ok && f.waiters == n
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tjorri/observability-federation-proxy/internal/cluster"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+// ErrorType classifies why a proxied request failed.
+type ErrorType string
+
+const (
+	// ErrorTypeUpstream is an error response of the backend itself, which is
+	// passed through untouched.
+	ErrorTypeUpstream ErrorType = "upstream"
+	// ErrorTypeUnauthorized means the API server rejected the proxy's
+	// credentials, or none could be obtained, such as an expired EKS token.
+	ErrorTypeUnauthorized ErrorType = "unauthorized"
+	// ErrorTypeForbidden means RBAC doesn't allow the proxy to use
+	// services/proxy for the service.
+	ErrorTypeForbidden ErrorType = "forbidden"
+	// ErrorTypeServiceNotFound means the configured service doesn't exist.
+	ErrorTypeServiceNotFound ErrorType = "service_not_found"
+	// ErrorTypeUnavailable means the API server could not reach the service,
+	// for example because it has no ready endpoints.
+	ErrorTypeUnavailable ErrorType = "unavailable"
+	// ErrorTypeThrottled means the API server rejected the request because
+	// it is overloaded.
+	ErrorTypeThrottled ErrorType = "throttled"
+	// ErrorTypeTimeout means the request timed out.
+	ErrorTypeTimeout ErrorType = "timeout"
+	// ErrorTypeCanceled means the caller cancelled the request.
+	ErrorTypeCanceled ErrorType = "canceled"
+	// ErrorTypeUnreachable means the API server could not be reached.
+	ErrorTypeUnreachable ErrorType = "unreachable"
+	// ErrorTypeInternal is any other failure of the API server or the proxy.
+	ErrorTypeInternal ErrorType = "internal"
+)
+
+// statusClientClosedRequest is the non-standard status for requests the
+// client gave up on, as used by nginx, Loki and Mimir.
+const statusClientClosedRequest = 499
+
+// UpstreamError is a failed proxied request, classified by where and why it
+// failed.
+type UpstreamError struct {
+	Type ErrorType
+	// StatusCode is the status to answer the caller with. For upstream
+	// errors, it is the status of the backend response.
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	return e.Message
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// classifyError classifies a failed request from the error and response of
+// client-go. Responses of the API server itself are metav1.Status objects;
+// any other response comes from the backend.
+func (c *Client) classifyError(err error, statusCode int, body []byte) *UpstreamError {
+	e := &UpstreamError{Err: err, StatusCode: http.StatusBadGateway}
+
+	if statusCode == 0 {
+		switch {
+		case errors.Is(err, context.Canceled):
+			e.Type, e.StatusCode = ErrorTypeCanceled, statusClientClosedRequest
+			e.Message = "request cancelled"
+		case errors.Is(err, context.DeadlineExceeded):
+			e.Type, e.StatusCode = ErrorTypeTimeout, http.StatusGatewayTimeout
+			e.Message = fmt.Sprintf("request to cluster %s timed out", c.cluster)
+		case errors.Is(err, cluster.ErrCredentials):
+			e.Type = ErrorTypeUnauthorized
+			e.Message = fmt.Sprintf("no credentials for cluster %s: %v", c.cluster, err)
+		default:
+			e.Type = ErrorTypeUnreachable
+			e.Message = fmt.Sprintf("kubernetes API server of cluster %s unreachable: %v", c.cluster, err)
+		}
+		return e
+	}
+
+	var status metav1.Status
+	if json.Unmarshal(body, &status) != nil || status.Kind != "Status" || status.Status != metav1.StatusFailure {
+		e.Type, e.StatusCode = ErrorTypeUpstream, statusCode
+		e.Message = string(body)
+		if e.Message == "" {
+			e.Message = fmt.Sprintf("upstream returned status %d", statusCode)
+		}
+		return e
+	}
+
+	service := fmt.Sprintf("%s/%s", c.namespace, c.service)
+	switch status.Reason {
+	case metav1.StatusReasonUnauthorized:
+		e.Type = ErrorTypeUnauthorized
+		e.Message = fmt.Sprintf("kubernetes API server of cluster %s rejected the proxy's credentials: %s", c.cluster, status.Message)
+	case metav1.StatusReasonForbidden:
+		e.Type = ErrorTypeForbidden
+		e.Message = fmt.Sprintf("proxy is not allowed to access service %s in cluster %s: %s", service, c.cluster, status.Message)
+	case metav1.StatusReasonNotFound:
+		e.Type = ErrorTypeServiceNotFound
+		e.Message = fmt.Sprintf("service %s not found in cluster %s: %s", service, c.cluster, status.Message)
+	case metav1.StatusReasonServiceUnavailable:
+		e.Type, e.StatusCode = ErrorTypeUnavailable, http.StatusServiceUnavailable
+		e.Message = fmt.Sprintf("service %s in cluster %s unavailable: %s", service, c.cluster, status.Message)
+	case metav1.StatusReasonTooManyRequests:
+		e.Type, e.StatusCode = ErrorTypeThrottled, http.StatusTooManyRequests
+		e.Message = fmt.Sprintf("kubernetes API server of cluster %s is throttling requests: %s", c.cluster, status.Message)
+	case metav1.StatusReasonTimeout, metav1.StatusReasonServerTimeout:
+		e.Type, e.StatusCode = ErrorTypeTimeout, http.StatusGatewayTimeout
+		e.Message = fmt.Sprintf("request to service %s in cluster %s timed out: %s", service, c.cluster, status.Message)
+	default:
+		e.Type = ErrorTypeInternal
+		e.Message = fmt.Sprintf("kubernetes API server of cluster %s failed: %s", c.cluster, status.Message)
+	}
+	return e
+}
+
+// unstructuredResponse recovers the status code and body of an error
+// response whose content type client-go cannot decode, such as a plain text
+// error of the backend. client-go turns these into an error without a
+// status code. The body is only kept for text responses.
+func unstructuredResponse(err error) (int, []byte, bool) {
+	var statusErr *apierrors.StatusError
+	if !errors.As(err, &statusErr) || statusErr.ErrStatus.Details == nil {
+		return 0, nil, false
+	}
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		if cause.Type != metav1.CauseTypeUnexpectedServerResponse {
+			continue
+		}
+		var body []byte
+		if cause.Message != "unknown" {
+			body = []byte(cause.Message)
+		}
+		return int(statusErr.ErrStatus.Code), body, true
+	}
+	return 0, nil, false
+}
+
+// writeUpstreamError writes err in the error format of the Prometheus and
+// Loki APIs, which Grafana displays as a query error, along with the request
+// ID of ctx.
+func writeUpstreamError(ctx context.Context, w http.ResponseWriter, err *UpstreamError) {
+	body := map[string]string{
+		"status":    "error",
+		"errorType": string(err.Type),
+		"error":     err.Message,
+	}
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		body["requestId"] = id
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.StatusCode)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/tjorri/observability-federation-proxy/internal/cluster"
+)
+
+// statusBody returns a metav1.Status failure as sent by the API server.
+func statusBody(reason string, code int) string {
+	return fmt.Sprintf(`{"kind":"Status","apiVersion":"v1","metadata":{},"status":"Failure","message":"details","reason":"%s","code":%d}`, reason, code)
+}
+
+func TestClassifyError(t *testing.T) {
+	client := &Client{cluster: "prod", namespace: "observability", service: "loki-gateway"}
+
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		body       string
+		wantType   ErrorType
+		wantStatus int
+	}{
+		{"expired token", errors.New("Unauthorized"), 401, statusBody("Unauthorized", 401), ErrorTypeUnauthorized, http.StatusBadGateway},
+		{"RBAC", errors.New("forbidden"), 403, statusBody("Forbidden", 403), ErrorTypeForbidden, http.StatusBadGateway},
+		{"missing service", errors.New("not found"), 404, statusBody("NotFound", 404), ErrorTypeServiceNotFound, http.StatusBadGateway},
+		{"no endpoints", errors.New("unavailable"), 503, statusBody("ServiceUnavailable", 503), ErrorTypeUnavailable, http.StatusServiceUnavailable},
+		{"API server throttling", errors.New("throttled"), 429, statusBody("TooManyRequests", 429), ErrorTypeThrottled, http.StatusTooManyRequests},
+		{"API server timeout", errors.New("timeout"), 504, statusBody("Timeout", 504), ErrorTypeTimeout, http.StatusGatewayTimeout},
+		{"other API server failure", errors.New("internal"), 500, statusBody("InternalError", 500), ErrorTypeInternal, http.StatusBadGateway},
+		{"backend error", errors.New("bad query"), 422, `{"status":"error","errorType":"bad_data","error":"parse error"}`, ErrorTypeUpstream, 422},
+		{"backend error without body", errors.New("bad gateway"), 502, "", ErrorTypeUpstream, 502},
+		{"connection refused", errors.New("dial tcp: connection refused"), 0, "", ErrorTypeUnreachable, http.StatusBadGateway},
+		{"deadline", fmt.Errorf("get: %w", context.DeadlineExceeded), 0, "", ErrorTypeTimeout, http.StatusGatewayTimeout},
+		{"cancelled", fmt.Errorf("get: %w", context.Canceled), 0, "", ErrorTypeCanceled, statusClientClosedRequest},
+		{"no credentials", fmt.Errorf("%w: sts failed", cluster.ErrCredentials), 0, "", ErrorTypeUnauthorized, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := client.classifyError(tt.err, tt.statusCode, []byte(tt.body))
+			if got.Type != tt.wantType {
+				t.Errorf("expected type %s, got %s", tt.wantType, got.Type)
+			}
+			if got.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, got.StatusCode)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("expected error to wrap %v", tt.err)
+			}
+		})
+	}
+}
+
+func TestClient_ProxyHTTP_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		contentType   string
+		body          string
+		wantStatus    int
+		wantErrorType string
+		wantBody      string
+	}{
+		{
+			name:          "API server error is classified",
+			status:        http.StatusForbidden,
+			body:          statusBody("Forbidden", 403),
+			wantStatus:    http.StatusBadGateway,
+			wantErrorType: "forbidden",
+		},
+		{
+			name:       "backend error passes through",
+			status:     http.StatusUnprocessableEntity,
+			body:       `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+		},
+		{
+			name:        "plain text backend error passes through",
+			status:      http.StatusServiceUnavailable,
+			contentType: "text/plain; charset=utf-8",
+			body:        "Ingester not ready",
+			wantStatus:  http.StatusServiceUnavailable,
+			wantBody:    "Ingester not ready",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType := tt.contentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				w.Header().Set("Content-Type", contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			restClient, err := NewRESTClient(&rest.Config{Host: server.URL}, RESTClientConfig{Cluster: "prod"})
+			if err != nil {
+				t.Fatalf("failed to create REST client: %v", err)
+			}
+			client, err := NewClient(ClientConfig{
+				K8sClient:  fake.NewSimpleClientset(),
+				RESTClient: restClient,
+				Cluster:    "prod",
+				Namespace:  "observability",
+				Service:    "mimir-gateway",
+				Port:       80,
+			})
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/clusters/prod/mimir/api/v1/query?query=up", nil)
+			w := httptest.NewRecorder()
+			client.ProxyHTTP(context.Background(), w, req, "/clusters/prod/mimir", nil)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d; body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("expected body to pass through untouched, got %s", w.Body.String())
+			}
+			if tt.wantErrorType != "" {
+				var resp map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("failed to unmarshal response: %v", err)
+				}
+				if resp["status"] != "error" || resp["errorType"] != tt.wantErrorType || resp["error"] == "" {
+					t.Errorf("unexpected error response: %v", resp)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+var tracer = otel.Tracer("github.com/tjorri/observability-federation-proxy/internal/proxy")
+
+// endpointClasses maps the last path segments of API endpoints to the
+// endpoint label of upstream request metrics. Paths are matched on their
+// suffix, so Loki's /loki/api/v1/query and Mimir's /api/v1/query share a
+// class.
+var endpointClasses = []struct {
+	suffix string
+	class  string
+}{
+	{"/query_range", "query_range"},
+	{"/query_exemplars", "query_exemplars"},
+	{"/query", "query"},
+	{"/labels", "labels"},
+	{"/values", "label_values"},
+	{"/series", "series"},
+	{"/metadata", "metadata"},
+	{"/index/stats", "index_stats"},
+	{"/index/volume", "index_volume"},
+	{"/index/volume_range", "index_volume"},
+	{"/detected_labels", "detected_labels"},
+	{"/detected_fields", "detected_fields"},
+	{"/patterns", "patterns"},
+	{"/format_query", "format_query"},
+	{"/tail", "tail"},
+	{"/read", "remote_read"},
+	{"/ready", "ready"},
+	{"/all_user_stats", "user_stats"},
+}
+
+// endpointClass returns the endpoint label of a request path. Paths of
+// other endpoints are counted as "other", to keep the label bounded.
+func endpointClass(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	for _, e := range endpointClasses {
+		if strings.HasSuffix(path, e.suffix) {
+			return e.class
+		}
+	}
+	return "other"
+}
+
+// startSpan starts a span of the client, labelled with its cluster and
+// backend.
+func (c *Client) startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts, trace.WithAttributes(
+		attribute.String("cluster", c.cluster),
+		attribute.String("backend", c.backend),
+	))
+	return tracer.Start(ctx, name, opts...)
+}
+
+// endSpan ends a span, marking it failed if err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceHeaders returns the headers carrying the trace context of ctx to the
+// backend, so that its spans join the trace.
+func traceHeaders(ctx context.Context) http.Header {
+	headers := make(http.Header)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(headers))
+	return headers
+}
+
+// upstreamObserver records the metrics and span of one upstream request.
+type upstreamObserver struct {
+	cluster  string
+	backend  string
+	endpoint string
+	start    time.Time
+	span     trace.Span
+
+	mu        sync.Mutex
+	firstByte time.Time
+}
+
+// observeUpstream starts observing an upstream request. The returned
+// context carries the span of the request and reports when the first
+// response byte arrives.
+func (c *Client) observeUpstream(ctx context.Context, req *Request) (context.Context, *upstreamObserver) {
+	o := &upstreamObserver{
+		cluster:  c.cluster,
+		backend:  c.backend,
+		endpoint: endpointClass(req.Path),
+		start:    time.Now(),
+	}
+	ctx, o.span = c.startSpan(ctx, "upstream "+o.endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("endpoint", o.endpoint),
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLPath(c.fullPath(req)),
+			attribute.String("k8s.namespace.name", c.namespace),
+			attribute.String("k8s.service.name", c.service),
+		),
+	)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			o.firstByte = time.Now()
+		},
+	})
+	return ctx, o
+}
+
+// done records the outcome of the request and ends its span. statusCode is
+// 0 if no response was received, and errorType is empty for successful
+// requests.
+func (o *upstreamObserver) done(statusCode int, errorType ErrorType, bodySize int) {
+	status := "none"
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	metrics.ProxyRequestsTotal.WithLabelValues(o.cluster, o.backend, o.endpoint, status, string(errorType)).Inc()
+	metrics.ProxyRequestDuration.WithLabelValues(o.cluster, o.backend, o.endpoint).Observe(time.Since(o.start).Seconds())
+
+	o.mu.Lock()
+	firstByte := o.firstByte
+	o.mu.Unlock()
+	if !firstByte.IsZero() {
+		metrics.ProxyTimeToFirstByte.WithLabelValues(o.cluster, o.backend, o.endpoint).Observe(firstByte.Sub(o.start).Seconds())
+		o.span.AddEvent("first byte", trace.WithTimestamp(firstByte))
+	}
+	if statusCode != 0 {
+		metrics.ProxyResponseBytes.WithLabelValues(o.cluster, o.backend, o.endpoint).Observe(float64(bodySize))
+		o.span.SetAttributes(semconv.HTTPResponseStatusCode(statusCode), semconv.HTTPResponseBodySize(bodySize))
+	}
+	if errorType != "" {
+		o.span.SetAttributes(semconv.ErrorTypeKey.String(string(errorType)))
+		o.span.SetStatus(codes.Error, string(errorType))
+	}
+	o.span.End()
+}
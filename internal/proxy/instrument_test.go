@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+func TestEndpointClass(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/loki/api/v1/query_range", "query_range"},
+		{"/api/v1/query", "query"},
+		{"/api/v1/query_exemplars", "query_exemplars"},
+		{"/loki/api/v1/label/app/values", "label_values"},
+		{"/api/v1/labels", "labels"},
+		{"/loki/api/v1/index/stats", "index_stats"},
+		{"/api/v1/read", "remote_read"},
+		{"/api/v1/status/buildinfo", "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := endpointClass(tt.path); got != tt.want {
+				t.Errorf("endpointClass(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_UpstreamMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("query") == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	restClient, err := NewRESTClient(&rest.Config{Host: server.URL}, RESTClientConfig{Cluster: "metrics-test"})
+	if err != nil {
+		t.Fatalf("failed to create REST client: %v", err)
+	}
+	client, err := NewClient(ClientConfig{
+		K8sClient:  fake.NewSimpleClientset(),
+		RESTClient: restClient,
+		Cluster:    "metrics-test",
+		Backend:    "mimir",
+		Namespace:  "observability",
+		Service:    "mimir-gateway",
+		Port:       80,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	for _, query := range []string{"up", "up", "bad"} {
+		client.ProxyRequest(context.Background(), &Request{
+			Method: http.MethodGet,
+			Path:   "/api/v1/query_range",
+			Query:  map[string][]string{"query": {query}},
+		})
+	}
+
+	if got := testutil.ToFloat64(metrics.ProxyRequestsTotal.WithLabelValues("metrics-test", "mimir", "query_range", "200", "")); got != 2 {
+		t.Errorf("expected 2 successful requests, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.ProxyRequestsTotal.WithLabelValues("metrics-test", "mimir", "query_range", "400", "upstream")); got != 1 {
+		t.Errorf("expected 1 failed request, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.ProxyTimeToFirstByte, "proxy_time_to_first_byte_seconds"); got == 0 {
+		t.Error("expected time to first byte to be observed")
+	}
+	if got := testutil.CollectAndCount(metrics.ProxyResponseBytes, "proxy_response_bytes"); got == 0 {
+		t.Error("expected response size to be observed")
+	}
+}
+
+func TestClient_PropagatesTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	restClient, err := NewRESTClient(&rest.Config{Host: server.URL}, RESTClientConfig{Cluster: "prod"})
+	if err != nil {
+		t.Fatalf("failed to create REST client: %v", err)
+	}
+	client, err := NewClient(ClientConfig{
+		K8sClient:  fake.NewSimpleClientset(),
+		RESTClient: restClient,
+		Cluster:    "prod",
+		Backend:    "loki",
+		Namespace:  "observability",
+		Service:    "loki-gateway",
+		Port:       80,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	_, err = client.ProxyRequest(ctx, &Request{
+		Method: http.MethodGet,
+		Path:   "/loki/api/v1/query",
+		Query:  map[string][]string{"query": {`{app="foo"}`}},
+		// The caller's trace context is replaced by the proxy's
+		Headers: http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+	})
+	parent.End()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	var upstream sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == "upstream query" {
+			upstream = span
+		}
+	}
+	if upstream == nil {
+		t.Fatalf("expected an upstream span, got %d spans", len(spans))
+	}
+	if upstream.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Error("expected upstream span to belong to the caller's trace")
+	}
+
+	want := "00-" + upstream.SpanContext().TraceID().String() + "-" + upstream.SpanContext().SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("expected backend to receive traceparent %q, got %q", want, traceparent)
+	}
+}
@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tjorri/observability-federation-proxy/internal/breaker"
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+	"github.com/tjorri/observability-federation-proxy/internal/queue"
+)
+
+// RetryConfig holds configuration for retrying and hedging read requests.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts per request, including the
+	// first. Defaults to 3.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. It doubles with
+	// every retry up to MaxBackoff, and a random share of up to half of it
+	// is taken off. Defaults to 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries. Defaults to 2s.
+	MaxBackoff time.Duration
+	// BudgetRatio is the number of retries and hedged requests earned by
+	// each request. Defaults to 0.1, i.e. at most 10% extra upstream load.
+	BudgetRatio float64
+	// BudgetBurst is the number of retries available before any have been
+	// earned, and the most that can be saved up. Defaults to 10.
+	BudgetBurst int
+	// HedgeAfter sends a duplicate of a request that hasn't been answered
+	// after this long, using whichever response arrives first. Zero
+	// disables hedging.
+	HedgeAfter time.Duration
+}
+
+// retryPolicy retries read requests that failed transiently, and hedges
+// slow ones, within a budget shared by all requests of a client.
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	hedgeAfter     time.Duration
+	budget         *retryBudget
+}
+
+func newRetryPolicy(cfg RetryConfig) *retryPolicy {
+	p := &retryPolicy{
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff,
+		maxBackoff:     cfg.MaxBackoff,
+		hedgeAfter:     cfg.HedgeAfter,
+	}
+	if p.maxAttempts == 0 {
+		p.maxAttempts = 3
+	}
+	if p.initialBackoff == 0 {
+		p.initialBackoff = 100 * time.Millisecond
+	}
+	if p.maxBackoff == 0 {
+		p.maxBackoff = 2 * time.Second
+	}
+
+	ratio := cfg.BudgetRatio
+	if ratio == 0 {
+		ratio = 0.1
+	}
+	burst := cfg.BudgetBurst
+	if burst == 0 {
+		burst = 10
+	}
+	p.budget = &retryBudget{ratio: ratio, burst: float64(burst), tokens: float64(burst)}
+	return p
+}
+
+// backoff returns the jittered wait before the given retry, counting from 1.
+func (p *retryPolicy) backoff(retry int) time.Duration {
+	d := p.initialBackoff
+	for i := 1; i < retry && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.maxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryBudget limits retries and hedged requests to a share of all requests,
+// so that retries cannot multiply the load on a struggling backend.
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	burst  float64
+	tokens float64
+}
+
+// deposit earns a share of a retry for a new request.
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.burst, b.tokens+b.ratio)
+}
+
+// withdraw spends a retry, returning false if none are left.
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// readOnlyPOSTSuffixes are the query endpoints that accept POST for long
+// parameters but don't change anything.
+var readOnlyPOSTSuffixes = []string{
+	"/query",
+	"/query_range",
+	"/query_exemplars",
+	"/labels",
+	"/values",
+	"/series",
+	"/index/stats",
+	"/index/volume",
+	"/index/volume_range",
+	"/format_query",
+}
+
+// retryable reports whether a request may be sent more than once. Requests
+// with a body cannot be replayed, and tail requests are streams.
+func retryable(req *Request) bool {
+	if req.Body != nil || strings.HasSuffix(req.Path, "/tail") {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet:
+		return true
+	case http.MethodPost:
+		for _, suffix := range readOnlyPOSTSuffixes {
+			if strings.HasSuffix(req.Path, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// retryReason returns why a failed attempt may be retried, or "" if it
+// shouldn't be. Transport errors are reported by doRequest as 502, and the
+// API server's service proxy answers 503 and 429 when the service or the
+// API server itself is unavailable or overloaded. Other responses are
+// answers from the backend. Requests rejected by the proxy itself, or
+// cancelled by the caller, are not retried.
+func retryReason(ctx context.Context, resp *Response, err error) string {
+	if err == nil || ctx.Err() != nil || resp == nil {
+		return ""
+	}
+	var rejected *queue.RejectedError
+	if errors.As(err, &rejected) || errors.Is(err, breaker.ErrOpen) {
+		return ""
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return strconv.Itoa(resp.StatusCode)
+	}
+	return ""
+}
+
+// sendWithRetries sends a request, retrying transient failures with backoff
+// as long as the budget and the request deadline allow. All attempts
+// together are bounded by the client timeout.
+func (c *Client) sendWithRetries(ctx context.Context, req *Request) (*Response, error) {
+	if c.retry == nil || !retryable(req) {
+		return c.send(ctx, req)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	p := c.retry
+	p.budget.deposit()
+	for attempt := 1; ; attempt++ {
+		resp, err := c.sendHedged(ctx, req)
+		reason := retryReason(ctx, resp, err)
+		if reason == "" || attempt >= p.maxAttempts {
+			return resp, err
+		}
+
+		backoff := p.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return resp, err
+		}
+		if !p.budget.withdraw() {
+			metrics.RetryBudgetExhaustedTotal.WithLabelValues(c.cluster, c.backend).Inc()
+			return resp, err
+		}
+		metrics.RetriesTotal.WithLabelValues(c.cluster, c.backend, reason).Inc()
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		}
+	}
+}
+
+type attemptResult struct {
+	resp  *Response
+	err   error
+	hedge bool
+}
+
+// sendHedged sends a request and, if hedging is enabled and no answer has
+// arrived after the hedging delay, a duplicate of it. The first answer that
+// is not a transient failure wins and the other request is cancelled.
+func (c *Client) sendHedged(ctx context.Context, req *Request) (*Response, error) {
+	p := c.retry
+	if p.hedgeAfter <= 0 {
+		return c.send(ctx, req)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, 2)
+	launch := func(hedge bool) {
+		go func() {
+			resp, err := c.send(ctx, req)
+			results <- attemptResult{resp: resp, err: err, hedge: hedge}
+		}()
+	}
+	launch(false)
+
+	timer := time.NewTimer(p.hedgeAfter)
+	defer timer.Stop()
+
+	pending, hedged := 1, false
+	for {
+		select {
+		case <-timer.C:
+			if !p.budget.withdraw() {
+				metrics.RetryBudgetExhaustedTotal.WithLabelValues(c.cluster, c.backend).Inc()
+				continue
+			}
+			launch(true)
+			pending++
+			hedged = true
+		case r := <-results:
+			pending--
+			if pending > 0 && retryReason(ctx, r.resp, r.err) != "" {
+				// Wait for the other request instead
+				continue
+			}
+			if hedged {
+				metrics.HedgedRequestsTotal.WithLabelValues(c.cluster, c.backend, strconv.FormatBool(r.hedge)).Inc()
+			}
+			return r.resp, r.err
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+// newRetryTestClient creates a client sending requests to handler through a
+// REST client, as in a real cluster.
+func newRetryTestClient(t *testing.T, handler http.HandlerFunc, retry *RetryConfig, timeout time.Duration) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	restClient, err := NewRESTClient(&rest.Config{Host: server.URL}, RESTClientConfig{Cluster: "prod"})
+	if err != nil {
+		t.Fatalf("failed to create REST client: %v", err)
+	}
+	client, err := NewClient(ClientConfig{
+		K8sClient:  fake.NewSimpleClientset(),
+		RESTClient: restClient,
+		Cluster:    "prod",
+		Backend:    "mimir",
+		Namespace:  "observability",
+		Service:    "mimir-gateway",
+		Port:       80,
+		Timeout:    timeout,
+		Retry:      retry,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return client
+}
+
+// failFirst answers the first n requests with status and later ones with 200.
+func failFirst(n int32, status int, calls *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= n {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"status":"success"}`))
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *Request
+		want bool
+	}{
+		{"GET query", &Request{Method: http.MethodGet, Path: "/api/v1/query"}, true},
+		{"POST query_range", &Request{Method: http.MethodPost, Path: "/api/v1/query_range"}, true},
+		{"POST label values", &Request{Method: http.MethodPost, Path: "/api/v1/label/job/values"}, true},
+		{"POST remote read with body", &Request{Method: http.MethodPost, Path: "/api/v1/read", Body: strings.NewReader("x")}, false},
+		{"POST delete", &Request{Method: http.MethodPost, Path: "/loki/api/v1/delete"}, false},
+		{"GET tail", &Request{Method: http.MethodGet, Path: "/loki/api/v1/tail"}, false},
+		{"DELETE", &Request{Method: http.MethodDelete, Path: "/api/v1/query"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.req); got != tt.want {
+				t.Errorf("retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		failures   int32
+		wantStatus int
+		wantCalls  int32
+	}{
+		{"retries 503", http.StatusServiceUnavailable, 1, http.StatusOK, 2},
+		{"retries 429", http.StatusTooManyRequests, 2, http.StatusOK, 3},
+		{"gives up after max attempts", http.StatusBadGateway, 5, http.StatusBadGateway, 3},
+		{"does not retry 500", http.StatusInternalServerError, 1, http.StatusInternalServerError, 1},
+		{"does not retry 400", http.StatusBadRequest, 1, http.StatusBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client := newRetryTestClient(t, failFirst(tt.failures, tt.status, &calls), &RetryConfig{InitialBackoff: time.Millisecond}, 0)
+
+			resp, _ := client.ProxyRequest(context.Background(), &Request{Method: http.MethodGet, Path: "/api/v1/query"})
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestClient_RetryBudget(t *testing.T) {
+	var calls atomic.Int32
+	client := newRetryTestClient(t, failFirst(100, http.StatusServiceUnavailable, &calls), &RetryConfig{
+		InitialBackoff: time.Millisecond,
+		BudgetRatio:    0.01,
+		BudgetBurst:    2,
+	}, 0)
+
+	// The first request spends the whole budget, the second isn't retried
+	client.ProxyRequest(context.Background(), &Request{Method: http.MethodGet, Path: "/api/v1/query"})
+	client.ProxyRequest(context.Background(), &Request{Method: http.MethodGet, Path: "/api/v1/query"})
+
+	if got := calls.Load(); got != 4 {
+		t.Errorf("expected 4 upstream calls, got %d", got)
+	}
+}
+
+func TestClient_RetryDeadline(t *testing.T) {
+	var calls atomic.Int32
+	client := newRetryTestClient(t, failFirst(1, http.StatusServiceUnavailable, &calls), &RetryConfig{
+		InitialBackoff: time.Second,
+	}, 100*time.Millisecond)
+
+	// The backoff would outlast the client timeout
+	start := time.Now()
+	resp, _ := client.ProxyRequest(context.Background(), &Request{Method: http.MethodGet, Path: "/api/v1/query"})
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", resp.StatusCode)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 upstream call, got %d", got)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected request to fail without waiting, took %s", elapsed)
+	}
+}
+
+func TestClient_Hedge(t *testing.T) {
+	var calls atomic.Int32
+	client := newRetryTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// The first request hangs until it is cancelled
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{"status":"success"}`))
+	}, &RetryConfig{HedgeAfter: 20 * time.Millisecond}, 5*time.Second)
+
+	start := time.Now()
+	resp, err := client.ProxyRequest(context.Background(), &Request{Method: http.MethodGet, Path: "/api/v1/query"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected hedged request to answer quickly, took %s", elapsed)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := newRetryPolicy(RetryConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond})
+
+	for _, tt := range []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 150 * time.Millisecond, 300 * time.Millisecond},
+		{40, 150 * time.Millisecond, 300 * time.Millisecond},
+	} {
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(tt.retry); d < tt.min || d > tt.max {
+				t.Errorf("backoff(%d) = %s, want between %s and %s", tt.retry, d, tt.min, tt.max)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// RESTClientConfig holds the rate limits and connection pool settings of a
+// REST client dedicated to proxied traffic.
+type RESTClientConfig struct {
+	// Cluster is used as the cluster label in metrics.
+	Cluster string
+	// QPS and Burst configure the client-side rate limiter.
+	// Default to 50 and 100.
+	QPS   float32
+	Burst int
+	// MaxIdleConnsPerHost limits the idle connections kept open to the API
+	// server. Defaults to 100.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the total connections to the API server.
+	// Zero means no limit.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long idle connections are kept. Defaults to 90s.
+	IdleConnTimeout time.Duration
+}
+
+// NewRESTClient creates a REST client for proxied traffic. It does not share
+// its rate limiter or connection pool with the cluster's other clients, so
+// queries are not throttled by the tenant watcher or health checks, and vice
+// versa.
+func NewRESTClient(restCfg *rest.Config, cfg RESTClientConfig) (rest.Interface, error) {
+	if restCfg == nil {
+		return nil, fmt.Errorf("rest config is required")
+	}
+	restCfg = rest.CopyConfig(restCfg)
+
+	qps := cfg.QPS
+	if qps == 0 {
+		qps = 50
+	}
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = 100
+	}
+	maxIdleConnsPerHost := cfg.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost == 0 {
+		maxIdleConnsPerHost = 100
+	}
+	idleConnTimeout := cfg.IdleConnTimeout
+	if idleConnTimeout == 0 {
+		idleConnTimeout = 90 * time.Second
+	}
+
+	restCfg.RateLimiter = &observedRateLimiter{
+		RateLimiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+		cluster:     cfg.Cluster,
+	}
+
+	tlsConfig, err := rest.TLSConfigFor(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TLS config: %w", err)
+	}
+
+	dial := (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	if restCfg.Dial != nil {
+		dial = restCfg.Dial
+	}
+
+	transport := utilnet.SetTransportDefaults(&http.Transport{
+		Proxy:               restCfg.Proxy,
+		DialContext:         dial,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+	})
+
+	// Add authentication and any transport wrappers from the config
+	rt, err := rest.HTTPWrappersForConfig(restCfg, transport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build transport: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfigAndClient(restCfg, &http.Client{Transport: rt})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return clientset.CoreV1().RESTClient(), nil
+}
+
+// observedRateLimiter records how long requests wait for the client-side
+// rate limiter.
+type observedRateLimiter struct {
+	flowcontrol.RateLimiter
+	cluster string
+}
+
+func (l *observedRateLimiter) Accept() {
+	start := time.Now()
+	l.RateLimiter.Accept()
+	metrics.ClientThrottleDuration.WithLabelValues(l.cluster).Observe(time.Since(start).Seconds())
+}
+
+func (l *observedRateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := l.RateLimiter.Wait(ctx)
+	metrics.ClientThrottleDuration.WithLabelValues(l.cluster).Observe(time.Since(start).Seconds())
+	return err
+}
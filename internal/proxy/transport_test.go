@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestNewRESTClient(t *testing.T) {
+	var gotPath, gotQuery, gotAuth, gotOrgID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotQuery = r.URL.RawQuery
+		gotAuth = r.Header.Get("Authorization")
+		gotOrgID = r.Header.Get("X-Scope-OrgID")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	defer server.Close()
+
+	restClient, err := NewRESTClient(&rest.Config{Host: server.URL, BearerToken: "secret"}, RESTClientConfig{Cluster: "test"})
+	if err != nil {
+		t.Fatalf("failed to create REST client: %v", err)
+	}
+
+	client, err := NewClient(ClientConfig{
+		K8sClient:  fake.NewSimpleClientset(),
+		RESTClient: restClient,
+		Namespace:  "observability",
+		Service:    "mimir-gateway",
+		Port:       80,
+		PathPrefix: "/prometheus",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/clusters/test/mimir/api/v1/query?query=up", nil)
+	opts := &HTTPOptions{AdditionalHeaders: http.Header{}}
+	opts.AdditionalHeaders.Set("X-Scope-OrgID", "team-a")
+
+	w := httptest.NewRecorder()
+	client.ProxyHTTP(context.Background(), w, req, "/clusters/test/mimir", opts)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d; body: %s", w.Code, w.Body.String())
+	}
+	if gotPath != "/api/v1/namespaces/observability/services/mimir-gateway:80/proxy/prometheus/api/v1/query" {
+		t.Errorf("unexpected upstream path: %s", gotPath)
+	}
+	if params, _ := url.ParseQuery(gotQuery); params.Get("query") != "up" {
+		t.Errorf("unexpected upstream query: %s", gotQuery)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("expected credentials from the REST config, got %q", gotAuth)
+	}
+	if gotOrgID != "team-a" {
+		t.Errorf("expected tenant header team-a, got %q", gotOrgID)
+	}
+}
+
+func TestNewRESTClient_MissingConfig(t *testing.T) {
+	if _, err := NewRESTClient(nil, RESTClientConfig{}); err == nil {
+		t.Error("expected error without a REST config")
+	}
+}
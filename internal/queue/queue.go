@@ -0,0 +1,225 @@
+// Package queue provides concurrency limiting with fair queueing.
+package queue
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// RejectedError is returned when a request cannot be admitted, either
+// because the queue is full or because it waited too long.
+type RejectedError struct {
+	// Reason is "queue_full" or "queue_timeout".
+	Reason string
+	// RetryAfter is a hint for when the caller may try again.
+	RetryAfter time.Duration
+}
+
+func (e *RejectedError) Error() string {
+	switch e.Reason {
+	case "queue_full":
+		return "too many queued requests"
+	default:
+		return "timed out waiting in queue"
+	}
+}
+
+// RetryAfterSeconds returns RetryAfter rounded up to whole seconds, as used
+// in the Retry-After header.
+func (e *RejectedError) RetryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Config holds configuration for creating a limiter.
+type Config struct {
+	// Cluster and Backend are used as labels in metrics.
+	Cluster string
+	Backend string
+	// MaxConcurrent is the number of requests running at once. Required.
+	MaxConcurrent int
+	// MaxQueued is the number of requests waiting for a slot. Further
+	// requests are rejected. Defaults to 100.
+	MaxQueued int
+	// QueueTimeout is how long a request may wait for a slot. Defaults to 10s.
+	QueueTimeout time.Duration
+}
+
+// Limiter limits the number of concurrent requests. Waiting requests are
+// grouped by a fairness key, such as the caller or tenant, and slots are
+// handed to the groups in turn, so one busy caller cannot starve others.
+type Limiter struct {
+	cluster       string
+	backend       string
+	maxConcurrent int
+	maxQueued     int
+	queueTimeout  time.Duration
+
+	mu      sync.Mutex
+	running int
+	queued  int
+	queues  map[string]*list.List
+	// ring holds the keys with waiting requests in round-robin order, and
+	// next is the index of the key served next.
+	ring []string
+	next int
+}
+
+type waiter struct {
+	key   string
+	ready chan struct{}
+	elem  *list.Element
+}
+
+// NewLimiter creates a new limiter.
+func NewLimiter(cfg Config) (*Limiter, error) {
+	if cfg.MaxConcurrent <= 0 {
+		return nil, fmt.Errorf("max concurrent must be positive")
+	}
+
+	maxQueued := cfg.MaxQueued
+	if maxQueued == 0 {
+		maxQueued = 100
+	}
+	queueTimeout := cfg.QueueTimeout
+	if queueTimeout == 0 {
+		queueTimeout = 10 * time.Second
+	}
+
+	return &Limiter{
+		cluster:       cfg.Cluster,
+		backend:       cfg.Backend,
+		maxConcurrent: cfg.MaxConcurrent,
+		maxQueued:     maxQueued,
+		queueTimeout:  queueTimeout,
+		queues:        make(map[string]*list.List),
+	}, nil
+}
+
+// Acquire waits for a slot and returns a function releasing it. It returns a
+// *RejectedError if the queue is full or the queue timeout expires, and the
+// context error if ctx is done first.
+func (l *Limiter) Acquire(ctx context.Context, key string) (release func(), err error) {
+	start := time.Now()
+
+	l.mu.Lock()
+	if l.running < l.maxConcurrent && l.queued == 0 {
+		l.running++
+		l.mu.Unlock()
+		l.observeWait(start)
+		return l.release, nil
+	}
+	if l.queued >= l.maxQueued {
+		l.mu.Unlock()
+		metrics.QueueRejectedTotal.WithLabelValues(l.cluster, l.backend, "queue_full").Inc()
+		return nil, &RejectedError{Reason: "queue_full", RetryAfter: l.queueTimeout}
+	}
+
+	w := &waiter{key: key, ready: make(chan struct{})}
+	q, ok := l.queues[key]
+	if !ok {
+		q = list.New()
+		l.queues[key] = q
+		l.ring = append(l.ring, key)
+	}
+	w.elem = q.PushBack(w)
+	l.queued++
+	l.updateDepth()
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-w.ready:
+		l.observeWait(start)
+		return l.release, nil
+	case <-timer.C:
+		metrics.QueueRejectedTotal.WithLabelValues(l.cluster, l.backend, "queue_timeout").Inc()
+		err = &RejectedError{Reason: "queue_timeout", RetryAfter: l.queueTimeout}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	select {
+	case <-w.ready:
+		// A slot was handed over while giving up; pass it on
+		l.mu.Unlock()
+		l.release()
+	default:
+		l.remove(w)
+		l.updateDepth()
+		l.mu.Unlock()
+	}
+	return nil, err
+}
+
+// Running returns the number of requests holding a slot.
+func (l *Limiter) Running() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running
+}
+
+// Queued returns the number of requests waiting for a slot.
+func (l *Limiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queued
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.running--
+	for l.running < l.maxConcurrent && l.queued > 0 {
+		if l.next >= len(l.ring) {
+			l.next = 0
+		}
+		w := l.queues[l.ring[l.next]].Front().Value.(*waiter)
+		// Move on to the next key, unless removing this one shifts it into place
+		if l.queues[w.key].Len() > 1 {
+			l.next++
+		}
+		l.remove(w)
+		l.running++
+		close(w.ready)
+	}
+	l.updateDepth()
+}
+
+// remove takes a waiter off its queue. The caller must hold l.mu.
+func (l *Limiter) remove(w *waiter) {
+	q := l.queues[w.key]
+	q.Remove(w.elem)
+	l.queued--
+	if q.Len() > 0 {
+		return
+	}
+
+	delete(l.queues, w.key)
+	for i, key := range l.ring {
+		if key == w.key {
+			l.ring = append(l.ring[:i], l.ring[i+1:]...)
+			if i < l.next {
+				l.next--
+			}
+			break
+		}
+	}
+}
+
+func (l *Limiter) updateDepth() {
+	metrics.QueueDepth.WithLabelValues(l.cluster, l.backend).Set(float64(l.queued))
+}
+
+func (l *Limiter) observeWait(start time.Time) {
+	metrics.QueueWaitDuration.WithLabelValues(l.cluster, l.backend).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T, cfg Config) *Limiter {
+	t.Helper()
+	l, err := NewLimiter(cfg)
+	if err != nil {
+		t.Fatalf("failed to create limiter: %v", err)
+	}
+	return l
+}
+
+func waitForQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for l.Queued() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d queued requests, got %d", n, l.Queued())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewLimiter(t *testing.T) {
+	if _, err := NewLimiter(Config{}); err == nil {
+		t.Error("expected error without max concurrent")
+	}
+}
+
+func TestLimiter_QueueFull(t *testing.T) {
+	l := newTestLimiter(t, Config{MaxConcurrent: 1, MaxQueued: 1, QueueTimeout: 5 * time.Second})
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	queuedDone := make(chan error, 1)
+	go func() {
+		r, err := l.Acquire(ctx, "a")
+		if err == nil {
+			r()
+		}
+		queuedDone <- err
+	}()
+	waitForQueued(t, l, 1)
+
+	_, err = l.Acquire(ctx, "b")
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) || rejected.Reason != "queue_full" {
+		t.Fatalf("expected queue_full rejection, got %v", err)
+	}
+	if rejected.RetryAfterSeconds() != 5 {
+		t.Errorf("expected Retry-After of 5s, got %d", rejected.RetryAfterSeconds())
+	}
+
+	release()
+	if err := <-queuedDone; err != nil {
+		t.Errorf("expected queued request to be admitted, got %v", err)
+	}
+	if l.Running() != 0 || l.Queued() != 0 {
+		t.Errorf("expected limiter to be idle, got running=%d queued=%d", l.Running(), l.Queued())
+	}
+}
+
+func TestLimiter_QueueTimeout(t *testing.T) {
+	l := newTestLimiter(t, Config{MaxConcurrent: 1, QueueTimeout: 10 * time.Millisecond})
+
+	release, _ := l.Acquire(context.Background(), "a")
+	defer release()
+
+	_, err := l.Acquire(context.Background(), "a")
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) || rejected.Reason != "queue_timeout" {
+		t.Fatalf("expected queue_timeout rejection, got %v", err)
+	}
+	if l.Queued() != 0 {
+		t.Errorf("expected timed out request to leave the queue, got %d queued", l.Queued())
+	}
+}
+
+func TestLimiter_ContextCancelled(t *testing.T) {
+	l := newTestLimiter(t, Config{MaxConcurrent: 1})
+
+	release, _ := l.Acquire(context.Background(), "a")
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(ctx, "a")
+		done <- err
+	}()
+	waitForQueued(t, l, 1)
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if l.Queued() != 0 {
+		t.Errorf("expected cancelled request to leave the queue, got %d queued", l.Queued())
+	}
+}
+
+func TestLimiter_Fairness(t *testing.T) {
+	l := newTestLimiter(t, Config{MaxConcurrent: 1, QueueTimeout: 5 * time.Second})
+	ctx := context.Background()
+
+	release, _ := l.Acquire(ctx, "busy")
+
+	// A busy caller queues many requests before a second caller queues one
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(key string, n int) {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r, err := l.Acquire(ctx, key)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				mu.Lock()
+				order = append(order, key)
+				mu.Unlock()
+				r()
+			}()
+		}
+	}
+	enqueue("busy", 4)
+	waitForQueued(t, l, 4)
+	enqueue("quiet", 1)
+	waitForQueued(t, l, 5)
+
+	release()
+	wg.Wait()
+
+	// The quiet caller is served right after the first busy request
+	if len(order) != 5 || order[1] != "quiet" {
+		t.Errorf("expected quiet caller to be served second, got %v", order)
+	}
+}
@@ -0,0 +1,499 @@
+// Package redact masks sensitive data in Loki query, series and label values
+// responses.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+// DefaultReplacement is used when a rule does not set a replacement.
+const DefaultReplacement = "[REDACTED]"
+
+// tenantLabel is added by Loki to streams of multi-tenant queries.
+const tenantLabel = "__tenant_id__"
+
+// Rule replaces matches of a regular expression in log lines and label values.
+type Rule struct {
+	// Name identifies the rule in metrics.
+	Name string
+	// Pattern is a Go regular expression.
+	Pattern string
+	// Replacement may reference capture groups, e.g. "$1@[REDACTED]".
+	// Defaults to DefaultReplacement.
+	Replacement string
+	// Lines applies the rule to log lines.
+	Lines bool
+	// Labels applies the rule to the values of the listed stream labels.
+	Labels []string
+	// Tenants limits the rule to streams from specific tenants. Empty means all tenants.
+	Tenants []string
+	// Identities and Groups select the callers the rule applies to.
+	// A rule with neither applies to every caller.
+	Identities []string
+	Groups     []string
+	// ExemptIdentities and ExemptGroups are never redacted, e.g. the team
+	// owning the logs.
+	ExemptIdentities []string
+	ExemptGroups     []string
+}
+
+type compiledRule struct {
+	name             string
+	re               *regexp.Regexp
+	replacement      string
+	lines            bool
+	labels           map[string]bool
+	tenants          map[string]bool
+	identities       map[string]bool
+	groups           []string
+	exemptIdentities map[string]bool
+	exemptGroups     []string
+}
+
+// Redactor applies redaction rules to Loki responses.
+type Redactor struct {
+	rules []compiledRule
+}
+
+// NewRedactor compiles the given rules.
+func NewRedactor(rules []Rule) (*Redactor, error) {
+	r := &Redactor{rules: make([]compiledRule, 0, len(rules))}
+
+	for i, rule := range rules {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("redaction rule %d (%s) has no pattern", i, rule.Name)
+		}
+		if !rule.Lines && len(rule.Labels) == 0 {
+			return nil, fmt.Errorf("redaction rule %d (%s) applies to neither lines nor labels", i, rule.Name)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %d (%s) has invalid pattern: %w", i, rule.Name, err)
+		}
+
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = DefaultReplacement
+		}
+
+		r.rules = append(r.rules, compiledRule{
+			name:             rule.Name,
+			re:               re,
+			replacement:      replacement,
+			lines:            rule.Lines,
+			labels:           toSet(rule.Labels),
+			tenants:          toSet(rule.Tenants),
+			identities:       toSet(rule.Identities),
+			groups:           rule.Groups,
+			exemptIdentities: toSet(rule.ExemptIdentities),
+			exemptGroups:     rule.ExemptGroups,
+		})
+	}
+
+	return r, nil
+}
+
+// Applies reports whether any rule applies to the caller. A nil redactor
+// applies no rules.
+func (r *Redactor) Applies(identity middleware.Identity) bool {
+	return len(r.rulesFor(identity)) > 0
+}
+
+// Redact rewrites the streams in a Loki query, query_range or tail response,
+// and the label sets of metric query results. tenants lists the tenants the
+// query was sent for; it is used to select tenant-specific rules for streams
+// and series without a __tenant_id__ label. Other responses are returned
+// unchanged.
+func (r *Redactor) Redact(body []byte, identity middleware.Identity, tenants []string) ([]byte, error) {
+	rules := r.rulesFor(identity)
+	if len(rules) == 0 {
+		return body, nil
+	}
+
+	defaultTenant := singleTenant(tenants)
+
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Tail responses carry streams at the top level
+	if raw, ok := resp["streams"]; ok {
+		streams, err := redactStreams(raw, rules, defaultTenant)
+		if err != nil {
+			return nil, err
+		}
+		resp["streams"] = streams
+		return json.Marshal(resp)
+	}
+
+	rawData, ok := resp["data"]
+	if !ok {
+		return body, nil
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(rawData, &data); err != nil {
+		return body, nil
+	}
+	var resultType string
+	if err := json.Unmarshal(data["resultType"], &resultType); err != nil {
+		return body, nil
+	}
+
+	var result json.RawMessage
+	var err error
+	switch resultType {
+	case "streams":
+		result, err = redactStreams(data["result"], rules, defaultTenant)
+	case "matrix", "vector":
+		// Metric results have no log lines
+		if !slices.ContainsFunc(rules, func(rule compiledRule) bool { return len(rule.labels) > 0 }) {
+			return body, nil
+		}
+		result, err = redactMetrics(data["result"], rules, defaultTenant)
+	default:
+		return body, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data["result"] = result
+
+	if resp["data"], err = json.Marshal(data); err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// RedactSeries rewrites the label sets in a Loki series response. tenants is
+// used as in Redact.
+func (r *Redactor) RedactSeries(body []byte, identity middleware.Identity, tenants []string) ([]byte, error) {
+	rules := r.rulesFor(identity)
+	if len(rules) == 0 {
+		return body, nil
+	}
+
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	rawData, ok := resp["data"]
+	if !ok {
+		return body, nil
+	}
+
+	var series []map[string]string
+	if err := json.Unmarshal(rawData, &series); err != nil {
+		return nil, fmt.Errorf("failed to decode series: %w", err)
+	}
+
+	defaultTenant := singleTenant(tenants)
+	for _, labels := range series {
+		tenant := defaultTenant
+		if t, ok := labels[tenantLabel]; ok {
+			tenant = t
+		}
+		for name, value := range labels {
+			for _, rule := range rules {
+				if rule.labels[name] && rule.appliesToTenant(tenant) {
+					value = rule.replace(value, "label")
+				}
+			}
+			labels[name] = value
+		}
+	}
+
+	var err error
+	if resp["data"], err = json.Marshal(series); err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// RedactLabelValues rewrites the values in a Loki label values response for
+// the given label. Values are not attributed to tenants, so tenant-specific
+// rules apply unless the query was sent for a single other tenant. Values that
+// become equal after redaction are listed once.
+func (r *Redactor) RedactLabelValues(body []byte, name string, identity middleware.Identity, tenants []string) ([]byte, error) {
+	tenant := singleTenant(tenants)
+	var rules []compiledRule
+	for _, rule := range r.rulesFor(identity) {
+		if rule.labels[name] && rule.appliesToTenant(tenant) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return body, nil
+	}
+
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	rawData, ok := resp["data"]
+	if !ok {
+		return body, nil
+	}
+
+	var values []string
+	if err := json.Unmarshal(rawData, &values); err != nil {
+		return nil, fmt.Errorf("failed to decode label values: %w", err)
+	}
+
+	seen := make(map[string]bool, len(values))
+	redacted := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, rule := range rules {
+			value = rule.replace(value, "label")
+		}
+		if !seen[value] {
+			seen[value] = true
+			redacted = append(redacted, value)
+		}
+	}
+
+	var err error
+	if resp["data"], err = json.Marshal(redacted); err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// singleTenant returns the tenant of a single-tenant query, or "" if the
+// query was sent for several tenants.
+func singleTenant(tenants []string) string {
+	if len(tenants) == 1 {
+		return tenants[0]
+	}
+	return ""
+}
+
+func (r *Redactor) rulesFor(identity middleware.Identity) []compiledRule {
+	if r == nil {
+		return nil
+	}
+
+	var rules []compiledRule
+	for _, rule := range r.rules {
+		if rule.appliesTo(identity) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (r compiledRule) appliesTo(identity middleware.Identity) bool {
+	if r.exemptIdentities[identity.Name] {
+		return false
+	}
+	for _, g := range r.exemptGroups {
+		if identity.InGroup(g) {
+			return false
+		}
+	}
+
+	if len(r.identities) == 0 && len(r.groups) == 0 {
+		return true
+	}
+	if r.identities[identity.Name] {
+		return true
+	}
+	for _, g := range r.groups {
+		if identity.InGroup(g) {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesToTenant reports whether the rule applies to a stream from the given
+// tenant. Streams of unknown tenants are always redacted.
+func (r compiledRule) appliesToTenant(tenant string) bool {
+	return len(r.tenants) == 0 || tenant == "" || r.tenants[tenant]
+}
+
+// replace applies the rule to s, recording the number of matches.
+func (r compiledRule) replace(s, target string) string {
+	matches := len(r.re.FindAllStringIndex(s, -1))
+	if matches == 0 {
+		return s
+	}
+	metrics.RedactionsTotal.WithLabelValues(r.name, target).Add(float64(matches))
+	return r.re.ReplaceAllString(s, r.replacement)
+}
+
+func redactStreams(raw json.RawMessage, rules []compiledRule, defaultTenant string) (json.RawMessage, error) {
+	var streams []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &streams); err != nil {
+		return nil, fmt.Errorf("failed to decode streams: %w", err)
+	}
+
+	for _, stream := range streams {
+		var streamLabels map[string]string
+		if rawLabels, ok := stream["stream"]; ok {
+			if err := json.Unmarshal(rawLabels, &streamLabels); err != nil {
+				return nil, fmt.Errorf("failed to decode stream labels: %w", err)
+			}
+		}
+
+		tenant := defaultTenant
+		if t, ok := streamLabels[tenantLabel]; ok {
+			tenant = t
+		}
+
+		var applicable []compiledRule
+		for _, rule := range rules {
+			if rule.appliesToTenant(tenant) {
+				applicable = append(applicable, rule)
+			}
+		}
+		if len(applicable) == 0 {
+			continue
+		}
+
+		if err := redactLabels(stream, "stream", streamLabels, applicable); err != nil {
+			return nil, err
+		}
+		if err := redactLines(stream, applicable); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(streams)
+}
+
+// redactMetrics applies the label rules to the label sets of a matrix or
+// vector result.
+func redactMetrics(raw json.RawMessage, rules []compiledRule, defaultTenant string) (json.RawMessage, error) {
+	var result []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode series: %w", err)
+	}
+
+	for _, series := range result {
+		var metric map[string]string
+		if rawLabels, ok := series["metric"]; ok {
+			if err := json.Unmarshal(rawLabels, &metric); err != nil {
+				return nil, fmt.Errorf("failed to decode series labels: %w", err)
+			}
+		}
+
+		tenant := defaultTenant
+		if t, ok := metric[tenantLabel]; ok {
+			tenant = t
+		}
+
+		var applicable []compiledRule
+		for _, rule := range rules {
+			if rule.appliesToTenant(tenant) {
+				applicable = append(applicable, rule)
+			}
+		}
+		if err := redactLabels(series, "metric", metric, applicable); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(result)
+}
+
+// redactLabels applies the label rules to the labels of a stream or series,
+// stored under key.
+func redactLabels(stream map[string]json.RawMessage, key string, streamLabels map[string]string, rules []compiledRule) error {
+	changed := false
+	for name, value := range streamLabels {
+		for _, rule := range rules {
+			if !rule.labels[name] {
+				continue
+			}
+			if redacted := rule.replace(value, "label"); redacted != value {
+				value = redacted
+				streamLabels[name] = value
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	rawLabels, err := json.Marshal(streamLabels)
+	if err != nil {
+		return err
+	}
+	stream[key] = rawLabels
+	return nil
+}
+
+func redactLines(stream map[string]json.RawMessage, rules []compiledRule) error {
+	lineRules := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.lines {
+			lineRules = append(lineRules, rule)
+		}
+	}
+	if len(lineRules) == 0 {
+		return nil
+	}
+
+	rawValues, ok := stream["values"]
+	if !ok {
+		return nil
+	}
+
+	// Each entry is [timestamp, line] with optional structured metadata
+	var values [][]json.RawMessage
+	if err := json.Unmarshal(rawValues, &values); err != nil {
+		return fmt.Errorf("failed to decode stream values: %w", err)
+	}
+
+	changed := false
+	for _, entry := range values {
+		if len(entry) < 2 {
+			continue
+		}
+		var line string
+		if err := json.Unmarshal(entry[1], &line); err != nil {
+			return fmt.Errorf("failed to decode log line: %w", err)
+		}
+
+		redacted := line
+		for _, rule := range lineRules {
+			redacted = rule.replace(redacted, "line")
+		}
+		if redacted == line {
+			continue
+		}
+
+		rawLine, err := json.Marshal(redacted)
+		if err != nil {
+			return err
+		}
+		entry[1] = rawLine
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	rawValues, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	stream["values"] = rawValues
+	return nil
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,345 @@
+package redact
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+)
+
+const emailPattern = `[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`
+
+func TestNewRedactor_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []Rule
+		errMsg string
+	}{
+		{
+			name:   "no pattern",
+			rules:  []Rule{{Name: "empty", Lines: true}},
+			errMsg: "has no pattern",
+		},
+		{
+			name:   "no target",
+			rules:  []Rule{{Name: "untargeted", Pattern: "x"}},
+			errMsg: "neither lines nor labels",
+		},
+		{
+			name:   "invalid pattern",
+			rules:  []Rule{{Name: "bad", Pattern: "(", Lines: true}},
+			errMsg: "invalid pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRedactor(tt.rules)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestRedactor_Applies(t *testing.T) {
+	r, err := NewRedactor([]Rule{
+		{Name: "emails", Pattern: emailPattern, Lines: true, ExemptGroups: []string{"payments"}},
+		{Name: "contractors", Pattern: "secret", Lines: true, Groups: []string{"contractors"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !r.Applies(middleware.Identity{Name: "grafana"}) {
+		t.Error("expected rule to apply to non-exempt caller")
+	}
+	if r.Applies(middleware.Identity{Name: "alice", Groups: []string{"payments"}}) {
+		t.Error("expected exempt caller to have no rules")
+	}
+	if !r.Applies(middleware.Identity{Name: "bob", Groups: []string{"payments", "contractors"}}) {
+		t.Error("expected group rule to apply")
+	}
+
+	var nilRedactor *Redactor
+	if nilRedactor.Applies(middleware.Identity{}) {
+		t.Error("expected nil redactor to apply no rules")
+	}
+}
+
+func TestRedactor_Redact_QueryResponse(t *testing.T) {
+	r, err := NewRedactor([]Rule{
+		{Name: "emails", Pattern: emailPattern, Lines: true, Labels: []string{"user"}},
+		{Name: "tokens", Pattern: `(token=)\S+`, Replacement: "${1}***", Lines: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body := `{"status":"success","data":{"resultType":"streams","result":[` +
+		`{"stream":{"app":"api","user":"jane@example.com"},"values":[` +
+		`["1700000000000000000","login by jane@example.com token=abc123"],` +
+		`["1700000000000000001","healthy",{"trace_id":"t1"}]]}],` +
+		`"stats":{"summary":{"bytesProcessedPerSecond":1}}}}`
+
+	out, err := r.Redact([]byte(body), middleware.Identity{Name: "grafana"}, []string{"team-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp struct {
+		Status string `json:"status"`
+		Data   struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Stream map[string]string   `json:"stream"`
+				Values [][]json.RawMessage `json:"values"`
+			} `json:"result"`
+			Stats json.RawMessage `json:"stats"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("failed to decode redacted response: %v", err)
+	}
+
+	stream := resp.Data.Result[0]
+	if stream.Stream["user"] != DefaultReplacement {
+		t.Errorf("expected user label redacted, got %s", stream.Stream["user"])
+	}
+	if stream.Stream["app"] != "api" {
+		t.Errorf("expected app label unchanged, got %s", stream.Stream["app"])
+	}
+
+	var line string
+	json.Unmarshal(stream.Values[0][1], &line)
+	if line != "login by [REDACTED] token=***" {
+		t.Errorf("unexpected redacted line: %s", line)
+	}
+	if len(stream.Values[1]) != 3 {
+		t.Errorf("expected structured metadata to be preserved, got %v", stream.Values[1])
+	}
+	if len(resp.Data.Stats) == 0 {
+		t.Error("expected stats to be preserved")
+	}
+}
+
+func TestRedactor_Redact_Tenants(t *testing.T) {
+	r, err := NewRedactor([]Rule{
+		{Name: "emails", Pattern: emailPattern, Lines: true, Tenants: []string{"team-a"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body := `{"status":"success","data":{"resultType":"streams","result":[` +
+		`{"stream":{"__tenant_id__":"team-a"},"values":[["1","jane@example.com"]]},` +
+		`{"stream":{"__tenant_id__":"team-b"},"values":[["1","john@example.com"]]}]}}`
+
+	out, err := r.Redact([]byte(body), middleware.Identity{Name: "grafana"}, []string{"team-a", "team-b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(out), "jane@example.com") {
+		t.Error("expected team-a stream to be redacted")
+	}
+	if !strings.Contains(string(out), "john@example.com") {
+		t.Error("expected team-b stream to be left unchanged")
+	}
+
+	// Single-tenant queries have no __tenant_id__ label
+	single := `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"x"},"values":[["1","jane@example.com"]]}]}}`
+	out, err = r.Redact([]byte(single), middleware.Identity{Name: "grafana"}, []string{"team-b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(out), "jane@example.com") {
+		t.Error("expected stream of other tenant to be left unchanged")
+	}
+}
+
+func TestRedactor_Redact_Tail(t *testing.T) {
+	r, err := NewRedactor([]Rule{{Name: "emails", Pattern: emailPattern, Lines: true}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body := `{"streams":[{"stream":{"app":"x"},"values":[["1","mail jane@example.com"]]}],"dropped_entries":null}`
+	out, err := r.Redact([]byte(body), middleware.Identity{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(out), "jane@example.com") {
+		t.Errorf("expected tail stream to be redacted, got %s", out)
+	}
+	if !strings.Contains(string(out), "dropped_entries") {
+		t.Error("expected other fields to be preserved")
+	}
+}
+
+func TestRedactor_Redact_Unchanged(t *testing.T) {
+	r, err := NewRedactor([]Rule{{Name: "emails", Pattern: emailPattern, Lines: true}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"matrix result", `{"status":"success","data":{"resultType":"matrix","result":[]}}`},
+		{"no data", `{"status":"success"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := r.Redact([]byte(tt.body), middleware.Identity{}, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(out) != tt.body {
+				t.Errorf("expected body unchanged, got %s", out)
+			}
+		})
+	}
+
+	if _, err := r.Redact([]byte("not json"), middleware.Identity{}, nil); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestRedactor_RedactSeries(t *testing.T) {
+	r, err := NewRedactor([]Rule{
+		{Name: "emails", Pattern: emailPattern, Labels: []string{"user"}, Tenants: []string{"team-a"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body := `{"status":"success","data":[` +
+		`{"__tenant_id__":"team-a","user":"jane@example.com","app":"jane@example.com"},` +
+		`{"__tenant_id__":"team-b","user":"john@example.com"}]}`
+
+	out, err := r.RedactSeries([]byte(body), middleware.Identity{Name: "grafana"}, []string{"team-a", "team-b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp struct {
+		Data []map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("expected 2 series, got %d", len(resp.Data))
+	}
+	if resp.Data[0]["user"] != DefaultReplacement {
+		t.Errorf("expected user label of team-a to be redacted, got %q", resp.Data[0]["user"])
+	}
+	if resp.Data[0]["app"] != "jane@example.com" {
+		t.Errorf("expected unlisted label to be left unchanged, got %q", resp.Data[0]["app"])
+	}
+	if resp.Data[1]["user"] != "john@example.com" {
+		t.Errorf("expected series of team-b to be left unchanged, got %q", resp.Data[1]["user"])
+	}
+}
+
+func TestRedactor_RedactLabelValues(t *testing.T) {
+	r, err := NewRedactor([]Rule{
+		{Name: "emails", Pattern: emailPattern, Labels: []string{"user"}, Tenants: []string{"team-a"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body := `{"status":"success","data":["jane@example.com","john@example.com","system"]}`
+
+	tests := []struct {
+		name     string
+		label    string
+		tenants  []string
+		expected []string
+	}{
+		{
+			name:     "listed label",
+			label:    "user",
+			tenants:  []string{"team-a"},
+			expected: []string{DefaultReplacement, "system"},
+		},
+		{
+			name:     "multi-tenant query",
+			label:    "user",
+			tenants:  []string{"team-a", "team-b"},
+			expected: []string{DefaultReplacement, "system"},
+		},
+		{
+			name:     "other tenant",
+			label:    "user",
+			tenants:  []string{"team-b"},
+			expected: []string{"jane@example.com", "john@example.com", "system"},
+		},
+		{
+			name:     "unlisted label",
+			label:    "app",
+			tenants:  []string{"team-a"},
+			expected: []string{"jane@example.com", "john@example.com", "system"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := r.RedactLabelValues([]byte(body), tt.label, middleware.Identity{Name: "grafana"}, tt.tenants)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var resp struct {
+				Data []string `json:"data"`
+			}
+			if err := json.Unmarshal(out, &resp); err != nil {
+				t.Fatalf("failed to decode output: %v", err)
+			}
+			if !slices.Equal(resp.Data, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, resp.Data)
+			}
+		})
+	}
+}
+
+func TestRedactor_Redact_MetricLabels(t *testing.T) {
+	r, err := NewRedactor([]Rule{
+		{Name: "emails", Pattern: emailPattern, Labels: []string{"user"}, Tenants: []string{"team-a"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"vector", `{"status":"success","data":{"resultType":"vector","result":[` +
+			`{"metric":{"user":"jane@example.com"},"value":[1,"2"]},` +
+			`{"metric":{"__tenant_id__":"team-b","user":"john@example.com"},"value":[1,"3"]}]}}`},
+		{"matrix", `{"status":"success","data":{"resultType":"matrix","result":[` +
+			`{"metric":{"user":"jane@example.com"},"values":[[1,"2"]]},` +
+			`{"metric":{"__tenant_id__":"team-b","user":"john@example.com"},"values":[[1,"3"]]}]}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := r.Redact([]byte(tt.body), middleware.Identity{Name: "grafana"}, []string{"team-a"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Contains(string(out), "jane@example.com") {
+				t.Errorf("expected series of team-a to be redacted, got %s", out)
+			}
+			if !strings.Contains(string(out), "john@example.com") {
+				t.Errorf("expected series of team-b to be left unchanged, got %s", out)
+			}
+		})
+	}
+}
@@ -3,22 +3,37 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/rest"
 
+	"github.com/tjorri/observability-federation-proxy/internal/audit"
+	"github.com/tjorri/observability-federation-proxy/internal/breaker"
+	"github.com/tjorri/observability-federation-proxy/internal/cache"
 	"github.com/tjorri/observability-federation-proxy/internal/cluster"
 	"github.com/tjorri/observability-federation-proxy/internal/config"
+	"github.com/tjorri/observability-federation-proxy/internal/health"
+	"github.com/tjorri/observability-federation-proxy/internal/limits"
 	"github.com/tjorri/observability-federation-proxy/internal/loki"
 	"github.com/tjorri/observability-federation-proxy/internal/metrics"
 	"github.com/tjorri/observability-federation-proxy/internal/middleware"
 	"github.com/tjorri/observability-federation-proxy/internal/mimir"
+	"github.com/tjorri/observability-federation-proxy/internal/policy"
+	"github.com/tjorri/observability-federation-proxy/internal/prober"
 	"github.com/tjorri/observability-federation-proxy/internal/proxy"
+	"github.com/tjorri/observability-federation-proxy/internal/queue"
+	"github.com/tjorri/observability-federation-proxy/internal/redact"
+	"github.com/tjorri/observability-federation-proxy/internal/slowquery"
 	"github.com/tjorri/observability-federation-proxy/internal/tenant"
 )
 
@@ -29,33 +44,77 @@ type Server struct {
 	tenantRegistry *tenant.Registry
 	lokiClients    map[string]*proxy.Client
 	mimirClients   map[string]*proxy.Client
+	auditLogger    *audit.Logger
+	slowQueries    *slowquery.Log
+	labelPolicy    *policy.LabelPolicy
+	lokiEndpoints  *policy.EndpointPolicy
+	mimirEndpoints *policy.EndpointPolicy
+	queryLimits    *limits.Resolver
+	redactor       *redact.Redactor
+	lokiCache      *cache.ResultsCache
+	mimirCache     *cache.ResultsCache
+	lokiMetadata   *cache.MetadataCache
+	mimirMetadata  *cache.MetadataCache
+	healthChecker  *health.Checker
+	prober         *prober.Prober
 	httpServer     *http.Server
 	mux            *http.ServeMux
 }
 
-// New creates a new Server with the given configuration and registries.
-func New(cfg *config.Config, registry *cluster.Registry, tenantRegistry *tenant.Registry) *Server {
+// New creates a new Server with the given configuration and registries. It
+// fails if the access policies or audit sinks cannot be created, so that the
+// proxy never starts without the restrictions and audit trail it was
+// configured with.
+func New(cfg *config.Config, registry *cluster.Registry, tenantRegistry *tenant.Registry) (*Server, error) {
 	s := &Server{
 		config:         cfg,
 		registry:       registry,
 		tenantRegistry: tenantRegistry,
 		lokiClients:    make(map[string]*proxy.Client),
 		mimirClients:   make(map[string]*proxy.Client),
+		auditLogger:    audit.NewLogger(),
 		mux:            http.NewServeMux(),
 	}
 
-	// Create proxy clients for each cluster
+	// Compile access policies
+	if err := s.createPolicies(); err != nil {
+		return nil, err
+	}
+
+	// Create audit sinks if configured
+	if err := s.createAuditSinks(); err != nil {
+		return nil, err
+	}
+
+	// Create slow query log if enabled
+	s.createSlowQueryLog()
+
+	// Resolve query guardrails
+	s.createLimits()
+
+	// Create results caches if enabled
+	s.createResultsCaches()
+
+	// Create metadata caches if enabled
+	s.createMetadataCaches()
+
+	// Create proxy clients and health checks for each cluster
 	if registry != nil {
 		s.createProxyClients()
+		s.createHealthChecker()
+		s.createTenantSources()
 	}
 
+	// Create canary queries if enabled
+	s.createProber()
+
 	// Record cluster info metrics
 	s.recordClusterMetrics()
 
 	s.registerRoutes()
 
 	// Build handler chain with middleware
-	handler := s.buildHandlerChain()
+	handler := s.buildHandlerChain(true)
 
 	s.httpServer = &http.Server{
 		Addr:         cfg.Proxy.ListenAddress,
@@ -65,17 +124,30 @@ func New(cfg *config.Config, registry *cluster.Registry, tenantRegistry *tenant.
 		IdleTimeout:  120 * time.Second,
 	}
 
-	return s
+	return s, nil
 }
 
-func (s *Server) buildHandlerChain() http.Handler {
+// buildHandlerChain wraps the router in the middleware chain. Canary queries
+// skip authentication, as the prober sets its own identity.
+func (s *Server) buildHandlerChain(authenticate bool) http.Handler {
 	var handler http.Handler = s.mux
 
+	// Add slow query middleware (inside audit so it shares the audit event)
+	if s.slowQueries != nil {
+		handler = middleware.SlowQueries(s.slowQueries)(handler)
+	}
+
+	// Add audit middleware (inside auth so the caller identity is known)
+	if s.auditLogger.Enabled() {
+		handler = middleware.Audit(s.auditLogger)(handler)
+	}
+
 	// Add authentication middleware
-	if s.config.Auth.Enabled {
+	if authenticate && s.config.Auth.Enabled {
 		authMiddleware := middleware.Auth(middleware.AuthConfig{
 			Enabled:      true,
 			BearerTokens: s.config.Auth.BearerTokens,
+			Identities:   s.tokenIdentities(),
 			SkipPaths:    []string{"/healthz", "/readyz", "/metrics"},
 		})
 		handler = authMiddleware(handler)
@@ -83,14 +155,360 @@ func (s *Server) buildHandlerChain() http.Handler {
 
 	// Add standard middleware
 	handler = middleware.Chain(handler,
+		middleware.RequestID,
 		middleware.Recovery,
 		middleware.Logging,
 		middleware.Metrics,
 	)
 
+	// Add tracing middleware outermost so the server span covers the whole chain
+	if s.config.Tracing.Enabled {
+		handler = middleware.Tracing(handler)
+	}
+
 	return handler
 }
 
+func (s *Server) tokenIdentities() []middleware.TokenIdentity {
+	identities := make([]middleware.TokenIdentity, 0, len(s.config.Auth.Identities))
+	for _, id := range s.config.Auth.Identities {
+		identities = append(identities, middleware.TokenIdentity{
+			Token:  id.Token,
+			Name:   id.Name,
+			Groups: id.Groups,
+		})
+	}
+	return identities
+}
+
+// createAuditSinks creates the configured audit sinks. It fails if a sink
+// cannot be created, rather than serving requests without an audit trail.
+func (s *Server) createAuditSinks() error {
+	if !s.config.Audit.Enabled {
+		return nil
+	}
+
+	if fileCfg := s.config.Audit.File; fileCfg != nil {
+		sink, err := audit.NewFileSink(audit.FileSinkConfig{
+			Path:       fileCfg.Path,
+			MaxSizeMB:  fileCfg.MaxSizeMB,
+			MaxBackups: fileCfg.MaxBackups,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create audit file sink: %w", err)
+		}
+		s.auditLogger.AddSink(sink)
+		log.Info().Str("path", fileCfg.Path).Msg("created audit file sink")
+	}
+
+	if webhookCfg := s.config.Audit.Webhook; webhookCfg != nil {
+		sink, err := audit.NewWebhookSink(audit.WebhookSinkConfig{
+			URL:           webhookCfg.URL,
+			Headers:       webhookCfg.Headers,
+			BatchSize:     webhookCfg.BatchSize,
+			QueueSize:     webhookCfg.QueueSize,
+			FlushInterval: webhookCfg.FlushInterval,
+			MaxRetries:    webhookCfg.MaxRetries,
+			Timeout:       webhookCfg.Timeout,
+		})
+		if err != nil {
+			// Close the file sink, if any
+			s.auditLogger.Close()
+			return fmt.Errorf("failed to create audit webhook sink: %w", err)
+		}
+		s.auditLogger.AddSink(sink)
+		log.Info().Msg("created audit webhook sink")
+	}
+	return nil
+}
+
+func (s *Server) createSlowQueryLog() {
+	cfg := s.config.SlowQueries
+	if !cfg.Enabled {
+		return
+	}
+
+	s.slowQueries = slowquery.New(slowquery.Config{
+		MinDuration: cfg.MinDuration,
+		MinBytes:    int64(cfg.MinResponseSizeMB) << 20,
+		Size:        cfg.BufferSize,
+	})
+
+	log.Info().
+		Dur("min_duration", cfg.MinDuration).
+		Int("min_response_size_mb", cfg.MinResponseSizeMB).
+		Msg("created slow query log")
+}
+
+func (s *Server) createPolicies() error {
+	rules := make([]policy.LabelRule, 0, len(s.config.Policies.Labels))
+	for _, p := range s.config.Policies.Labels {
+		rules = append(rules, policy.LabelRule{
+			Name:       p.Name,
+			Identities: p.Identities,
+			Groups:     p.Groups,
+			Clusters:   p.Clusters,
+			Matchers:   p.Matchers,
+		})
+	}
+
+	labelPolicy, err := policy.NewLabelPolicy(rules)
+	if err != nil {
+		return fmt.Errorf("failed to compile label policies: %w", err)
+	}
+	s.labelPolicy = labelPolicy
+
+	redactionRules := make([]redact.Rule, 0, len(s.config.Policies.Redaction))
+	for _, r := range s.config.Policies.Redaction {
+		redactionRules = append(redactionRules, redact.Rule{
+			Name:             r.Name,
+			Pattern:          r.Pattern,
+			Replacement:      r.Replacement,
+			Lines:            r.Lines,
+			Labels:           r.Labels,
+			Tenants:          r.Tenants,
+			Identities:       r.Identities,
+			Groups:           r.Groups,
+			ExemptIdentities: r.ExemptIdentities,
+			ExemptGroups:     r.ExemptGroups,
+		})
+	}
+
+	redactor, err := redact.NewRedactor(redactionRules)
+	if err != nil {
+		return fmt.Errorf("failed to compile redaction rules: %w", err)
+	}
+	s.redactor = redactor
+
+	s.lokiEndpoints, err = endpointPolicy("loki", s.config.Policies.Endpoints.Loki, policy.DefaultLokiEndpointRules)
+	if err != nil {
+		return err
+	}
+	s.mimirEndpoints, err = endpointPolicy("mimir", s.config.Policies.Endpoints.Mimir, policy.DefaultMimirEndpointRules)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// endpointPolicy compiles the configured endpoint rules for a backend, followed
+// by the built-in defaults unless they are disabled.
+func endpointPolicy(backend string, cfg config.EndpointPolicyConfig, defaults []policy.EndpointRule) (*policy.EndpointPolicy, error) {
+	rules := make([]policy.EndpointRule, 0, len(cfg.Rules)+len(defaults))
+	for _, r := range cfg.Rules {
+		rules = append(rules, policy.EndpointRule{
+			Name:       r.Name,
+			Action:     r.Action,
+			Methods:    r.Methods,
+			Paths:      r.Paths,
+			Identities: r.Identities,
+			Groups:     r.Groups,
+		})
+	}
+	if !cfg.DisableDefaults {
+		rules = append(rules, defaults...)
+	}
+
+	p, err := policy.NewEndpointPolicy(rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile %s endpoint policy: %w", backend, err)
+	}
+	return p, nil
+}
+
+func (s *Server) createLimits() {
+	clusters := make(map[string]limits.Limits, len(s.config.Limits.Clusters))
+	for _, o := range s.config.Limits.Clusters {
+		clusters[o.Name] = queryLimits(o.QueryLimitsConfig)
+	}
+	identities := make(map[string]limits.Limits, len(s.config.Limits.Identities))
+	for _, o := range s.config.Limits.Identities {
+		identities[o.Name] = queryLimits(o.QueryLimitsConfig)
+	}
+
+	s.queryLimits = limits.NewResolver(queryLimits(s.config.Limits.Default), clusters, identities)
+}
+
+func queryLimits(cfg config.QueryLimitsConfig) limits.Limits {
+	return limits.Limits{
+		MaxRange:       cfg.MaxRange,
+		MinStep:        cfg.MinStep,
+		MaxPoints:      cfg.MaxPoints,
+		MaxQueryLength: cfg.MaxQueryLength,
+		MaxLogLimit:    cfg.MaxLokiLimit,
+	}
+}
+
+func (s *Server) createResultsCaches() {
+	cfg := s.config.Cache.Results
+	if !cfg.Enabled {
+		return
+	}
+
+	// Both backends share one size-limited LRU
+	lru := cache.NewLRU("results", int64(cfg.MaxSizeMB)<<20)
+
+	newResultsCache := func(backend string) *cache.ResultsCache {
+		resultsCache, err := cache.NewResultsCache(cache.ResultsCacheConfig{
+			Cache:        lru,
+			Backend:      backend,
+			MaxFreshness: cfg.MaxFreshness,
+			TTL:          cfg.TTL,
+		})
+		if err != nil {
+			log.Error().Err(err).Str("backend", backend).Msg("failed to create results cache")
+			return nil
+		}
+		return resultsCache
+	}
+
+	s.lokiCache = newResultsCache("loki")
+	s.mimirCache = newResultsCache("mimir")
+
+	log.Info().Int("max_size_mb", cfg.MaxSizeMB).Msg("created results cache")
+}
+
+func (s *Server) createMetadataCaches() {
+	cfg := s.config.Cache.Metadata
+	if !cfg.Enabled {
+		return
+	}
+
+	// Both backends share one size-limited LRU
+	lru := cache.NewLRU("metadata", int64(cfg.MaxSizeMB)<<20)
+
+	newMetadataCache := func(backend string) *cache.MetadataCache {
+		metadataCache, err := cache.NewMetadataCache(cache.MetadataCacheConfig{
+			Cache:           lru,
+			Backend:         backend,
+			TTL:             cfg.TTL,
+			StaleTTL:        cfg.StaleTTL,
+			TimeGranularity: cfg.TimeGranularity,
+		})
+		if err != nil {
+			log.Error().Err(err).Str("backend", backend).Msg("failed to create metadata cache")
+			return nil
+		}
+		return metadataCache
+	}
+
+	s.lokiMetadata = newMetadataCache("loki")
+	s.mimirMetadata = newMetadataCache("mimir")
+
+	// Label values depend on the tenants queried, so drop a cluster's entries
+	// whenever its tenant set changes
+	if s.tenantRegistry != nil {
+		s.tenantRegistry.OnChange(func(clusterName string, _ []string) {
+			for _, metadataCache := range []*cache.MetadataCache{s.lokiMetadata, s.mimirMetadata} {
+				if metadataCache != nil {
+					metadataCache.Invalidate(clusterName)
+				}
+			}
+		})
+	}
+
+	log.Info().Int("max_size_mb", cfg.MaxSizeMB).Msg("created metadata cache")
+}
+
+// upstreamRESTClient creates the REST client for proxied traffic to a
+// cluster, falling back to the cluster's shared client on error.
+func (s *Server) upstreamRESTClient(c *cluster.Cluster) rest.Interface {
+	restCfg := c.RESTConfig()
+	if restCfg == nil {
+		return nil
+	}
+
+	cfg := s.config.Proxy.Client
+	restClient, err := proxy.NewRESTClient(restCfg, proxy.RESTClientConfig{
+		Cluster:             c.Name,
+		QPS:                 cfg.QPS,
+		Burst:               cfg.Burst,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("cluster", c.Name).Msg("failed to create proxy REST client, using shared client")
+		return nil
+	}
+	return restClient
+}
+
+// concurrencyLimiter creates the concurrency limiter for a cluster backend,
+// applying any cluster override on top of the defaults. It returns nil if
+// concurrency limiting is disabled.
+func (s *Server) concurrencyLimiter(clusterName, backend string) *queue.Limiter {
+	cfg := s.config.Concurrency
+	if !cfg.Enabled {
+		return nil
+	}
+
+	limits := cfg.ConcurrencyLimitsConfig
+	for _, o := range cfg.Clusters {
+		if o.Name != clusterName {
+			continue
+		}
+		if o.MaxConcurrent > 0 {
+			limits.MaxConcurrent = o.MaxConcurrent
+		}
+		if o.MaxQueued > 0 {
+			limits.MaxQueued = o.MaxQueued
+		}
+		if o.QueueTimeout > 0 {
+			limits.QueueTimeout = o.QueueTimeout
+		}
+	}
+
+	limiter, err := queue.NewLimiter(queue.Config{
+		Cluster:       clusterName,
+		Backend:       backend,
+		MaxConcurrent: limits.MaxConcurrent,
+		MaxQueued:     limits.MaxQueued,
+		QueueTimeout:  limits.QueueTimeout,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("cluster", clusterName).Str("backend", backend).Msg("failed to create concurrency limiter")
+		return nil
+	}
+	return limiter
+}
+
+// circuitBreaker creates the circuit breaker for a cluster backend. It
+// returns nil if circuit breaking is disabled.
+func (s *Server) circuitBreaker(clusterName, backend string) *breaker.Breaker {
+	cfg := s.config.CircuitBreaker
+	if !cfg.Enabled {
+		return nil
+	}
+	return breaker.New(breaker.Config{
+		Cluster:             clusterName,
+		Backend:             backend,
+		ConsecutiveFailures: cfg.ConsecutiveFailures,
+		FailureRatio:        cfg.FailureRatio,
+		MinRequests:         cfg.MinRequests,
+		Window:              cfg.Window,
+		OpenTimeout:         cfg.OpenTimeout,
+		HalfOpenRequests:    cfg.HalfOpenRequests,
+	})
+}
+
+// retryConfig returns the retry policy of proxy clients, or nil if retries
+// are disabled.
+func (s *Server) retryConfig() *proxy.RetryConfig {
+	cfg := s.config.Proxy.Retry
+	if !cfg.Enabled {
+		return nil
+	}
+	return &proxy.RetryConfig{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		BudgetRatio:    cfg.BudgetRatio,
+		BudgetBurst:    cfg.BudgetBurst,
+		HedgeAfter:     cfg.HedgeAfter,
+	}
+}
+
 func (s *Server) recordClusterMetrics() {
 	for _, c := range s.config.Clusters {
 		metrics.RecordClusterInfo(c.Name, c.Type, c.Loki != nil, c.Mimir != nil)
@@ -105,15 +523,26 @@ func (s *Server) createProxyClients() {
 			continue
 		}
 
+		// Proxied traffic gets its own rate limiter and connection pool
+		restClient := s.upstreamRESTClient(c)
+
 		// Create Loki proxy client if configured
 		if clusterCfg.Loki != nil {
 			client, err := proxy.NewClient(proxy.ClientConfig{
 				K8sClient:  c.Client,
+				RESTClient: restClient,
+				Cluster:    clusterCfg.Name,
+				Backend:    "loki",
+				Limiter:    s.concurrencyLimiter(clusterCfg.Name, "loki"),
+				FairBy:     s.config.Concurrency.FairBy,
+				Breaker:    s.circuitBreaker(clusterCfg.Name, "loki"),
 				Namespace:  clusterCfg.Loki.Namespace,
 				Service:    clusterCfg.Loki.Service,
 				Port:       clusterCfg.Loki.Port,
 				PathPrefix: clusterCfg.Loki.PathPrefix,
 				Timeout:    s.config.Proxy.QueryTimeout,
+				Coalesce:   s.config.Proxy.CoalesceRequests,
+				Retry:      s.retryConfig(),
 			})
 			if err != nil {
 				log.Error().Err(err).Str("cluster", clusterCfg.Name).Msg("failed to create Loki proxy client")
@@ -127,11 +556,19 @@ func (s *Server) createProxyClients() {
 		if clusterCfg.Mimir != nil {
 			client, err := proxy.NewClient(proxy.ClientConfig{
 				K8sClient:  c.Client,
+				RESTClient: restClient,
+				Cluster:    clusterCfg.Name,
+				Backend:    "mimir",
+				Limiter:    s.concurrencyLimiter(clusterCfg.Name, "mimir"),
+				FairBy:     s.config.Concurrency.FairBy,
+				Breaker:    s.circuitBreaker(clusterCfg.Name, "mimir"),
 				Namespace:  clusterCfg.Mimir.Namespace,
 				Service:    clusterCfg.Mimir.Service,
 				Port:       clusterCfg.Mimir.Port,
 				PathPrefix: clusterCfg.Mimir.PathPrefix,
 				Timeout:    s.config.Proxy.QueryTimeout,
+				Coalesce:   s.config.Proxy.CoalesceRequests,
+				Retry:      s.retryConfig(),
 			})
 			if err != nil {
 				log.Error().Err(err).Str("cluster", clusterCfg.Name).Msg("failed to create Mimir proxy client")
@@ -143,6 +580,152 @@ func (s *Server) createProxyClients() {
 	}
 }
 
+// createHealthChecker creates the background checks of each cluster's API
+// server and of its Loki and Mimir backends, reached through the same proxy
+// clients as queries.
+func (s *Server) createHealthChecker() {
+	var checks []health.Check
+	for _, clusterCfg := range s.config.Clusters {
+		c, ok := s.registry.Get(clusterCfg.Name)
+		if !ok {
+			continue
+		}
+
+		checks = append(checks, health.Check{
+			Cluster: clusterCfg.Name,
+			Backend: "apiserver",
+			Check: func(context.Context) error {
+				_, err := c.Client.Discovery().ServerVersion()
+				return err
+			},
+		})
+
+		for backend, backendCfg := range map[string]*config.ServiceConfig{"loki": clusterCfg.Loki, "mimir": clusterCfg.Mimir} {
+			client := s.clientFor(backend, clusterCfg.Name)
+			if backendCfg == nil || client == nil {
+				continue
+			}
+			readyPath := backendCfg.ReadyPath
+			if readyPath == "" {
+				readyPath = "/ready"
+			}
+			checks = append(checks, health.Check{
+				Cluster: clusterCfg.Name,
+				Backend: backend,
+				Check: func(ctx context.Context) error {
+					return client.Ready(ctx, readyPath)
+				},
+			})
+		}
+	}
+
+	s.healthChecker = health.NewChecker(health.Config{
+		Interval: s.config.Health.Interval,
+		Timeout:  s.config.Health.Timeout,
+	}, checks)
+}
+
+// createTenantSources lets the tenant watchers of clusters that discover
+// tenants from their backends list them through the proxy clients.
+func (s *Server) createTenantSources() {
+	if s.tenantRegistry == nil {
+		return
+	}
+
+	for _, clusterCfg := range s.config.Clusters {
+		cfg := clusterCfg.Tenants
+		if cfg.Source == "" || cfg.Source == tenant.SourceNamespaces {
+			continue
+		}
+
+		var sources []tenant.BackendSource
+		if client := s.mimirClients[clusterCfg.Name]; client != nil {
+			path := cfg.Backends.MimirPath
+			if path == "" {
+				path = "/distributor/all_user_stats"
+			}
+			sources = append(sources, tenant.BackendSource{Backend: "mimir", List: listTenants(client, path)})
+		}
+		if client := s.lokiClients[clusterCfg.Name]; client != nil && cfg.Backends.LokiPath != "" {
+			sources = append(sources, tenant.BackendSource{Backend: "loki", List: listTenants(client, cfg.Backends.LokiPath)})
+		}
+		s.tenantRegistry.SetBackendSources(clusterCfg.Name, sources)
+
+		log.Info().
+			Str("cluster", clusterCfg.Name).
+			Str("source", cfg.Source).
+			Int("backend_count", len(sources)).
+			Msg("discovering tenants from backends")
+	}
+}
+
+// listTenants lists the tenants of a backend from its tenant listing at path.
+func listTenants(client *proxy.Client, path string) func(context.Context) ([]string, error) {
+	return func(ctx context.Context) ([]string, error) {
+		ctx = middleware.WithIdentity(ctx, middleware.Identity{Name: "tenant-discovery"})
+		resp, err := client.ProxyAdminRequest(ctx, &proxy.Request{
+			Method:  http.MethodGet,
+			Path:    path,
+			Headers: http.Header{"Accept": {"application/json"}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("tenant listing returned status %d", resp.StatusCode)
+		}
+		return tenant.ParseTenants(resp.Body)
+	}
+}
+
+// createProber creates the canary queries, which are served by the same
+// routes and middleware as real traffic, minus authentication.
+func (s *Server) createProber() {
+	cfg := s.config.Probes
+	if !cfg.Enabled {
+		return
+	}
+
+	probes := make([]prober.Probe, 0, len(cfg.Queries))
+	for _, q := range cfg.Queries {
+		probes = append(probes, prober.Probe{
+			Name:    q.Name,
+			Cluster: q.Cluster,
+			Backend: q.Backend,
+			Query:   q.Query,
+			Range:   q.Range,
+			Expect: prober.Expectation{
+				ResultType: q.Expect.ResultType,
+				MinResults: q.Expect.MinResults,
+				Value:      q.Expect.Value,
+			},
+		})
+	}
+
+	p, err := prober.New(prober.Config{
+		Handler:  s.buildHandlerChain(false),
+		Interval: cfg.Interval,
+		Timeout:  cfg.Timeout,
+		Probes:   probes,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create prober")
+		return
+	}
+	s.prober = p
+
+	log.Info().Int("probe_count", len(probes)).Msg("created prober")
+}
+
+// clientFor returns the proxy client of a cluster backend, or nil if there
+// is none.
+func (s *Server) clientFor(backend, clusterName string) *proxy.Client {
+	if backend == "loki" {
+		return s.lokiClients[clusterName]
+	}
+	return s.mimirClients[clusterName]
+}
+
 func (s *Server) registerRoutes() {
 	// Health and readiness endpoints
 	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
@@ -154,9 +737,19 @@ func (s *Server) registerRoutes() {
 	}
 
 	// Management endpoints
+	s.mux.HandleFunc("GET /api/v1/status", s.handleStatus)
 	s.mux.HandleFunc("GET /api/v1/clusters", s.handleListClusters)
 	s.mux.HandleFunc("GET /api/v1/clusters/{cluster}/tenants", s.handleListTenants)
 
+	// Admin endpoints
+	if s.prober != nil {
+		s.mux.HandleFunc("GET /api/v1/admin/probes", s.handleListProbes)
+	}
+	if s.slowQueries != nil {
+		s.mux.HandleFunc("GET /api/v1/admin/slow-queries", s.handleListSlowQueries)
+		s.mux.HandleFunc("GET /api/v1/admin/slow-queries/summary", s.handleSlowQuerySummary)
+	}
+
 	// Register Loki router
 	s.registerLokiRoutes()
 
@@ -175,6 +768,12 @@ func (s *Server) registerLokiRoutes() {
 		Clients:        lokiProxyClients,
 		TenantRegistry: s.tenantRegistry,
 		MaxOrgIDLength: s.config.Proxy.MaxTenantHeaderLength,
+		LabelPolicy:    s.labelPolicy,
+		EndpointPolicy: s.lokiEndpoints,
+		Limits:         s.queryLimits,
+		Redactor:       s.redactor,
+		ResultsCache:   s.lokiCache,
+		MetadataCache:  s.lokiMetadata,
 	})
 
 	lokiRouter.RegisterRoutes(s.mux, "/clusters/{cluster}/loki")
@@ -191,6 +790,11 @@ func (s *Server) registerMimirRoutes() {
 		Clients:        mimirProxyClients,
 		TenantRegistry: s.tenantRegistry,
 		MaxOrgIDLength: s.config.Proxy.MaxTenantHeaderLength,
+		LabelPolicy:    s.labelPolicy,
+		EndpointPolicy: s.mimirEndpoints,
+		Limits:         s.queryLimits,
+		ResultsCache:   s.mimirCache,
+		MetadataCache:  s.mimirMetadata,
 	})
 
 	mimirRouter.RegisterRoutes(s.mux, "/clusters/{cluster}/mimir")
@@ -198,6 +802,16 @@ func (s *Server) registerMimirRoutes() {
 
 // Run starts the HTTP server and blocks until shutdown.
 func (s *Server) Run() error {
+	if s.tenantRegistry != nil {
+		s.tenantRegistry.Start(context.Background())
+	}
+	if s.healthChecker != nil {
+		s.healthChecker.Start(context.Background())
+	}
+	if s.prober != nil {
+		s.prober.Start(context.Background())
+	}
+
 	errChan := make(chan error, 1)
 	go func() {
 		log.Info().Str("addr", s.config.Proxy.ListenAddress).Msg("starting HTTP server")
@@ -230,9 +844,24 @@ func (s *Server) Shutdown() error {
 		s.tenantRegistry.Stop()
 	}
 
+	// Stop health checks and probes
+	if s.healthChecker != nil {
+		s.healthChecker.Stop()
+	}
+	if s.prober != nil {
+		s.prober.Stop()
+	}
+
 	// Then shutdown HTTP server
 	log.Info().Msg("shutting down HTTP server")
-	return s.httpServer.Shutdown(ctx)
+	err := s.httpServer.Shutdown(ctx)
+
+	// Flush audit events once no more requests are in flight
+	if cerr := s.auditLogger.Close(); cerr != nil {
+		log.Error().Err(cerr).Msg("failed to close audit sinks")
+	}
+
+	return err
 }
 
 // Handler returns the HTTP handler for testing purposes.
@@ -249,28 +878,12 @@ func (s *Server) handleHealthz(w http.ResponseWriter, _ *http.Request) {
 func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if s.registry == nil {
+	if s.healthChecker == nil {
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 		return
 	}
 
-	// Check cluster health
-	results := s.registry.HealthCheck(r.Context())
-	allHealthy := true
-	clusterStatus := make(map[string]string)
-
-	for name, err := range results {
-		if err != nil {
-			allHealthy = false
-			clusterStatus[name] = err.Error()
-			metrics.RecordClusterHealth(name, false)
-		} else {
-			clusterStatus[name] = "ok"
-			metrics.RecordClusterHealth(name, true)
-		}
-	}
-
 	// Record tenant counts
 	if s.tenantRegistry != nil {
 		for cluster, count := range s.tenantRegistry.TenantCounts() {
@@ -278,19 +891,67 @@ func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if allHealthy {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":   "ok",
-			"clusters": clusterStatus,
-		})
-	} else {
+	// Apply the readiness policy to the cached results of the background
+	// health checks; details are served by /api/v1/status
+	ready, reason := s.readinessPolicy().Ready(s.healthChecker.Statuses())
+	if !ready {
 		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":   "degraded",
-			"clusters": clusterStatus,
-		})
+		json.NewEncoder(w).Encode(map[string]string{"status": "unready", "reason": reason})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// readinessPolicy returns the configured readiness policy.
+func (s *Server) readinessPolicy() health.ReadinessPolicy {
+	cfg := s.config.Health.Readiness
+	return health.ReadinessPolicy{
+		Policy:     cfg.Policy,
+		MinHealthy: cfg.MinHealthyClusters,
+		Critical:   cfg.CriticalClusters,
+	}
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{
+		"ready":    true,
+		"clusters": map[string]string{},
+	}
+
+	if s.healthChecker != nil {
+		backends := s.healthChecker.Statuses()
+		ready, reason := s.readinessPolicy().Ready(backends)
+
+		clusterStatus := make(map[string]string, len(backends))
+		for name, statuses := range backends {
+			clusterStatus[name] = "ok"
+			// Report the first backend that is not ok
+			for _, backend := range slices.Sorted(maps.Keys(statuses)) {
+				status := statuses[backend]
+				if status.State == health.OK {
+					continue
+				}
+				message := status.LastError
+				if status.State == health.Pending {
+					message = "not checked yet"
+				}
+				clusterStatus[name] = backend + ": " + message
+				break
+			}
+		}
+
+		resp["ready"] = ready
+		resp["clusters"] = clusterStatus
+		resp["backends"] = backends
+		if reason != "" {
+			resp["reason"] = reason
+		}
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (s *Server) handleListClusters(w http.ResponseWriter, r *http.Request) {
@@ -303,6 +964,17 @@ func (s *Server) handleListClusters(w http.ResponseWriter, r *http.Request) {
 			"hasMimir": c.Mimir != nil,
 		}
 
+		// Add circuit breaker states if enabled
+		circuits := make(map[string]string)
+		for backend, client := range map[string]*proxy.Client{"loki": s.lokiClients[c.Name], "mimir": s.mimirClients[c.Name]} {
+			if client != nil && client.Breaker() != nil {
+				circuits[backend] = client.Breaker().State().String()
+			}
+		}
+		if len(circuits) > 0 {
+			clusterInfo["circuits"] = circuits
+		}
+
 		// Add tenant count if available
 		if s.tenantRegistry != nil {
 			if watcher, ok := s.tenantRegistry.Get(c.Name); ok {
@@ -323,7 +995,7 @@ func (s *Server) handleListTenants(w http.ResponseWriter, r *http.Request) {
 	// Check if cluster exists in registry
 	if s.registry != nil {
 		if _, ok := s.registry.Get(clusterName); !ok {
-			s.writeError(w, http.StatusNotFound, "cluster not found")
+			s.writeError(w, r, http.StatusNotFound, "cluster not found")
 			return
 		}
 	} else {
@@ -336,31 +1008,97 @@ func (s *Server) handleListTenants(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		if !found {
-			s.writeError(w, http.StatusNotFound, "cluster not found")
+			s.writeError(w, r, http.StatusNotFound, "cluster not found")
 			return
 		}
 	}
 
 	// Get tenants from tenant registry
 	var tenants []string
+	resp := map[string]interface{}{"cluster": clusterName}
 	if s.tenantRegistry != nil {
 		tenants = s.tenantRegistry.Tenants(clusterName)
+		if status, ok := s.tenantRegistry.Status(clusterName); ok {
+			resp["watcher"] = status
+		}
 	}
 	if tenants == nil {
 		tenants = []string{}
 	}
+	resp["tenants"] = tenants
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"cluster": clusterName,
-		"tenants": tenants,
-	})
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleListProbes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"probes": s.prober.Results()})
+}
+
+func (s *Server) handleListSlowQueries(w http.ResponseWriter, r *http.Request) {
+	filter, limit, ok := s.slowQueryParams(w, r)
+	if !ok {
+		return
+	}
+
+	records := s.slowQueries.List(filter)
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"queries": records})
 }
 
-func (s *Server) writeError(w http.ResponseWriter, statusCode int, message string) {
+func (s *Server) handleSlowQuerySummary(w http.ResponseWriter, r *http.Request) {
+	filter, limit, ok := s.slowQueryParams(w, r)
+	if !ok {
+		return
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+	json.NewEncoder(w).Encode(map[string]interface{}{"summary": s.slowQueries.Top(filter, limit)})
+}
+
+// slowQueryParams checks that the caller may use the slow query endpoints
+// and parses the cluster, caller and limit parameters. It writes an error
+// response and returns false if the request is rejected.
+func (s *Server) slowQueryParams(w http.ResponseWriter, r *http.Request) (slowquery.Filter, int, bool) {
+	// Records include query text, so callers must be allowlisted.
+	cfg := s.config.SlowQueries
+	identity := middleware.IdentityFromContext(r.Context())
+	allowed := slices.Contains(cfg.Identities, identity.Name)
+	for _, group := range cfg.Groups {
+		allowed = allowed || identity.InGroup(group)
+	}
+	if !allowed {
+		s.writeError(w, r, http.StatusForbidden, "forbidden")
+		return slowquery.Filter{}, 0, false
+	}
+
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			s.writeError(w, r, http.StatusBadRequest, "invalid limit")
+			return slowquery.Filter{}, 0, false
+		}
+		limit = n
+	}
+
+	filter := slowquery.Filter{
+		Cluster:  r.URL.Query().Get("cluster"),
+		Identity: r.URL.Query().Get("caller"),
+	}
+	return filter, limit, true
+}
+
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	middleware.WriteError(r.Context(), w, statusCode, message)
 }
 
 // GetLokiClient returns the Loki proxy client for a cluster (for testing).
@@ -1,13 +1,27 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tjorri/observability-federation-proxy/internal/audit"
+	"github.com/tjorri/observability-federation-proxy/internal/breaker"
 	"github.com/tjorri/observability-federation-proxy/internal/config"
+	"github.com/tjorri/observability-federation-proxy/internal/health"
+	"github.com/tjorri/observability-federation-proxy/internal/middleware"
+	"github.com/tjorri/observability-federation-proxy/internal/prober"
+	"github.com/tjorri/observability-federation-proxy/internal/proxy"
+	"github.com/tjorri/observability-federation-proxy/internal/slowquery"
 )
 
 func testConfig() *config.Config {
@@ -52,8 +66,76 @@ func testConfig() *config.Config {
 	}
 }
 
+func newTestServer(t *testing.T, cfg *config.Config) *Server {
+	t.Helper()
+	srv, err := New(cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	return srv
+}
+
+func TestNew_InvalidLabelPolicy(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies.Labels = []config.LabelPolicyConfig{
+		{Name: "broken", Matchers: []string{`namespace=~"payments-(`}},
+	}
+
+	if _, err := New(cfg, nil, nil); err == nil {
+		t.Fatal("expected error for invalid label policy")
+	}
+}
+
+func TestNew_InvalidRedactionRule(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies.Redaction = []config.RedactionRuleConfig{
+		{Name: "broken", Pattern: `token=(`, Lines: true},
+	}
+
+	if _, err := New(cfg, nil, nil); err == nil {
+		t.Fatal("expected error for invalid redaction rule")
+	}
+}
+
+func TestNew_InvalidEndpointPolicy(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies.Endpoints.Mimir.Rules = []config.EndpointRuleConfig{
+		{Name: "broken", Action: "allow", Paths: []string{"api/v1/**"}},
+	}
+
+	if _, err := New(cfg, nil, nil); err == nil {
+		t.Fatal("expected error for invalid endpoint policy")
+	}
+}
+
+func TestNew_InvalidAuditSink(t *testing.T) {
+	// A file in place of the audit directory
+	dir := filepath.Join(t.TempDir(), "audit")
+	if err := os.WriteFile(dir, nil, 0o640); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		audit config.AuditConfig
+	}{
+		{"file", config.AuditConfig{Enabled: true, File: &config.AuditFileConfig{Path: filepath.Join(dir, "audit.jsonl")}}},
+		{"webhook", config.AuditConfig{Enabled: true, Webhook: &config.AuditWebhookConfig{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Audit = tt.audit
+			if _, err := New(cfg, nil, nil); err == nil {
+				t.Fatal("expected error for an audit sink that cannot be created")
+			}
+		})
+	}
+}
+
 func TestHealthz(t *testing.T) {
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
 	w := httptest.NewRecorder()
@@ -75,7 +157,7 @@ func TestHealthz(t *testing.T) {
 }
 
 func TestReadyz(t *testing.T) {
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
 	w := httptest.NewRecorder()
@@ -96,8 +178,101 @@ func TestReadyz(t *testing.T) {
 	}
 }
 
+func TestReadyz_Policies(t *testing.T) {
+	checks := []health.Check{
+		{Cluster: "test-cluster", Backend: "mimir", Check: func(context.Context) error { return nil }},
+		{Cluster: "loki-only-cluster", Backend: "loki", Check: func(context.Context) error { return errors.New("no endpoints available") }},
+	}
+
+	tests := []struct {
+		name      string
+		readiness config.ReadinessConfig
+		checked   bool
+		want      int
+	}{
+		{"all unready while pending", config.ReadinessConfig{}, false, http.StatusServiceUnavailable},
+		{"all unready with a failing cluster", config.ReadinessConfig{Policy: "all"}, true, http.StatusServiceUnavailable},
+		{"started ignores cluster health", config.ReadinessConfig{Policy: "started"}, false, http.StatusOK},
+		{"min healthy met", config.ReadinessConfig{Policy: "minHealthy", MinHealthyClusters: 1}, true, http.StatusOK},
+		{"min healthy not met", config.ReadinessConfig{Policy: "minHealthy", MinHealthyClusters: 2}, true, http.StatusServiceUnavailable},
+		{"critical cluster healthy", config.ReadinessConfig{Policy: "critical", CriticalClusters: []string{"test-cluster"}}, true, http.StatusOK},
+		{"critical cluster failing", config.ReadinessConfig{Policy: "critical", CriticalClusters: []string{"loki-only-cluster"}}, true, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Health.Readiness = tt.readiness
+			srv := newTestServer(t, cfg)
+			srv.healthChecker = health.NewChecker(health.Config{}, checks)
+			if tt.checked {
+				srv.healthChecker.CheckNow(context.Background())
+			}
+
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	cfg := testConfig()
+	cfg.Health.Readiness = config.ReadinessConfig{Policy: "critical", CriticalClusters: []string{"test-cluster"}}
+	srv := newTestServer(t, cfg)
+
+	var lokiErr error
+	srv.healthChecker = health.NewChecker(health.Config{}, []health.Check{
+		{Cluster: "test-cluster", Backend: "apiserver", Check: func(context.Context) error { return nil }},
+		{Cluster: "test-cluster", Backend: "loki", Check: func(context.Context) error { return lokiErr }},
+	})
+
+	status := func() (bool, string, map[string]string, map[string]map[string]health.Status) {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var resp struct {
+			Ready    bool                                `json:"ready"`
+			Reason   string                              `json:"reason"`
+			Clusters map[string]string                   `json:"clusters"`
+			Backends map[string]map[string]health.Status `json:"backends"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		return resp.Ready, resp.Reason, resp.Clusters, resp.Backends
+	}
+
+	if ready, _, clusters, _ := status(); ready || clusters["test-cluster"] != "apiserver: not checked yet" {
+		t.Errorf("expected pending checks to be reported, got %v %v", ready, clusters)
+	}
+
+	lokiErr = errors.New("no endpoints available")
+	srv.healthChecker.CheckNow(context.Background())
+
+	ready, reason, clusters, backends := status()
+	if ready || reason != "unhealthy clusters: test-cluster" || clusters["test-cluster"] != "loki: no endpoints available" {
+		t.Errorf("expected failing Loki to be reported, got %v %q %v", ready, reason, clusters)
+	}
+	if backends["test-cluster"]["loki"].LastError != "no endpoints available" || backends["test-cluster"]["apiserver"].State != health.OK {
+		t.Errorf("unexpected backend statuses: %+v", backends)
+	}
+
+	lokiErr = nil
+	srv.healthChecker.CheckNow(context.Background())
+
+	if ready, _, clusters, _ := status(); !ready || clusters["test-cluster"] != "ok" {
+		t.Errorf("expected ready, got %v %v", ready, clusters)
+	}
+}
+
 func TestListClusters(t *testing.T) {
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/clusters", nil)
 	w := httptest.NewRecorder()
@@ -139,8 +314,50 @@ func TestListClusters(t *testing.T) {
 	}
 }
 
+func TestListClusters_Circuits(t *testing.T) {
+	srv := newTestServer(t, testConfig())
+
+	b := breaker.New(breaker.Config{Cluster: "test-cluster", Backend: "loki", ConsecutiveFailures: 1})
+	done, _ := b.Allow()
+	done(breaker.Failure)
+
+	client, err := proxy.NewClient(proxy.ClientConfig{
+		K8sClient: fake.NewSimpleClientset(),
+		Namespace: "observability",
+		Service:   "loki-gateway",
+		Port:      80,
+		Breaker:   b,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	srv.lokiClients["test-cluster"] = client
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/clusters", nil)
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	var resp struct {
+		Clusters []struct {
+			Name     string            `json:"name"`
+			Circuits map[string]string `json:"circuits"`
+		} `json:"clusters"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if got := resp.Clusters[0].Circuits["loki"]; got != "open" {
+		t.Errorf("expected open loki circuit for test-cluster, got %q", got)
+	}
+	if resp.Clusters[1].Circuits != nil {
+		t.Errorf("expected no circuits without breakers, got %v", resp.Clusters[1].Circuits)
+	}
+}
+
 func TestListTenants_ClusterNotFound(t *testing.T) {
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/clusters/nonexistent/tenants", nil)
 	w := httptest.NewRecorder()
@@ -153,7 +370,7 @@ func TestListTenants_ClusterNotFound(t *testing.T) {
 }
 
 func TestListTenants_Success(t *testing.T) {
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/clusters/test-cluster/tenants", nil)
 	w := httptest.NewRecorder()
@@ -178,7 +395,7 @@ func TestListTenants_Success(t *testing.T) {
 }
 
 func TestLokiProxy_ClusterNotFound(t *testing.T) {
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/clusters/nonexistent/loki/api/v1/query", nil)
 	w := httptest.NewRecorder()
@@ -209,7 +426,7 @@ func TestLokiProxy_NotConfigured(t *testing.T) {
 			},
 		},
 	}
-	srv := New(cfg, nil, nil)
+	srv := newTestServer(t, cfg)
 
 	req := httptest.NewRequest(http.MethodGet, "/clusters/mimir-only/loki/api/v1/query?query={job=\"test\"}", nil)
 	w := httptest.NewRecorder()
@@ -232,7 +449,7 @@ func TestLokiProxy_NotConfigured(t *testing.T) {
 }
 
 func TestMimirProxy_ClusterNotFound(t *testing.T) {
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/clusters/nonexistent/mimir/api/v1/query", nil)
 	w := httptest.NewRecorder()
@@ -245,7 +462,7 @@ func TestMimirProxy_ClusterNotFound(t *testing.T) {
 }
 
 func TestMimirProxy_NotConfigured(t *testing.T) {
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/clusters/loki-only-cluster/mimir/api/v1/query?query=up", nil)
 	w := httptest.NewRecorder()
@@ -270,7 +487,7 @@ func TestMimirProxy_NotConfigured(t *testing.T) {
 func TestLokiProxy_NoClient(t *testing.T) {
 	// When there's no registry, no Loki clients are created
 	// The Loki router returns 404 when the client is not found
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/clusters/test-cluster/loki/api/v1/query?query={job=\"test\"}", nil)
 	w := httptest.NewRecorder()
@@ -294,7 +511,7 @@ func TestLokiProxy_NoClient(t *testing.T) {
 func TestMimirProxy_NoClient(t *testing.T) {
 	// When there's no registry, no Mimir clients are created
 	// The Mimir router returns 404 when the client is not found
-	srv := New(testConfig(), nil, nil)
+	srv := newTestServer(t, testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/clusters/test-cluster/mimir/api/v1/query?query=up", nil)
 	w := httptest.NewRecorder()
@@ -314,3 +531,153 @@ func TestMimirProxy_NoClient(t *testing.T) {
 		t.Errorf("unexpected error message: %s", resp["error"])
 	}
 }
+
+func TestSlowQueries(t *testing.T) {
+	cfg := testConfig()
+	cfg.SlowQueries = config.SlowQueriesConfig{
+		Enabled:     true,
+		MinDuration: time.Second,
+		BufferSize:  10,
+		Groups:      []string{"sre"},
+	}
+	srv := newTestServer(t, cfg)
+
+	srv.slowQueries.Add(slowquery.Record{Identity: "grafana", Cluster: "test-cluster", Backend: "mimir", Query: `sum(rate(x[5m]))`, DurationMS: 2000})
+	srv.slowQueries.Add(slowquery.Record{Identity: "grafana", Cluster: "test-cluster", Backend: "mimir", Query: `sum(rate(x[1h]))`, DurationMS: 3000})
+	srv.slowQueries.Add(slowquery.Record{Identity: "alice", Cluster: "loki-only-cluster", Backend: "loki", Query: `{app="a"}`, DurationMS: 1000})
+
+	get := func(path string, identity middleware.Identity) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(middleware.WithIdentity(req.Context(), identity))
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	sre := middleware.Identity{Name: "bob", Groups: []string{"sre"}}
+
+	// Callers outside the configured groups are rejected
+	if w := get("/api/v1/admin/slow-queries", middleware.Identity{Name: "grafana"}); w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", w.Code)
+	}
+
+	w := get("/api/v1/admin/slow-queries?cluster=test-cluster&limit=1", sre)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var list struct {
+		Queries []slowquery.Record `json:"queries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(list.Queries) != 1 || list.Queries[0].Query != `sum(rate(x[1h]))` {
+		t.Errorf("expected the newest test-cluster query, got %+v", list.Queries)
+	}
+
+	w = get("/api/v1/admin/slow-queries/summary?caller=grafana", sre)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var summary struct {
+		Summary []slowquery.Summary `json:"summary"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(summary.Summary) != 1 || summary.Summary[0].Count != 2 || summary.Summary[0].TotalDurationMS != 5000 {
+		t.Errorf("expected both grafana queries grouped, got %+v", summary.Summary)
+	}
+
+	if w := get("/api/v1/admin/slow-queries?limit=x", sre); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestSlowQueries_NoAllowlist(t *testing.T) {
+	cfg := testConfig()
+	cfg.SlowQueries = config.SlowQueriesConfig{
+		Enabled:     true,
+		MinDuration: time.Second,
+		BufferSize:  10,
+	}
+	srv := newTestServer(t, cfg)
+
+	for _, path := range []string{"/api/v1/admin/slow-queries", "/api/v1/admin/slow-queries/summary"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{Name: "grafana", Groups: []string{"sre"}}))
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestListProbes(t *testing.T) {
+	cfg := testConfig()
+	cfg.Probes = config.ProbesConfig{
+		Enabled: true,
+		Queries: []config.ProbeConfig{
+			{Name: "mimir-vector", Cluster: "test-cluster", Backend: "mimir", Query: "vector(1)"},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	// Without a registry there is no Mimir client, so the probe fails in the router
+	srv.prober.RunNow(context.Background())
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/probes", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp struct {
+		Probes []prober.Result `json:"probes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp.Probes) != 1 {
+		t.Fatalf("expected 1 probe, got %d", len(resp.Probes))
+	}
+	if p := resp.Probes[0]; p.Success || p.LastRun.IsZero() || !strings.Contains(p.Error, "status 404") {
+		t.Errorf("expected failed probe, got %+v", p)
+	}
+}
+
+func TestProbes_Middleware(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := testConfig()
+	cfg.Auth = config.AuthConfig{Enabled: true, BearerTokens: []string{"secret"}}
+	cfg.Audit = config.AuditConfig{Enabled: true, File: &config.AuditFileConfig{Path: auditPath}}
+	cfg.Probes = config.ProbesConfig{
+		Enabled: true,
+		Queries: []config.ProbeConfig{
+			{Name: "loki-streams", Cluster: "test-cluster", Backend: "loki", Query: `{app="api"}`},
+		},
+	}
+	srv := newTestServer(t, cfg)
+
+	srv.prober.RunNow(context.Background())
+	if err := srv.auditLogger.Close(); err != nil {
+		t.Fatalf("failed to close audit logger: %v", err)
+	}
+
+	// Probes skip authentication, and reach the Loki query route
+	if p := srv.prober.Results()[0]; !strings.Contains(p.Error, "status 404") {
+		t.Errorf("expected probe to reach the router, got %+v", p)
+	}
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("failed to read audit file: %v", err)
+	}
+	var event audit.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("failed to decode audit event %q: %v", data, err)
+	}
+	if event.Identity != prober.Identity || event.Path != "/clusters/test-cluster/loki/api/v1/query_range" {
+		t.Errorf("unexpected audit event: %+v", event)
+	}
+}
@@ -0,0 +1,260 @@
+// Package slowquery records federated queries that exceed a duration or
+// response size threshold, so that expensive dashboards can be found.
+package slowquery
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// Record describes a single slow query.
+type Record struct {
+	Timestamp  time.Time `json:"timestamp"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Identity   string    `json:"identity"`
+	Backend    string    `json:"backend,omitempty"`
+	Cluster    string    `json:"cluster,omitempty"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Tenants    int       `json:"tenants"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"durationMs"`
+}
+
+// Config holds configuration for creating a slow query log.
+type Config struct {
+	// MinDuration is the duration from which a query is recorded. Zero
+	// disables the duration threshold.
+	MinDuration time.Duration
+	// MinBytes is the response size from which a query is recorded. Zero
+	// disables the size threshold.
+	MinBytes int64
+	// Size is the number of records kept in memory. Defaults to 1000.
+	Size int
+}
+
+// Log keeps the most recent slow queries in a bounded ring buffer and writes
+// each of them to a dedicated log stream.
+type Log struct {
+	minDuration time.Duration
+	minBytes    int64
+	logger      zerolog.Logger
+
+	mu      sync.Mutex
+	records []Record
+	next    int
+	full    bool
+}
+
+// New creates a slow query log.
+func New(cfg Config) *Log {
+	if cfg.Size <= 0 {
+		cfg.Size = 1000
+	}
+	return &Log{
+		minDuration: cfg.MinDuration,
+		minBytes:    cfg.MinBytes,
+		logger:      log.With().Str("stream", "slow_queries").Logger(),
+		records:     make([]Record, cfg.Size),
+	}
+}
+
+// IsSlow reports whether a query with the given duration and response size
+// exceeds one of the thresholds.
+func (l *Log) IsSlow(duration time.Duration, bytes int64) bool {
+	if l == nil {
+		return false
+	}
+	return (l.minDuration > 0 && duration >= l.minDuration) ||
+		(l.minBytes > 0 && bytes >= l.minBytes)
+}
+
+// Add records a slow query, evicting the oldest record if the buffer is full.
+func (l *Log) Add(r Record) {
+	l.mu.Lock()
+	l.records[l.next] = r
+	l.next = (l.next + 1) % len(l.records)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.mu.Unlock()
+
+	metrics.SlowQueriesTotal.WithLabelValues(r.Cluster, r.Backend).Inc()
+
+	l.logger.Warn().
+		Time("timestamp", r.Timestamp).
+		Str("request_id", r.RequestID).
+		Str("identity", r.Identity).
+		Str("backend", r.Backend).
+		Str("cluster", r.Cluster).
+		Str("path", r.Path).
+		Str("query", r.Query).
+		Int("tenants", r.Tenants).
+		Int("status", r.Status).
+		Int64("bytes", r.Bytes).
+		Float64("duration_ms", r.DurationMS).
+		Msg("slow query")
+}
+
+// Filter selects records. Empty fields match any record.
+type Filter struct {
+	Cluster  string
+	Identity string
+}
+
+func (f Filter) matches(r Record) bool {
+	return (f.Cluster == "" || r.Cluster == f.Cluster) &&
+		(f.Identity == "" || r.Identity == f.Identity)
+}
+
+// List returns the records matching the filter, newest first.
+func (l *Log) List(f Filter) []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.records)
+	}
+
+	records := make([]Record, 0, n)
+	for i := 1; i <= n; i++ {
+		r := l.records[(l.next-i+len(l.records))%len(l.records)]
+		if f.matches(r) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// Summary aggregates the slow queries sharing a normalized query.
+type Summary struct {
+	Query           string   `json:"query"`
+	Backend         string   `json:"backend,omitempty"`
+	Count           int      `json:"count"`
+	TotalDurationMS float64  `json:"totalDurationMs"`
+	MaxDurationMS   float64  `json:"maxDurationMs"`
+	TotalBytes      int64    `json:"totalBytes"`
+	Clusters        []string `json:"clusters"`
+	Identities      []string `json:"identities"`
+}
+
+// Top returns the n normalized queries matching the filter with the highest
+// total duration. All of them are returned if n is not positive.
+func (l *Log) Top(f Filter, n int) []Summary {
+	groups := make(map[[2]string]*Summary)
+	clusters := make(map[[2]string]map[string]struct{})
+	identities := make(map[[2]string]map[string]struct{})
+
+	for _, r := range l.List(f) {
+		key := [2]string{r.Backend, Normalize(r.Query)}
+		s, ok := groups[key]
+		if !ok {
+			s = &Summary{Query: key[1], Backend: r.Backend}
+			groups[key] = s
+			clusters[key] = make(map[string]struct{})
+			identities[key] = make(map[string]struct{})
+		}
+		s.Count++
+		s.TotalDurationMS += r.DurationMS
+		s.MaxDurationMS = max(s.MaxDurationMS, r.DurationMS)
+		s.TotalBytes += r.Bytes
+		clusters[key][r.Cluster] = struct{}{}
+		identities[key][r.Identity] = struct{}{}
+	}
+
+	summaries := make([]Summary, 0, len(groups))
+	for key, s := range groups {
+		s.Clusters = sortedKeys(clusters[key])
+		s.Identities = sortedKeys(identities[key])
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].TotalDurationMS != summaries[j].TotalDurationMS {
+			return summaries[i].TotalDurationMS > summaries[j].TotalDurationMS
+		}
+		return summaries[i].Query < summaries[j].Query
+	})
+
+	if n > 0 && len(summaries) > n {
+		summaries = summaries[:n]
+	}
+	return summaries
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Normalize reduces a LogQL or PromQL query to its shape, so that queries
+// differing only in literal values are grouped together. String literals,
+// numbers and durations are replaced by "?" and whitespace is collapsed.
+func Normalize(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	space := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			i++
+			continue
+		case c == '"' || c == '\'' || c == '`':
+			i = skipString(query, i)
+			c = '?'
+		case isDigit(c) && (i == 0 || !isIdentChar(query[i-1])):
+			// Numbers and durations such as 5m, 1.5 or 1e3
+			for i < len(query) && (isIdentChar(query[i]) || query[i] == '.') {
+				i++
+			}
+			c = '?'
+		default:
+			i++
+		}
+
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// skipString returns the index just past the string literal starting at i.
+// Backquoted strings have no escapes.
+func skipString(s string, i int) int {
+	quote := s[i]
+	for i++; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote != '`':
+			i++
+		case s[i] == quote:
+			return i + 1
+		}
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == ':' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,99 @@
+package slowquery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLog_IsSlow(t *testing.T) {
+	l := New(Config{MinDuration: time.Second, MinBytes: 1000})
+
+	tests := []struct {
+		duration time.Duration
+		bytes    int64
+		want     bool
+	}{
+		{100 * time.Millisecond, 10, false},
+		{time.Second, 10, true},
+		{100 * time.Millisecond, 1000, true},
+	}
+	for _, tt := range tests {
+		if got := l.IsSlow(tt.duration, tt.bytes); got != tt.want {
+			t.Errorf("IsSlow(%s, %d) = %v, want %v", tt.duration, tt.bytes, got, tt.want)
+		}
+	}
+
+	// A zero threshold is disabled
+	if New(Config{MinDuration: time.Second}).IsSlow(0, 1<<30) {
+		t.Error("expected size threshold to be disabled")
+	}
+}
+
+func TestLog_List(t *testing.T) {
+	l := New(Config{Size: 3})
+
+	for i, r := range []Record{
+		{Path: "1", Cluster: "a", Identity: "alice"},
+		{Path: "2", Cluster: "b", Identity: "alice"},
+		{Path: "3", Cluster: "a", Identity: "bob"},
+		{Path: "4", Cluster: "a", Identity: "alice"},
+	} {
+		l.Add(r)
+		if got := len(l.List(Filter{})); got != min(i+1, 3) {
+			t.Errorf("after %d records, expected %d listed, got %d", i+1, min(i+1, 3), got)
+		}
+	}
+
+	// The oldest record is evicted and the newest comes first
+	records := l.List(Filter{})
+	if records[0].Path != "4" || records[2].Path != "2" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+
+	records = l.List(Filter{Cluster: "a", Identity: "alice"})
+	if len(records) != 1 || records[0].Path != "4" {
+		t.Errorf("unexpected filtered records: %+v", records)
+	}
+}
+
+func TestLog_Top(t *testing.T) {
+	l := New(Config{})
+	l.Add(Record{Backend: "mimir", Cluster: "a", Identity: "alice", Query: `rate(x{job="a"}[5m])`, DurationMS: 100, Bytes: 10})
+	l.Add(Record{Backend: "mimir", Cluster: "b", Identity: "bob", Query: `rate(x{job="b"}[1h])`, DurationMS: 300, Bytes: 20})
+	l.Add(Record{Backend: "loki", Cluster: "a", Identity: "alice", Query: `{app="a"}`, DurationMS: 250})
+
+	top := l.Top(Filter{}, 0)
+	if len(top) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", top)
+	}
+	if top[0].Query != `rate(x{job=?}[?])` || top[0].Count != 2 || top[0].TotalDurationMS != 400 || top[0].MaxDurationMS != 300 || top[0].TotalBytes != 30 {
+		t.Errorf("unexpected first group: %+v", top[0])
+	}
+	if len(top[0].Clusters) != 2 || len(top[0].Identities) != 2 {
+		t.Errorf("expected clusters and identities of both queries, got %+v", top[0])
+	}
+
+	if top := l.Top(Filter{}, 1); len(top) != 1 {
+		t.Errorf("expected 1 group, got %d", len(top))
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`up`, `up`},
+		{`sum(rate(http_requests_total{code="500"}[5m])) > 0.5`, `sum(rate(http_requests_total{code=?}[?])) > ?`},
+		{"rate(x[5m:30s])  offset 1h", `rate(x[?]) offset ?`},
+		{`{app="api"} |= "error \"x\"" | json | latency > 1.5s`, `{app=?} |= ? | json | latency > ?`},
+		{"{app=`a`}\n  |~ `b`", `{app=?} |~ ?`},
+		{`histogram_quantile(0.99, x_bucket)`, `histogram_quantile(?, x_bucket)`},
+		{`node_cpu_seconds_total`, `node_cpu_seconds_total`},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.query); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+// Tenant sources.
+const (
+	// SourceNamespaces takes tenants from namespaces only.
+	SourceNamespaces = "namespaces"
+	// SourceBackends takes tenants from the backends only, without watching
+	// namespaces.
+	SourceBackends = "backends"
+	// SourceUnion takes the tenants of namespaces and the tenants that have
+	// data in the backends.
+	SourceUnion = "union"
+	// SourceIntersection takes the tenants of namespaces that have data in
+	// the backends.
+	SourceIntersection = "intersection"
+)
+
+const defaultBackendInterval = 5 * time.Minute
+
+// BackendSource lists the tenants that have data in a backend.
+type BackendSource struct {
+	// Backend is "loki" or "mimir".
+	Backend string
+	List    func(ctx context.Context) ([]string, error)
+}
+
+// ParseTenants parses a tenant listing: a JSON array of tenant IDs, or of
+// objects with a "userID" or "tenant" field, such as the response of Mimir's
+// /distributor/all_user_stats.
+func ParseTenants(body []byte) ([]string, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, fmt.Errorf("invalid tenant listing: %w", err)
+	}
+
+	tenants := make([]string, 0, len(items))
+	for _, item := range items {
+		var tenant string
+		if err := json.Unmarshal(item, &tenant); err != nil {
+			var entry struct {
+				UserID string `json:"userID"`
+				Tenant string `json:"tenant"`
+			}
+			if err := json.Unmarshal(item, &entry); err != nil {
+				return nil, fmt.Errorf("invalid tenant listing entry %s", item)
+			}
+			tenant = entry.UserID
+			if tenant == "" {
+				tenant = entry.Tenant
+			}
+		}
+		if tenant != "" {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants, nil
+}
+
+// SetBackendSources sets the backends listing the tenants of the watcher's
+// cluster. It must be called before Start.
+func (w *Watcher) SetBackendSources(sources []BackendSource) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.backendSources = sources
+}
+
+// pollBackends lists the tenants of the backends immediately and then on
+// every backend interval, until the watcher stops.
+func (w *Watcher) pollBackends(ctx context.Context) {
+	ticker := time.NewTicker(w.backendInterval)
+	defer ticker.Stop()
+
+	for {
+		w.refreshBackends(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-w.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshBackends lists the tenants of every backend, and refreshes the
+// tenant list if any backend answered. A failing backend keeps its previous
+// tenants.
+func (w *Watcher) refreshBackends(ctx context.Context) {
+	w.mu.RLock()
+	sources := w.backendSources
+	w.mu.RUnlock()
+
+	var listed bool
+	for _, source := range sources {
+		tenants, err := source.List(ctx)
+		if err != nil {
+			w.recordError(fmt.Errorf("%s: %w", source.Backend, err))
+			log.Warn().Err(err).
+				Str("cluster", w.clusterName).
+				Str("backend", source.Backend).
+				Msg("failed to list tenants of backend")
+			continue
+		}
+
+		slices.Sort(tenants)
+		w.mu.Lock()
+		w.backendTenants[source.Backend] = slices.Compact(tenants)
+		w.mu.Unlock()
+		listed = true
+	}
+	if !listed {
+		return
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	w.status.LastBackendRefresh = now
+	if w.source == SourceBackends && !w.status.Synced {
+		w.status.Synced = true
+		w.status.LastSync = now
+		metrics.TenantWatcherSynced.WithLabelValues(w.clusterName).Set(1)
+	}
+	synced := w.status.Synced
+	w.mu.Unlock()
+
+	// Namespace tenants are incomplete until the namespace cache syncs
+	if synced {
+		w.refreshTenants()
+	}
+}
+
+// combine combines the sorted tenants of namespaces with the tenants that
+// have data in the backends, according to the source of the watcher. It must
+// be called with w.mu held.
+func (w *Watcher) combine(namespaceTenants []string) []string {
+	if w.source == SourceNamespaces {
+		return namespaceTenants
+	}
+
+	var backendTenants []string
+	for _, tenants := range w.backendTenants {
+		backendTenants = append(backendTenants, tenants...)
+	}
+	slices.Sort(backendTenants)
+	backendTenants = slices.Compact(backendTenants)
+
+	switch w.source {
+	case SourceBackends:
+		return backendTenants
+	case SourceUnion:
+		tenants := append(slices.Clone(namespaceTenants), backendTenants...)
+		slices.Sort(tenants)
+		return slices.Compact(tenants)
+	default:
+		// Until the backends have answered, all namespace tenants are kept
+		if len(w.backendTenants) == 0 {
+			return namespaceTenants
+		}
+		return slices.DeleteFunc(slices.Clone(namespaceTenants), func(t string) bool {
+			_, found := slices.BinarySearch(backendTenants, t)
+			return !found
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseTenants(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "tenant IDs", body: `["payments", "checkout"]`, want: []string{"payments", "checkout"}},
+		{
+			name: "mimir user stats",
+			body: `[{"userID":"payments","ingestionRate":12.5,"numSeries":1000},{"userID":"checkout","numSeries":10}]`,
+			want: []string{"payments", "checkout"},
+		},
+		{name: "tenant objects", body: `[{"tenant":"payments"}]`, want: []string{"payments"}},
+		{name: "empty", body: `[]`, want: []string{}},
+		{name: "not a list", body: `{"tenants":["payments"]}`, wantErr: true},
+		{name: "invalid entry", body: `[42]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTenants([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTenants() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("ParseTenants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcher_BackendSources(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{source: SourceNamespaces, want: []string{"checkout", "payments"}},
+		{source: SourceBackends, want: []string{"payments", "shared"}},
+		{source: SourceUnion, want: []string{"checkout", "payments", "shared"}},
+		{source: SourceIntersection, want: []string{"payments"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			w, err := NewWatcher(WatcherConfig{
+				ClusterName: "test",
+				Client:      fake.NewSimpleClientset(),
+				Source:      tt.source,
+			})
+			if err != nil {
+				t.Fatalf("failed to create watcher: %v", err)
+			}
+
+			var lokiErr error
+			w.SetBackendSources([]BackendSource{
+				{Backend: "mimir", List: func(context.Context) ([]string, error) { return []string{"shared", "payments"}, nil }},
+				{Backend: "loki", List: func(context.Context) ([]string, error) { return []string{"payments"}, lokiErr }},
+			})
+
+			indexer := w.informerFactory.Core().V1().Namespaces().Informer().GetIndexer()
+			indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}})
+			indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "checkout"}})
+			if tt.source != SourceBackends {
+				w.status.Synced = true
+			}
+
+			w.refreshTenants()
+			w.refreshBackends(context.Background())
+			if got := w.Tenants(); !slices.Equal(got, tt.want) {
+				t.Errorf("expected tenants %v, got %v", tt.want, got)
+			}
+
+			// A failing backend keeps its previous tenants
+			lokiErr = errors.New("connection refused")
+			w.refreshBackends(context.Background())
+			if got := w.Tenants(); !slices.Equal(got, tt.want) {
+				t.Errorf("expected tenants %v after a failed listing, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWatcher_BackendSources_Retention(t *testing.T) {
+	w, err := NewWatcher(WatcherConfig{
+		ClusterName: "test",
+		Client:      fake.NewSimpleClientset(),
+		Source:      SourceIntersection,
+		Retention:   24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	backendTenants := []string{"checkout", "payments"}
+	w.SetBackendSources([]BackendSource{
+		{Backend: "loki", List: func(context.Context) ([]string, error) { return backendTenants, nil }},
+	})
+
+	indexer := w.informerFactory.Core().V1().Namespaces().Informer().GetIndexer()
+	indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}})
+	indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "checkout"}})
+	w.status.Synced = true
+	w.refreshBackends(context.Background())
+
+	// A tenant without data in the backends is dropped, although its
+	// namespace still exists
+	backendTenants = []string{"payments"}
+	w.refreshBackends(context.Background())
+	if got := w.Tenants(); !slices.Equal(got, []string{"payments"}) {
+		t.Errorf("expected tenants [payments], got %v", got)
+	}
+	if retained := w.Status().Retained; len(retained) != 0 {
+		t.Errorf("expected no retained tenants, got %v", retained)
+	}
+
+	// The tenant of a deleted namespace is retained while it has data
+	backendTenants = []string{"checkout", "payments"}
+	indexer.Delete(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "checkout"}})
+	w.refreshBackends(context.Background())
+	if got := w.Tenants(); !slices.Equal(got, []string{"checkout", "payments"}) {
+		t.Errorf("expected checkout to be retained, got %v", got)
+	}
+	if _, ok := w.Status().Retained["checkout"]; !ok {
+		t.Errorf("expected checkout in retained tenants, got %v", w.Status().Retained)
+	}
+}
+
+func TestWatcher_BackendSources_Start(t *testing.T) {
+	// Namespaces are not listed, so listing them may be forbidden
+	w, err := NewWatcher(WatcherConfig{
+		ClusterName: "test",
+		Client:      fake.NewSimpleClientset(),
+		Source:      SourceBackends,
+		RequireSync: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	w.SetBackendSources([]BackendSource{
+		{Backend: "mimir", List: func(context.Context) ([]string, error) { return []string{"payments"}, nil }},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.StartAsync(ctx)
+
+	waitFor(t, w.HasSynced)
+	if got := w.Tenants(); !slices.Equal(got, []string{"payments"}) {
+		t.Errorf("expected tenants [payments], got %v", got)
+	}
+	if status := w.Status(); status.LastBackendRefresh.IsZero() {
+		t.Errorf("expected a backend refresh, got %+v", status)
+	}
+	if err := w.CheckSynced(); err != nil {
+		t.Errorf("expected no error after backend refresh, got %v", err)
+	}
+
+	w.Stop()
+}
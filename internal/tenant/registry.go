@@ -31,13 +31,27 @@ func NewRegistry(ctx context.Context, clusterRegistry *cluster.Registry, configs
 			continue
 		}
 
+		var store RetentionStore
+		if cfg.Tenants.RetentionFile != "" {
+			store = NewFileStore(cfg.Tenants.RetentionFile)
+		}
+
 		// Create watcher
 		watcher, err := NewWatcher(WatcherConfig{
-			ClusterName:     cfg.Name,
-			Client:          c.Client,
-			IncludePatterns: cfg.Tenants.IncludePatterns,
-			ExcludePatterns: cfg.Tenants.ExcludePatterns,
-			RefreshInterval: cfg.Tenants.RefreshInterval,
+			ClusterName:      cfg.Name,
+			Client:           c.Client,
+			IncludePatterns:  cfg.Tenants.IncludePatterns,
+			ExcludePatterns:  cfg.Tenants.ExcludePatterns,
+			LabelSelector:    cfg.Tenants.LabelSelector,
+			TenantAnnotation: cfg.Tenants.TenantAnnotation,
+			TenantLabel:      cfg.Tenants.TenantLabel,
+			RefreshInterval:  cfg.Tenants.RefreshInterval,
+			SyncTimeout:      cfg.Tenants.SyncTimeout,
+			RequireSync:      cfg.Tenants.RequireSync,
+			Retention:        cfg.Tenants.Retention,
+			RetentionStore:   store,
+			Source:           cfg.Tenants.Source,
+			BackendInterval:  cfg.Tenants.Backends.Interval,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create tenant watcher for cluster %s: %w", cfg.Name, err)
@@ -108,6 +122,55 @@ func (r *Registry) BuildOrgIDHeader(clusterName string, maxLength int) string {
 	return w.BuildOrgIDHeader(maxLength)
 }
 
+// SetBackendSources sets the backends listing the tenants of a cluster. It
+// must be called before Start.
+func (r *Registry) SetBackendSources(clusterName string, sources []BackendSource) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if w, ok := r.watchers[clusterName]; ok {
+		w.SetBackendSources(sources)
+	}
+}
+
+// Status returns the state of the tenant watcher of a cluster.
+func (r *Registry) Status(clusterName string) (Status, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	w, ok := r.watchers[clusterName]
+	if !ok {
+		return Status{}, false
+	}
+	return w.Status(), true
+}
+
+// CheckSynced returns an error if queries to a cluster must wait for its
+// tenants to sync.
+func (r *Registry) CheckSynced(clusterName string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	w, ok := r.watchers[clusterName]
+	if !ok {
+		return nil
+	}
+	return w.CheckSynced()
+}
+
+// OnChange registers a function called whenever the tenant list of any
+// cluster changes.
+func (r *Registry) OnChange(fn func(clusterName string, tenants []string)) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for name, watcher := range r.watchers {
+		watcher.OnChange(func(tenants []string) {
+			fn(name, tenants)
+		})
+	}
+}
+
 // List returns all cluster names with tenant watchers.
 func (r *Registry) List() []string {
 	r.mu.RLock()
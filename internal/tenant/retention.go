@@ -0,0 +1,82 @@
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RetentionState is the state of a tenant watcher that must survive
+// restarts to keep the tenants of deleted namespaces.
+type RetentionState struct {
+	// Tenants are the tenants of existing namespaces, so that namespaces
+	// deleted while the proxy was down are noticed.
+	Tenants []string `json:"tenants"`
+	// Deleted maps the tenants of deleted namespaces to their deletion time.
+	Deleted map[string]time.Time `json:"deleted"`
+}
+
+// RetentionStore persists the retention state of a tenant watcher.
+type RetentionStore interface {
+	// Load returns the saved state, or an empty state if none was saved.
+	Load() (RetentionState, error)
+	Save(state RetentionState) error
+}
+
+// FileStore is a RetentionStore keeping the state in a local JSON file.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore creates a store writing to path. The directory must exist.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load reads the state from the file.
+func (s *FileStore) Load() (RetentionState, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return RetentionState{}, nil
+	}
+	if err != nil {
+		return RetentionState{}, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+
+	var state RetentionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return RetentionState{}, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	return state, nil
+}
+
+// Save replaces the file atomically, so that a crash leaves either the old
+// or the new state.
+func (s *FileStore) Save(state RetentionState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", s.path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save %s: %w", s.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save %s: %w", s.path, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save %s: %w", s.path, err)
+	}
+	return nil
+}
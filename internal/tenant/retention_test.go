@@ -0,0 +1,45 @@
+package tenant
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "tenants.json"))
+
+	// A missing file is an empty state
+	state, err := store.Load()
+	if err != nil {
+		t.Fatalf("failed to load missing file: %v", err)
+	}
+	if len(state.Tenants) != 0 || len(state.Deleted) != 0 {
+		t.Errorf("expected empty state, got %+v", state)
+	}
+
+	deletedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := store.Save(RetentionState{Tenants: []string{"payments"}, Deleted: map[string]time.Time{"checkout": deletedAt}}); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	state, err = store.Load()
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	if len(state.Tenants) != 1 || state.Tenants[0] != "payments" || !state.Deleted["checkout"].Equal(deletedAt) {
+		t.Errorf("unexpected state: %+v", state)
+	}
+}
+
+func TestFileStore_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if _, err := NewFileStore(path).Load(); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+}
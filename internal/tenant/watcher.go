@@ -3,7 +3,9 @@ package tenant
 import (
 	"context"
 	"fmt"
+	"maps"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -17,22 +19,74 @@ import (
 	"k8s.io/client-go/kubernetes"
 	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+
+	"github.com/tjorri/observability-federation-proxy/internal/metrics"
+)
+
+const (
+	defaultSyncTimeout    = time.Minute
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
 )
 
+// Status describes the state of a tenant watcher.
+type Status struct {
+	// Synced is true while the namespace cache is synced.
+	Synced bool `json:"synced"`
+	// LastSync is when the namespace cache last completed its initial sync.
+	LastSync time.Time `json:"lastSync,omitzero"`
+	// LastRefresh is when the tenant list was last rebuilt.
+	LastRefresh time.Time `json:"lastRefresh,omitzero"`
+	// LastError is the latest error listing or watching namespaces.
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime,omitzero"`
+	// Restarts counts the restarts after a failed sync.
+	Restarts       int `json:"restarts"`
+	TenantsAdded   int `json:"tenantsAdded"`
+	TenantsRemoved int `json:"tenantsRemoved"`
+	// Retained maps the tenants of deleted namespaces, which are kept for
+	// the retention period, to their deletion time.
+	Retained map[string]time.Time `json:"retained,omitempty"`
+	// LastBackendRefresh is when the backends last listed their tenants.
+	LastBackendRefresh time.Time `json:"lastBackendRefresh,omitzero"`
+}
+
 // Watcher watches Kubernetes namespaces and maintains a cached list of tenants.
 type Watcher struct {
-	clusterName     string
-	client          kubernetes.Interface
-	includePatterns []*regexp.Regexp
-	excludePatterns []*regexp.Regexp
-	refreshInterval time.Duration
-
+	clusterName      string
+	client           kubernetes.Interface
+	includePatterns  []*regexp.Regexp
+	excludePatterns  []*regexp.Regexp
+	labelSelector    string
+	tenantLabel      string
+	tenantAnnotation string
+	refreshInterval  time.Duration
+	syncTimeout      time.Duration
+	requireSync      bool
+	initialBackoff   time.Duration
+	maxBackoff       time.Duration
+
+	// The informer is replaced on every restart
 	informerFactory informers.SharedInformerFactory
 	namespaceLister corev1listers.NamespaceLister
 	hasSynced       cache.InformerSynced
 
-	tenants []string
-	mu      sync.RWMutex
+	tenants   []string
+	listeners []func(tenants []string)
+	status    Status
+	mu        sync.RWMutex
+
+	// Tenants of deleted namespaces are kept for the retention period
+	retention time.Duration
+	store     RetentionStore
+	live      []string
+	deleted   map[string]time.Time
+
+	// Tenants that have data in the backends, by backend
+	source          string
+	backendSources  []BackendSource
+	backendInterval time.Duration
+	backendTenants  map[string][]string
 
 	stopCh chan struct{}
 }
@@ -43,7 +97,33 @@ type WatcherConfig struct {
 	Client          kubernetes.Interface
 	IncludePatterns []string
 	ExcludePatterns []string
-	RefreshInterval time.Duration
+	// LabelSelector restricts the watched namespaces on the API server, for
+	// example "observability.example.com/enabled=true".
+	LabelSelector string
+	// TenantAnnotation and TenantLabel name the namespace annotation or
+	// label holding the tenant ID. The annotation takes precedence over the
+	// label, and the namespace name is used if neither is set.
+	TenantAnnotation string
+	TenantLabel      string
+	RefreshInterval  time.Duration
+	// SyncTimeout bounds the initial sync of the namespace cache before the
+	// watcher restarts. Defaults to 1m.
+	SyncTimeout time.Duration
+	// RequireSync makes CheckSynced fail until the namespace cache has
+	// synced once.
+	RequireSync bool
+	// Retention keeps the tenants of deleted namespaces for this long, so
+	// that their data can still be queried. Zero drops them immediately.
+	Retention time.Duration
+	// RetentionStore persists deletion times across restarts. If nil, they
+	// are kept in memory only.
+	RetentionStore RetentionStore
+	// Source is one of the Source constants. Defaults to SourceNamespaces.
+	// Other sources need backends set with SetBackendSources.
+	Source string
+	// BackendInterval is the interval between two listings of the tenants
+	// of the backends. Defaults to 5m.
+	BackendInterval time.Duration
 }
 
 // NewWatcher creates a new tenant watcher.
@@ -80,30 +160,92 @@ func NewWatcher(cfg WatcherConfig) (*Watcher, error) {
 		excludePatterns = append(excludePatterns, re)
 	}
 
-	// Create informer factory with resync period
-	informerFactory := informers.NewSharedInformerFactory(cfg.Client, refreshInterval)
-	namespaceInformer := informerFactory.Core().V1().Namespaces()
+	if _, err := labels.Parse(cfg.LabelSelector); err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", cfg.LabelSelector, err)
+	}
+
+	source := cfg.Source
+	switch source {
+	case "":
+		source = SourceNamespaces
+	case SourceNamespaces, SourceBackends, SourceUnion, SourceIntersection:
+	default:
+		return nil, fmt.Errorf("unknown tenant source %q", source)
+	}
+
+	backendInterval := cfg.BackendInterval
+	if backendInterval <= 0 {
+		backendInterval = defaultBackendInterval
+	}
+
+	syncTimeout := cfg.SyncTimeout
+	if syncTimeout <= 0 {
+		syncTimeout = defaultSyncTimeout
+	}
 
 	w := &Watcher{
-		clusterName:     cfg.ClusterName,
-		client:          cfg.Client,
-		includePatterns: includePatterns,
-		excludePatterns: excludePatterns,
-		refreshInterval: refreshInterval,
-		informerFactory: informerFactory,
-		namespaceLister: namespaceInformer.Lister(),
-		hasSynced:       namespaceInformer.Informer().HasSynced,
-		tenants:         []string{},
-		stopCh:          make(chan struct{}),
+		clusterName:      cfg.ClusterName,
+		client:           cfg.Client,
+		includePatterns:  includePatterns,
+		excludePatterns:  excludePatterns,
+		labelSelector:    cfg.LabelSelector,
+		tenantLabel:      cfg.TenantLabel,
+		tenantAnnotation: cfg.TenantAnnotation,
+		refreshInterval:  refreshInterval,
+		syncTimeout:      syncTimeout,
+		requireSync:      cfg.RequireSync,
+		initialBackoff:   defaultInitialBackoff,
+		maxBackoff:       defaultMaxBackoff,
+		tenants:          []string{},
+		retention:        cfg.Retention,
+		deleted:          make(map[string]time.Time),
+		source:           source,
+		backendInterval:  backendInterval,
+		backendTenants:   make(map[string][]string),
+		stopCh:           make(chan struct{}),
 	}
 
+	if cfg.Retention > 0 && cfg.RetentionStore != nil {
+		state, err := cfg.RetentionStore.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load retention state: %w", err)
+		}
+		w.store = cfg.RetentionStore
+		w.live = slices.Sorted(slices.Values(state.Tenants))
+		maps.Copy(w.deleted, state.Deleted)
+	}
+
+	w.newInformer()
+
+	return w, nil
+}
+
+// newInformer creates the namespace informer for the next run of the
+// watcher.
+func (w *Watcher) newInformer() {
+	// Create informer factory with resync period, filtering namespaces on
+	// the API server
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(w.client, w.refreshInterval,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = w.labelSelector
+		}))
+	namespaceInformer := informerFactory.Core().V1().Namespaces()
+
+	// Record list and watch errors, which the informer otherwise only logs
+	// while it retries
+	_ = namespaceInformer.Informer().SetWatchErrorHandlerWithContext(func(ctx context.Context, r *cache.Reflector, err error) {
+		w.recordError(err)
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+	})
+
 	// Add event handlers
 	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(_ interface{}) {
 			w.onNamespaceChange()
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			// Only refresh if namespace name changed (unlikely but possible via replace)
+			// Only refresh if the tenant of the namespace changed, through
+			// its name, labels or annotations
 			oldNs, ok := oldObj.(*corev1.Namespace)
 			if !ok {
 				return
@@ -112,7 +254,7 @@ func NewWatcher(cfg WatcherConfig) (*Watcher, error) {
 			if !ok {
 				return
 			}
-			if oldNs.Name != newNs.Name {
+			if w.tenantOf(oldNs) != w.tenantOf(newNs) {
 				w.onNamespaceChange()
 			}
 		},
@@ -121,39 +263,138 @@ func NewWatcher(cfg WatcherConfig) (*Watcher, error) {
 		},
 	})
 
-	return w, nil
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.informerFactory = informerFactory
+	w.namespaceLister = namespaceInformer.Lister()
+	w.hasSynced = namespaceInformer.Informer().HasSynced
 }
 
-// Start starts the watcher and blocks until the context is cancelled or Stop is called.
+// Start starts the watcher and blocks until the context is cancelled or Stop
+// is called. If the namespace cache does not sync within the sync timeout,
+// the watcher restarts with exponential backoff.
 func (w *Watcher) Start(ctx context.Context) error {
 	log.Info().
 		Str("cluster", w.clusterName).
 		Dur("refresh_interval", w.refreshInterval).
 		Int("include_patterns", len(w.includePatterns)).
 		Int("exclude_patterns", len(w.excludePatterns)).
+		Str("source", w.source).
 		Msg("starting tenant watcher")
 
-	// Start informer factory
-	w.informerFactory.Start(w.stopCh)
+	if w.source != SourceNamespaces {
+		go w.pollBackends(ctx)
+	}
+	if w.source == SourceBackends {
+		// Namespaces are not watched
+		select {
+		case <-ctx.Done():
+			w.Stop()
+			return ctx.Err()
+		case <-w.stopCh:
+			return nil
+		}
+	}
+
+	backoff := w.initialBackoff
+	for {
+		err := w.run(ctx)
+		if ctx.Err() != nil {
+			w.Stop()
+			return ctx.Err()
+		}
+		if err == nil {
+			return nil
+		}
+
+		w.recordError(err)
+		w.mu.Lock()
+		w.status.Restarts++
+		w.mu.Unlock()
+		metrics.TenantWatcherRestarts.WithLabelValues(w.clusterName).Inc()
+
+		log.Warn().Err(err).
+			Str("cluster", w.clusterName).
+			Dur("retry_in", backoff).
+			Msg("tenant watcher failed to sync, restarting")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			w.Stop()
+			return ctx.Err()
+		case <-w.stopCh:
+			return nil
+		}
+		backoff = min(backoff*2, w.maxBackoff)
+		w.newInformer()
+	}
+}
+
+// run runs the current informer until the watcher stops, or until its
+// initial sync fails.
+func (w *Watcher) run(ctx context.Context) error {
+	w.mu.RLock()
+	informerFactory, hasSynced := w.informerFactory, w.hasSynced
+	w.mu.RUnlock()
+
+	// The informer stops when the watcher stops or this run fails
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-w.stopCh:
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	informerFactory.Start(runCtx.Done())
 
 	// Wait for cache sync
-	if !cache.WaitForCacheSync(ctx.Done(), w.hasSynced) {
-		return fmt.Errorf("failed to sync namespace cache")
+	syncCtx, cancelSync := context.WithTimeout(runCtx, w.syncTimeout)
+	defer cancelSync()
+	if !cache.WaitForCacheSync(syncCtx.Done(), hasSynced) {
+		if w.stopped() {
+			return nil
+		}
+		w.mu.RLock()
+		lastErr := w.status.LastError
+		w.mu.RUnlock()
+		if lastErr != "" {
+			return fmt.Errorf("failed to sync namespace cache: %s", lastErr)
+		}
+		return fmt.Errorf("failed to sync namespace cache within %s", w.syncTimeout)
 	}
 
 	log.Info().Str("cluster", w.clusterName).Msg("tenant watcher cache synced")
 
+	w.mu.Lock()
+	w.status.Synced = true
+	w.status.LastSync = time.Now()
+	w.mu.Unlock()
+	metrics.TenantWatcherSynced.WithLabelValues(w.clusterName).Set(1)
+
 	// Initial refresh
 	w.refreshTenants()
 
-	// Wait for stop signal
-	select {
-	case <-ctx.Done():
-		w.Stop()
-		return ctx.Err()
-	case <-w.stopCh:
-		return nil
+	// Refresh periodically, so that retained tenants expire, until stopped
+	ticker := time.NewTicker(w.refreshInterval)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			w.refreshTenants()
+		case <-runCtx.Done():
+			done = true
+		}
 	}
+
+	w.mu.Lock()
+	w.status.Synced = false
+	w.mu.Unlock()
+	metrics.TenantWatcherSynced.WithLabelValues(w.clusterName).Set(0)
+	return nil
 }
 
 // StartAsync starts the watcher in the background and returns immediately.
@@ -175,6 +416,15 @@ func (w *Watcher) Stop() {
 	}
 }
 
+func (w *Watcher) stopped() bool {
+	select {
+	case <-w.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
 // Tenants returns the current list of tenants.
 func (w *Watcher) Tenants() []string {
 	w.mu.RLock()
@@ -194,41 +444,200 @@ func (w *Watcher) TenantCount() int {
 
 // HasSynced returns true if the watcher has synced its cache.
 func (w *Watcher) HasSynced() bool {
-	return w.hasSynced()
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.status.Synced
 }
 
-func (w *Watcher) onNamespaceChange() {
-	w.refreshTenants()
+// Status returns the current state of the watcher.
+func (w *Watcher) Status() Status {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	status := w.status
+	if len(w.deleted) > 0 {
+		status.Retained = maps.Clone(w.deleted)
+	}
+	return status
 }
 
-func (w *Watcher) refreshTenants() {
-	namespaces, err := w.namespaceLister.List(labels.Everything())
-	if err != nil {
-		log.Error().Err(err).Str("cluster", w.clusterName).Msg("failed to list namespaces")
+// CheckSynced returns an error if the watcher requires a synced namespace
+// cache and has never synced, so that queries are not sent without tenants.
+func (w *Watcher) CheckSynced() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.requireSync && w.status.LastSync.IsZero() {
+		return fmt.Errorf("tenants of cluster %s are not synced yet", w.clusterName)
+	}
+	return nil
+}
+
+func (w *Watcher) recordError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.LastError = err.Error()
+	w.status.LastErrorTime = time.Now()
+}
+
+func (w *Watcher) onNamespaceChange() {
+	// The informer adds namespaces one by one while it lists them, on start
+	// and after every restart. A refresh would see a partial list and, with
+	// retention, record the missing tenants as deleted. run refreshes once
+	// the cache has synced.
+	w.mu.RLock()
+	hasSynced := w.hasSynced
+	w.mu.RUnlock()
+	if !hasSynced() {
 		return
 	}
+	w.refreshTenants()
+}
 
-	tenants := make([]string, 0, len(namespaces))
-	for _, ns := range namespaces {
-		if w.shouldInclude(ns.Name) {
-			tenants = append(tenants, ns.Name)
+func (w *Watcher) refreshTenants() {
+	var tenants []string
+	if w.source != SourceBackends {
+		var err error
+		if tenants, err = w.namespaceTenants(); err != nil {
+			w.recordError(err)
+			log.Error().Err(err).Str("cluster", w.clusterName).Msg("failed to list namespaces")
+			return
 		}
 	}
 
-	// Sort for consistent ordering
-	sort.Strings(tenants)
-
 	w.mu.Lock()
+	// Only namespaces are retained: a tenant dropping out of a backend
+	// listing has no deleted namespace to keep it for
+	if w.retention > 0 && w.source != SourceBackends {
+		tenants = w.retain(tenants, time.Now())
+	}
+	tenants = w.combine(tenants)
 	oldCount := len(w.tenants)
+	changed := !slices.Equal(w.tenants, tenants)
+	added, removed := diffTenants(w.tenants, tenants)
 	w.tenants = tenants
+	w.status.LastRefresh = time.Now()
+	w.status.TenantsAdded += added
+	w.status.TenantsRemoved += removed
+	listeners := w.listeners
 	w.mu.Unlock()
 
+	metrics.TenantWatcherLastRefresh.WithLabelValues(w.clusterName).SetToCurrentTime()
+	metrics.TenantChanges.WithLabelValues(w.clusterName, "added").Add(float64(added))
+	metrics.TenantChanges.WithLabelValues(w.clusterName, "removed").Add(float64(removed))
+
 	if oldCount != len(tenants) {
 		log.Info().
 			Str("cluster", w.clusterName).
 			Int("tenant_count", len(tenants)).
 			Msg("tenant list updated")
 	}
+
+	if changed {
+		for _, fn := range listeners {
+			fn(tenants)
+		}
+	}
+}
+
+// namespaceTenants returns the sorted tenants of the cached namespaces.
+func (w *Watcher) namespaceTenants() ([]string, error) {
+	w.mu.RLock()
+	namespaceLister := w.namespaceLister
+	w.mu.RUnlock()
+
+	namespaces, err := namespaceLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	// Several namespaces may belong to the same tenant
+	tenants := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if tenant := w.tenantOf(ns); tenant != "" {
+			tenants = append(tenants, tenant)
+		}
+	}
+
+	// Sort for consistent ordering
+	sort.Strings(tenants)
+	return slices.Compact(tenants), nil
+}
+
+// retain returns the tenants of existing namespaces together with the
+// tenants of namespaces deleted within the retention period, and saves the
+// retention state if it changed. It must be called with w.mu held.
+func (w *Watcher) retain(live []string, now time.Time) []string {
+	changed := !slices.Equal(w.live, live)
+	for _, t := range w.live {
+		if _, found := slices.BinarySearch(live, t); !found {
+			w.deleted[t] = now
+		}
+	}
+
+	tenants := slices.Clone(live)
+	for t, deletedAt := range w.deleted {
+		if _, found := slices.BinarySearch(live, t); found || now.Sub(deletedAt) >= w.retention {
+			// Recreated or expired
+			delete(w.deleted, t)
+			changed = true
+			continue
+		}
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	w.live = live
+
+	if changed && w.store != nil {
+		state := RetentionState{Tenants: live, Deleted: maps.Clone(w.deleted)}
+		if err := w.store.Save(state); err != nil {
+			w.status.LastError = err.Error()
+			w.status.LastErrorTime = now
+			log.Error().Err(err).Str("cluster", w.clusterName).Msg("failed to save tenant retention state")
+		}
+	}
+	return tenants
+}
+
+// diffTenants counts the tenants added and removed between two sorted
+// tenant lists.
+func diffTenants(old, tenants []string) (added, removed int) {
+	for _, t := range tenants {
+		if _, found := slices.BinarySearch(old, t); !found {
+			added++
+		}
+	}
+	for _, t := range old {
+		if _, found := slices.BinarySearch(tenants, t); !found {
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// OnChange registers a function called with the new tenant list whenever it
+// changes. Listeners are called synchronously and must not block.
+func (w *Watcher) OnChange(fn func(tenants []string)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// tenantOf returns the tenant ID of a namespace, or "" if the namespace is
+// not a tenant.
+func (w *Watcher) tenantOf(ns *corev1.Namespace) string {
+	if !w.shouldInclude(ns.Name) {
+		return ""
+	}
+	if w.tenantAnnotation != "" {
+		if tenant := ns.Annotations[w.tenantAnnotation]; tenant != "" {
+			return tenant
+		}
+	}
+	if w.tenantLabel != "" {
+		if tenant := ns.Labels[w.tenantLabel]; tenant != "" {
+			return tenant
+		}
+	}
+	return ns.Name
 }
 
 func (w *Watcher) shouldInclude(name string) bool {
@@ -308,7 +717,7 @@ func (w *Watcher) truncateOrgIDHeader(tenants []string, maxLength int) string {
 
 // ListNamespaces lists all namespaces from the cluster (for initial sync or debugging).
 func (w *Watcher) ListNamespaces(ctx context.Context) ([]string, error) {
-	namespaces, err := w.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	namespaces, err := w.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: w.labelSelector})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list namespaces: %w", err)
 	}
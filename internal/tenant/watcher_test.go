@@ -2,12 +2,20 @@ package tenant
 
 import (
 	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestNewWatcher(t *testing.T) {
@@ -74,6 +82,26 @@ func TestNewWatcher(t *testing.T) {
 			wantErr: true,
 			errMsg:  "invalid exclude pattern",
 		},
+		{
+			name: "invalid label selector",
+			cfg: WatcherConfig{
+				ClusterName:   "test-cluster",
+				Client:        client,
+				LabelSelector: "tenant in (",
+			},
+			wantErr: true,
+			errMsg:  "invalid label selector",
+		},
+		{
+			name: "unknown source",
+			cfg: WatcherConfig{
+				ClusterName: "test-cluster",
+				Client:      client,
+				Source:      "everything",
+			},
+			wantErr: true,
+			errMsg:  "unknown tenant source",
+		},
 	}
 
 	for _, tt := range tests {
@@ -396,6 +424,353 @@ func TestWatcher_RefreshTenants(t *testing.T) {
 	w.Stop()
 }
 
+func TestWatcher_TenantOf(t *testing.T) {
+	w, err := NewWatcher(WatcherConfig{
+		ClusterName:      "test",
+		Client:           fake.NewSimpleClientset(),
+		ExcludePatterns:  []string{"^kube-.*"},
+		TenantAnnotation: "observability.example.com/tenant",
+		TenantLabel:      "tenant",
+	})
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		namespace   string
+		labels      map[string]string
+		annotations map[string]string
+		want        string
+	}{
+		{name: "namespace name", namespace: "payments-prod", want: "payments-prod"},
+		{name: "label", namespace: "payments-prod", labels: map[string]string{"tenant": "payments"}, want: "payments"},
+		{
+			name:        "annotation over label",
+			namespace:   "payments-prod",
+			labels:      map[string]string{"tenant": "payments"},
+			annotations: map[string]string{"observability.example.com/tenant": "billing"},
+			want:        "billing",
+		},
+		{name: "empty annotation", namespace: "payments-prod", annotations: map[string]string{"observability.example.com/tenant": ""}, want: "payments-prod"},
+		{name: "excluded namespace", namespace: "kube-system", labels: map[string]string{"tenant": "payments"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: tt.namespace, Labels: tt.labels, Annotations: tt.annotations}}
+			if got := w.tenantOf(ns); got != tt.want {
+				t.Errorf("tenantOf(%q) = %q, want %q", tt.namespace, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcher_RefreshTenants_LabelSelector(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "payments-prod",
+			Labels: map[string]string{"observability": "enabled", "tenant": "payments"},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "payments-jobs",
+			Labels: map[string]string{"observability": "enabled", "tenant": "payments"},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "checkout",
+			Labels: map[string]string{"observability": "enabled"},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "legacy",
+			Labels: map[string]string{"tenant": "legacy"},
+		}},
+	)
+
+	w, err := NewWatcher(WatcherConfig{
+		ClusterName:   "test",
+		Client:        client,
+		LabelSelector: "observability=enabled",
+		TenantLabel:   "tenant",
+	})
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w.informerFactory.Start(w.stopCh)
+	for _, synced := range w.informerFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			t.Fatal("failed to sync namespace cache")
+		}
+	}
+	w.refreshTenants()
+
+	tenants := w.Tenants()
+	if len(tenants) != 2 || tenants[0] != "checkout" || tenants[1] != "payments" {
+		t.Errorf("expected tenants [checkout payments], got %v", tenants)
+	}
+
+	// Relabeling a namespace moves it to another tenant
+	ns, err := client.CoreV1().Namespaces().Get(ctx, "checkout", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get namespace: %v", err)
+	}
+	ns.Labels["tenant"] = "payments"
+	if _, err := client.CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update namespace: %v", err)
+	}
+	waitFor(t, func() bool { return len(w.Tenants()) == 1 })
+	if tenants := w.Tenants(); tenants[0] != "payments" {
+		t.Errorf("expected tenants [payments], got %v", tenants)
+	}
+
+	w.Stop()
+}
+
+func TestWatcher_OnChange(t *testing.T) {
+	w, err := NewWatcher(WatcherConfig{
+		ClusterName: "test",
+		Client:      fake.NewSimpleClientset(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	var changes [][]string
+	w.OnChange(func(tenants []string) {
+		changes = append(changes, tenants)
+	})
+
+	// Populate the informer cache directly, without running event handlers
+	indexer := w.informerFactory.Core().V1().Namespaces().Informer().GetIndexer()
+	indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "game-prod"}})
+
+	w.refreshTenants()
+	w.refreshTenants()
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change notification, got %d", len(changes))
+	}
+
+	// A rename keeps the tenant count but still changes the tenant set
+	indexer.Delete(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "game-prod"}})
+	indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "game-dev"}})
+
+	w.refreshTenants()
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 change notifications, got %d", len(changes))
+	}
+	if len(changes[1]) != 1 || changes[1][0] != "game-dev" {
+		t.Errorf("expected new tenant list [game-dev], got %v", changes[1])
+	}
+}
+
+func TestWatcher_RestartsAfterFailedSync(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "game-prod"}},
+	)
+	var failing atomic.Bool
+	failing.Store(true)
+	client.PrependReactor("list", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if failing.Load() {
+			return true, nil, errors.New("namespaces is forbidden")
+		}
+		return false, nil, nil
+	})
+
+	w, err := NewWatcher(WatcherConfig{
+		ClusterName: "test",
+		Client:      client,
+		SyncTimeout: 100 * time.Millisecond,
+		RequireSync: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	w.initialBackoff = 10 * time.Millisecond
+	w.maxBackoff = 10 * time.Millisecond
+
+	if err := w.CheckSynced(); err == nil {
+		t.Error("expected an error before the first sync")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.StartAsync(ctx)
+
+	waitFor(t, func() bool { return w.Status().Restarts > 0 })
+	status := w.Status()
+	if status.Synced || !strings.Contains(status.LastError, "namespaces is forbidden") || status.LastErrorTime.IsZero() {
+		t.Errorf("unexpected status after failed sync: %+v", status)
+	}
+
+	failing.Store(false)
+	waitFor(t, func() bool { return w.Status().Synced })
+
+	status = w.Status()
+	if status.LastSync.IsZero() || status.LastRefresh.IsZero() || status.TenantsAdded != 1 {
+		t.Errorf("unexpected status after sync: %+v", status)
+	}
+	if tenants := w.Tenants(); len(tenants) != 1 || tenants[0] != "game-prod" {
+		t.Errorf("expected tenants [game-prod], got %v", tenants)
+	}
+	if err := w.CheckSynced(); err != nil {
+		t.Errorf("expected no error after sync, got %v", err)
+	}
+
+	w.Stop()
+}
+
+// waitFor polls cond until it holds, failing the test after 5s.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatcher_Retention(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "tenants.json"))
+	cfg := WatcherConfig{
+		ClusterName:    "test",
+		Client:         fake.NewSimpleClientset(),
+		Retention:      24 * time.Hour,
+		RetentionStore: store,
+	}
+	w, err := NewWatcher(cfg)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	indexer := w.informerFactory.Core().V1().Namespaces().Informer().GetIndexer()
+	indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}})
+	indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "checkout"}})
+	w.refreshTenants()
+
+	// A deleted namespace keeps its tenant
+	indexer.Delete(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "checkout"}})
+	w.refreshTenants()
+	if tenants := w.Tenants(); !slices.Equal(tenants, []string{"checkout", "payments"}) {
+		t.Errorf("expected checkout to be retained, got %v", tenants)
+	}
+	deletedAt, ok := w.Status().Retained["checkout"]
+	if !ok {
+		t.Fatalf("expected checkout in retained tenants, got %v", w.Status().Retained)
+	}
+
+	// Deletion times survive restarts
+	w, err = NewWatcher(cfg)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	if got := w.retain([]string{"payments"}, deletedAt.Add(time.Hour)); !slices.Equal(got, []string{"checkout", "payments"}) {
+		t.Errorf("expected checkout to be retained after restart, got %v", got)
+	}
+	if got := w.retain([]string{"payments"}, deletedAt.Add(25*time.Hour)); !slices.Equal(got, []string{"payments"}) {
+		t.Errorf("expected checkout to expire, got %v", got)
+	}
+
+	// Namespaces deleted while the proxy was down are retained too
+	w, err = NewWatcher(cfg)
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+	if got := w.retain(nil, time.Now()); !slices.Equal(got, []string{"payments"}) {
+		t.Errorf("expected payments to be retained, got %v", got)
+	}
+}
+
+// recordingStore is a RetentionStore keeping the saved states in memory.
+type recordingStore struct {
+	mu    sync.Mutex
+	state RetentionState
+	saves []RetentionState
+}
+
+func (s *recordingStore) Load() (RetentionState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, nil
+}
+
+func (s *recordingStore) Save(state RetentionState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	s.saves = append(s.saves, state)
+	return nil
+}
+
+func TestWatcher_Retention_Restart(t *testing.T) {
+	deletedAt := time.Now().Add(-time.Hour)
+	store := &recordingStore{state: RetentionState{
+		Tenants: []string{"checkout", "payments"},
+		Deleted: map[string]time.Time{"legacy": deletedAt},
+	}}
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "checkout"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}},
+	)
+
+	w, err := NewWatcher(WatcherConfig{
+		ClusterName:    "test",
+		Client:         client,
+		Retention:      24 * time.Hour,
+		RetentionStore: store,
+	})
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	var mu sync.Mutex
+	var changes int
+	w.OnChange(func([]string) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes++
+	})
+
+	// Namespace events during the initial list see a partial cache
+	indexer := w.informerFactory.Core().V1().Namespaces().Informer().GetIndexer()
+	indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}})
+	w.onNamespaceChange()
+	if retained := w.Status().Retained; len(retained) != 1 {
+		t.Errorf("expected only legacy to be retained before sync, got %v", retained)
+	}
+	indexer.Delete(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w.StartAsync(ctx)
+	waitFor(t, w.HasSynced)
+	w.Stop()
+
+	// Live tenants are not stamped as deleted, and the unchanged state is
+	// not saved
+	if retained := w.Status().Retained; len(retained) != 1 || !retained["legacy"].Equal(deletedAt) {
+		t.Errorf("expected only legacy to be retained, got %v", retained)
+	}
+	if tenants := w.Tenants(); !slices.Equal(tenants, []string{"checkout", "legacy", "payments"}) {
+		t.Errorf("expected tenants [checkout legacy payments], got %v", tenants)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.saves) != 0 {
+		t.Errorf("expected no saves, got %v", store.saves)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if changes != 1 {
+		t.Errorf("expected 1 change notification, got %d", changes)
+	}
+}
+
 func TestWatcher_ListNamespaces(t *testing.T) {
 	client := fake.NewSimpleClientset(
 		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
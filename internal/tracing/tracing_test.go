@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	shutdown, err := Setup(context.Background(), Config{Exporter: "none", ServiceName: "test", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer shutdown(context.Background())
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+	if !span.SpanContext().IsSampled() {
+		t.Fatal("expected span to be sampled")
+	}
+
+	headers := make(http.Header)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(headers))
+	if !strings.Contains(headers.Get("traceparent"), span.SpanContext().TraceID().String()) {
+		t.Errorf("expected traceparent header with trace ID, got %q", headers.Get("traceparent"))
+	}
+}
+
+func TestSetup_FollowsParentSampling(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	shutdown, err := Setup(context.Background(), Config{Exporter: "none", ServiceName: "test", SampleRatio: 0})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer shutdown(context.Background())
+
+	headers := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(headers))
+	_, span := otel.Tracer("test").Start(ctx, "test")
+	defer span.End()
+
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected span to join the incoming trace, got %s", span.SpanContext().TraceID())
+	}
+	if !span.SpanContext().IsSampled() {
+		t.Error("expected span of a sampled parent to be sampled")
+	}
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: "jaeger"}); err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+}